@@ -2,11 +2,13 @@ module github.com/sirkon/protoast/v2
 
 go 1.26
 
-require github.com/emicklei/proto v1.14.3
+require (
+	github.com/alecthomas/assert/v2 v2.11.0
+	github.com/emicklei/proto v1.14.3
+)
 
 require (
 	github.com/alecthomas/assert v1.0.0 // indirect
-	github.com/alecthomas/assert/v2 v2.11.0 // indirect
 	github.com/alecthomas/colour v0.1.0 // indirect
 	github.com/alecthomas/repr v0.4.0 // indirect
 	github.com/hexops/gotextdiff v1.0.3 // indirect
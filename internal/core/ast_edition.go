@@ -0,0 +1,21 @@
+package core
+
+import (
+	"text/scanner"
+
+	"github.com/emicklei/proto"
+)
+
+// Edition represents edition declaration of a file, like `edition = "2023";`.
+type Edition struct {
+	proto *proto.Edition
+}
+
+var _ Node = new(Edition)
+
+func (e *Edition) Value() string {
+	return e.proto.Value
+}
+
+func (e *Edition) nodeProto() proto.Visitee { return e.proto }
+func (e *Edition) pos() scanner.Position    { return e.proto.Position }
@@ -63,6 +63,44 @@ func (e *Enum) Value(r *Registry, name string) *EnumValue {
 	return nil
 }
 
+// ValueByNumber returns the first enum value with the given number. This is
+// the canonical one when aliases are allowed.
+func (e *Enum) ValueByNumber(r *Registry, number int) *EnumValue {
+	for _, e := range e.proto.Elements {
+		v, ok := e.(*proto.EnumField)
+		if !ok {
+			continue
+		}
+
+		if v.Integer != number {
+			continue
+		}
+
+		return r.wrap(v).(*EnumValue)
+	}
+
+	return nil
+}
+
+// AllowAlias checks if the enum has allow_alias option set, meaning
+// different values can share the same number.
+func (e *Enum) AllowAlias() bool {
+	for _, element := range e.proto.Elements {
+		v, ok := element.(*proto.Option)
+		if ok && v.Name == "allow_alias" && v.Constant.Source == "true" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsOpen checks if the enum is open, meaning unknown numbers are kept
+// as is instead of being treated as unknown fields.
+func (e *Enum) IsOpen(r *Registry) bool {
+	return r.Features(e).EnumType == EnumTypeOpen
+}
+
 // Everything returns everything defined in this enum.
 func (e *Enum) Everything(r *Registry) iter.Seq[Node] {
 	return func(yield func(Node) bool) {
@@ -89,6 +127,12 @@ func (e *EnumValue) Value() int {
 	return e.proto.Integer
 }
 
+// IsAlias checks if the value reuses a number of some value defined earlier in the enum.
+func (e *EnumValue) IsAlias(r *Registry) bool {
+	enum := r.wrap(e.proto.Parent).(*Enum)
+	return enum.ValueByNumber(r, e.proto.Integer) != e
+}
+
 var _ Node = new(Enum)
 
 var _ Node = new(EnumValue)
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"iter"
+	"text/scanner"
+
+	"github.com/emicklei/proto"
+)
+
+// Extensions represents extension ranges declaration of a message.
+type Extensions struct {
+	isNodeOptionable
+
+	proto *proto.Extensions
+}
+
+// Values returns extension ranges.
+func (e *Extensions) Values() iter.Seq[ReservedValue] {
+	return func(yield func(ReservedValue) bool) {
+		for _, rng := range e.proto.Ranges {
+			var val ReservedValue
+			switch {
+			case rng.Max:
+				val = &ReservedValueFrom{
+					From: rng.From,
+				}
+			case rng.From == rng.To:
+				val = &ReservedValueSingleNumber{
+					Value: rng.From,
+				}
+			default:
+				val = &ReservedValueRange{
+					From: rng.From,
+					To:   rng.To,
+				}
+			}
+			if !yield(val) {
+				return
+			}
+		}
+	}
+}
+
+var _ Node = new(Extensions)
+
+func (e *Extensions) nodeProto() proto.Visitee { return e.proto }
+func (e *Extensions) pos() scanner.Position    { return e.proto.Position }
@@ -30,6 +30,22 @@ func (f *File) Package() string {
 	return ""
 }
 
+// Edition returns an edition of the file. It is either "proto2" or "proto3"
+// for files with syntax declaration, or a value of edition declaration, like "2023".
+// Files without both of them are proto2 files.
+func (f *File) Edition() string {
+	for _, element := range f.proto.Elements {
+		switch v := element.(type) {
+		case *proto.Syntax:
+			return v.Value
+		case *proto.Edition:
+			return v.Value
+		}
+	}
+
+	return "proto2"
+}
+
 // Imports returns all imports used in this file.
 func (f *File) Imports(r *Registry) iter.Seq[*Import] {
 	return func(yield func(*Import) bool) {
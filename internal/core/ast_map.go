@@ -25,27 +25,90 @@ func (m *Map) Key() ComparableType {
 	return keyType
 }
 
-// Value returns map value type.
+// Value returns map value type. Its name is resolved with the same scope rules
+// the normal fields use.
 func (m *Map) Value(r *Registry) ComposableType {
-	valueType := builtinType(m.proto.Type)
-	if valueType != nil {
-		return valueType
+	switch t := r.getTypeByName(m.proto, m.proto.Type).(type) {
+	case BuiltinType:
+		return t
+	case *Message:
+		return t
+	case *Enum:
+		return t
+	default:
+		panic(errors.Newf("value type %s is not supported in maps", m.proto.Type))
 	}
+}
 
-	var qualifiedTypeName string
-	if !strings.HasPrefix(m.proto.Type, ".") {
-		qualifiedTypeName = "." + m.proto.Type
+// Entry returns implicit entry message of the map, the one descriptors synthesize
+// for maps. It is named after the field, like MapFieldEntry for map_field, and
+// has key = 1 and value = 2 fields.
+func (m *Map) Entry(r *Registry) *Message {
+	return r.wrap(r.mapEntries[m.proto]).(*Message)
+}
+
+// newMapEntry synthesizes map entry message for the given map field.
+func newMapEntry(f *proto.MapField) *proto.Message {
+	res := &proto.Message{
+		Position: f.Position,
+		Name:     mapEntryName(f.Name),
+		Parent:   f.Parent,
 	}
 
-	visitee := r.registry[qualifiedTypeName]
-	switch t := visitee.(type) {
-	case *proto.Message:
-		return r.wrap(t).(*Message)
-	case *proto.Enum:
-		return r.wrap(t).(*Enum)
-	default:
-		panic(errors.Newf("value type %s is not supported in maps", m.proto.Type))
+	key := &proto.NormalField{
+		Field: &proto.Field{
+			Position: f.Position,
+			Name:     "key",
+			Type:     f.KeyType,
+			Sequence: 1,
+			Parent:   res,
+		},
 	}
+	value := &proto.NormalField{
+		Field: &proto.Field{
+			Position: f.Position,
+			Name:     "value",
+			Type:     f.Type,
+			Sequence: 2,
+			Parent:   res,
+		},
+	}
+	option := &proto.Option{
+		Position: f.Position,
+		Name:     "map_entry",
+		Constant: proto.Literal{
+			Position: f.Position,
+			Source:   "true",
+		},
+		Parent: res,
+	}
+	res.Elements = []proto.Visitee{option, key, value}
+
+	return res
+}
+
+// mapEntryName computes map entry message name the way protoc does.
+func mapEntryName(fieldName string) string {
+	var res strings.Builder
+	capitalizeNext := true
+	for i := 0; i < len(fieldName); i++ {
+		c := fieldName[i]
+		switch {
+		case c == '_':
+			capitalizeNext = true
+		case capitalizeNext:
+			if 'a' <= c && c <= 'z' {
+				c -= 'a' - 'A'
+			}
+			res.WriteByte(c)
+			capitalizeNext = false
+		default:
+			res.WriteByte(c)
+		}
+	}
+	res.WriteString("Entry")
+
+	return res.String()
 }
 
 var _ Node = new(Map)
@@ -32,6 +32,18 @@ func (m *Message) IsExtension() bool {
 	return m.proto.IsExtend
 }
 
+// IsMapEntry checks if this is an implicit entry message of a map field.
+func (m *Message) IsMapEntry() bool {
+	for _, element := range m.proto.Elements {
+		v, ok := element.(*proto.Option)
+		if ok && v.Name == "map_entry" && v.Constant.Source == "true" {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Fields returns top level fields of the message.
 func (m *Message) Fields(r *Registry) iter.Seq[*MessageField] {
 	return func(yield func(*MessageField) bool) {
@@ -271,6 +283,21 @@ func (m *MessageField) Value() int {
 	}
 }
 
+// JSONName returns field name used in JSON mapping: a value of json_name option
+// if it is set or a lowerCamelCase form of the name otherwise.
+func (m *MessageField) JSONName() string {
+	switch p := m.proto.(type) {
+	case *proto.NormalField:
+		return fieldJSONName(p.Field)
+	case *proto.Oneof:
+		panic(errors.Newf("oneof options do not have a JSON name, you need to check field type first"))
+	case *proto.MapField:
+		return fieldJSONName(p.Field)
+	default:
+		panic(errors.Newf("message field came with invalid payload %T", m.proto))
+	}
+}
+
 // Optional checks if this field is defined as optional in PB.
 func (m *MessageField) Optional() bool {
 	switch p := m.proto.(type) {
@@ -285,6 +312,37 @@ func (m *MessageField) Optional() bool {
 	}
 }
 
+// Default returns a value of the field's [default = ...] option checked against
+// and converted to the field type. It is one of int, uint, float64, bool, string,
+// []byte or *EnumValue. Fields without default value return nil.
+func (m *MessageField) Default(r *Registry) (any, error) {
+	field, ok := m.proto.(*proto.NormalField)
+	if !ok {
+		return nil, nil
+	}
+
+	var option *proto.Option
+	for _, o := range field.Options {
+		if o.Name == "default" {
+			option = o
+		}
+	}
+	if option == nil {
+		return nil, nil
+	}
+
+	if field.Repeated {
+		return nil, errors.Newf("%s: repeated field %s cannot have default value", option.Position, field.Name)
+	}
+
+	res, err := decodeScalarLiteral(r, m.Type(r), &option.Constant)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s: decode default value of field %s", option.Position, field.Name)
+	}
+
+	return res, nil
+}
+
 var _ Node = new(Message)
 
 var _ Node = new(MessageField)
@@ -16,6 +16,7 @@ type OneOf struct {
 
 type OneOfBranch struct {
 	isFieldNode
+	isNodeOptionable
 
 	proto *proto.OneOfField
 }
@@ -64,6 +65,12 @@ func (o *OneOfBranch) Value() int {
 	return o.proto.Sequence
 }
 
+// JSONName returns branch name used in JSON mapping: a value of json_name option
+// if it is set or a lowerCamelCase form of the name otherwise.
+func (o *OneOfBranch) JSONName() string {
+	return fieldJSONName(o.proto.Field)
+}
+
 var (
 	_ Node = new(OneOf)
 	_ Node = new(OneOfBranch)
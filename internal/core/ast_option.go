@@ -6,6 +6,8 @@ import (
 	"text/scanner"
 
 	"github.com/emicklei/proto"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
 )
 
 type Option struct {
@@ -13,32 +15,22 @@ type Option struct {
 	registry    *Registry
 	optionClass *proto.Message
 	optionField *proto.NormalField
-}
 
-func newOption(r *Registry, scope string, class *proto.Message, option *proto.Option) *Option {
-	name := parenthesisReplacer.Replace(option.Name)
-	name, ok := r.resolveNameRaw(scope, name)
-	var field *proto.NormalField
-	if ok {
-		field = r.registry[name].(*proto.NormalField)
-	} else {
-		// There's only one choice for a valid proto - a builtin option.
-		for _, fld := range class.Elements {
-			vv, ok := fld.(*proto.NormalField)
-			if !ok {
-				continue
-			}
+	// parts are assignments to the option. There can be several of them when
+	// subfields are set separately, like (my.opt).a = 1 and (my.opt).b = 2.
+	parts []optionPart
+}
 
-			if vv.Name != option.Name {
-				continue
-			}
+type optionPart struct {
+	proto *proto.Option
+	path  []string
+}
 
-			field = vv
-			break
-		}
-	}
+func newOption(r *Registry, scope string, class *proto.Message, option *proto.Option) *Option {
+	segments := splitOptionName(option.Name)
+	field := r.optionField(scope, class, segments[0])
 	if field == nil {
-		panic("option field not found")
+		panic(errors.Newf("%s: option field %s not found", option.Position, segments[0]))
 	}
 
 	res := &Option{
@@ -46,7 +38,61 @@ func newOption(r *Registry, scope string, class *proto.Message, option *proto.Op
 		optionClass: class,
 		optionField: field,
 		proto:       option,
+		parts: []optionPart{
+			{
+				proto: option,
+				path:  segments[1:],
+			},
+		},
+	}
+	return res
+}
+
+// optionField looks for a field of the option class an option with the given head name refers.
+// It is either an extension, like (my.opt), or a builtin option.
+func (r *Registry) optionField(scope string, class *proto.Message, head string) *proto.NormalField {
+	if strings.HasPrefix(head, "(") {
+		name, ok := r.resolveNameRaw(scope, parenthesisReplacer.Replace(head))
+		if !ok {
+			return nil
+		}
+
+		field, _ := r.registry[name].(*proto.NormalField)
+		return field
+	}
+
+	// There's only one choice for a valid proto - a builtin option.
+	for _, fld := range class.Elements {
+		if vv, ok := fld.(*proto.NormalField); ok && vv.Name == head {
+			return vv
+		}
+	}
+
+	return nil
+}
+
+// splitOptionName splits option name into the option itself and a path of its subfields.
+// Extension names are kept in parenthesis: (my.opt).a.(my.ext).b -> (my.opt), a, (my.ext), b.
+func splitOptionName(name string) []string {
+	var res []string
+	var depth int
+	var start int
+	for i := 0; i < len(name); i++ {
+		switch name[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '.':
+			if depth > 0 {
+				continue
+			}
+			res = append(res, name[start:i])
+			start = i + 1
+		}
 	}
+	res = append(res, name[start:])
+
 	return res
 }
 
@@ -58,12 +104,44 @@ func (o *Option) Name() string {
 		scope := o.registry.scopes[o.optionClass]
 		return "(" + scope + ")" + "." + o.optionField.Name
 	} else {
-		return o.proto.Name
+		return splitOptionName(o.proto.Name)[0]
 	}
 }
 
+// Value returns option value. It panics if the value does not fit into the option type.
 func (o *Option) Value() OptionValueVariant {
-	return buildFromLiteral(o.registry, o.proto, o.optionField, &o.proto.Constant, false)
+	res, err := o.TryValue()
+	if err != nil {
+		panic(err)
+	}
+
+	return res
+}
+
+// TryValue returns option value or an error pointing to the literal that does not fit into the option type.
+// Values of options set by parts, like (my.opt).a = 1 and (my.opt).b = 2, are merged into a single message
+// value, where each part keeps its own position. Parts setting the same non-repeated field, or a field
+// and its subfield, are reported as an error.
+func (o *Option) TryValue() (OptionValueVariant, error) {
+	typ := o.registry.wrap(o.optionField).(*MessageField).Type(o.registry)
+
+	var res OptionValueVariant
+	for i, part := range o.parts {
+		v, repeated, err := part.value(o.registry, typ)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, prev := range o.parts[:i] {
+			if part.overlaps(prev) && !(repeated && len(part.path) == len(prev.path)) {
+				return nil, errors.Newf("%s: option %s was already set at %s", part.proto.Position, part.proto.Name, prev.proto.Position)
+			}
+		}
+
+		res = mergeOptionValues(res, v)
+	}
+
+	return res, nil
 }
 
 // Is checks if given option has this qualified name. Meaning .x.y.z, not x.y.z.
@@ -71,42 +149,196 @@ func (o *Option) Is(r *Registry, name string) bool {
 	return r.NodeIndex(r.wrap(o.optionField)) == name
 }
 
+// value builds a value of the option type having only this part set. It also reports if the field
+// the part sets is a repeated or a map one.
+func (p optionPart) value(r *Registry, typ Type) (OptionValueVariant, bool, error) {
+	types := make([]Type, 0, len(p.path))
+	for _, name := range p.path {
+		msg, ok := typ.(*Message)
+		if !ok {
+			return nil, false, errors.Newf("%s: %s is not a message and has no field %s", p.proto.Position, r.TypeName(typ), name)
+		}
+
+		types = append(types, typ)
+		typ = messageLiteralFieldType(r, msg, parenthesisReplacer.Replace(name))
+		if typ == nil {
+			return nil, false, errors.Newf("%s: unknown message %s field %s", p.proto.Position, r.TypeName(msg), name)
+		}
+	}
+
+	res, err := buildFromLiteral(r, p.proto, typ, &p.proto.Constant)
+	if err != nil {
+		return nil, false, err
+	}
+	_, repeated := res.(*OptionValueArray)
+
+	literal := &proto.Literal{
+		Position: p.proto.Position,
+	}
+	for i := len(p.path) - 1; i >= 0; i-- {
+		base := isOptionValueVariant{
+			option:   p.proto,
+			registry: r,
+			typ:      types[i],
+		}
+		res = &OptionValueMap{
+			isOptionValueVariant: base,
+			proto:                literal,
+			Value: []OptionValueMapItem{
+				{
+					isOptionValueVariant: base,
+					proto:                literal,
+					Key:                  parenthesisReplacer.Replace(p.path[i]),
+					Value:                res,
+				},
+			},
+		}
+	}
+
+	return res, repeated, nil
+}
+
+// overlaps checks if parts set the same field or one of them sets a subfield of another's field.
+func (p optionPart) overlaps(other optionPart) bool {
+	for i := range min(len(p.path), len(other.path)) {
+		if parenthesisReplacer.Replace(p.path[i]) != parenthesisReplacer.Replace(other.path[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// mergeOptionValues merges messages field by field and concatenates arrays.
+// Other values are replaced by the later ones, though overlapping parts are
+// rejected before they are merged.
+func mergeOptionValues(prev, next OptionValueVariant) OptionValueVariant {
+	switch p := prev.(type) {
+	case *OptionValueMap:
+		n, ok := next.(*OptionValueMap)
+		if !ok {
+			return next
+		}
+
+	items:
+		for _, item := range n.Value {
+			for i, prevItem := range p.Value {
+				if prevItem.Key == item.Key {
+					p.Value[i].Value = mergeOptionValues(prevItem.Value, item.Value)
+					continue items
+				}
+			}
+
+			p.Value = append(p.Value, item)
+		}
+		return p
+
+	case *OptionValueArray:
+		n, ok := next.(*OptionValueArray)
+		if !ok {
+			return next
+		}
+
+		p.Value = append(p.Value, n.Value...)
+		return p
+
+	default:
+		return next
+	}
+}
+
 func seqOptions[T proto.Visitee](r *Registry, scope, className string, elements []T) iter.Seq[*Option] {
 	class := r.registry[className].(*proto.Message)
 
 	return func(yield func(*Option) bool) {
+		// Assignments to the same option are merged, thus they must be all collected first.
+		var options []*Option
+	elements:
 		for _, element := range elements {
 			var vv proto.Visitee = element
 			option, ok := vv.(*proto.Option)
-			if !ok {
+			if !ok || isPseudoOption(option) {
 				continue
 			}
 
-			if !yield(newOption(r, scope, class, option)) {
+			opt := newOption(r, scope, class, option)
+			for _, prev := range options {
+				if prev.optionField == opt.optionField {
+					prev.parts = append(prev.parts, opt.parts...)
+					continue elements
+				}
+			}
+
+			options = append(options, opt)
+		}
+
+		for _, option := range options {
+			if !yield(option) {
 				return
 			}
 		}
 	}
 }
 
+// namedOption looks for an option with the given name. It can be a name as it is written in the source,
+// like (my.opt), a name returned by [Option.Name] or a fully qualified one like .pkg.my.opt.
 func namedOption[T proto.Visitee](r *Registry, name string, scope, className string, elements []T) *Option {
-	class := r.registry[className].(*proto.Message)
-
-	for _, element := range elements {
-		var vv proto.Visitee = element
-		option, ok := vv.(*proto.Option)
-		if !ok {
-			continue
+	for option := range seqOptions(r, scope, className, elements) {
+		if splitOptionName(option.proto.Name)[0] == name || option.Name() == name || option.Is(r, name) {
+			return option
 		}
+	}
+
+	return nil
+}
+
+// isPseudoOption checks if this is a field default value or JSON name. They are written
+// as options but have nothing to do with FieldOptions.
+func isPseudoOption(option *proto.Option) bool {
+	return option.Name == "default" || option.Name == "json_name"
+}
 
-		if option.Name != name {
-			continue
+// nodeOptions returns options attached to the node as they are in the source.
+func nodeOptions(node Node) []*proto.Option {
+	var elements []proto.Visitee
+	switch n := node.(type) {
+	case *File:
+		elements = n.proto.Elements
+	case *Message:
+		elements = n.proto.Elements
+	case *MessageField:
+		switch p := n.proto.(type) {
+		case *proto.NormalField:
+			return p.Options
+		case *proto.Oneof:
+			elements = p.Elements
+		case *proto.MapField:
+			return p.Options
 		}
+	case *OneOf:
+		elements = n.proto.Elements
+	case *OneOfBranch:
+		return n.proto.Options
+	case *Extensions:
+		return n.proto.Options
+	case *Enum:
+		elements = n.proto.Elements
+	case *EnumValue:
+		elements = n.proto.Elements
+	case *Service:
+		elements = n.proto.Elements
+	case *Method:
+		elements = n.proto.Elements
+	}
 
-		return newOption(r, scope, class, option)
+	var res []*proto.Option
+	for _, element := range elements {
+		if v, ok := element.(*proto.Option); ok {
+			res = append(res, v)
+		}
 	}
 
-	return nil
+	return res
 }
 
 const (
@@ -118,6 +350,8 @@ const (
 	registryOptionsOneof        = ".google.protobuf.OneofOptions"
 	registryOptionsService      = ".google.protobuf.ServiceOptions"
 	registryOptionsMethod       = ".google.protobuf.MethodOptions"
+
+	registryOptionsExtensionRange = ".google.protobuf.ExtensionRangeOptions"
 )
 
 var parenthesisReplacer = strings.NewReplacer("(", "", ")", "")
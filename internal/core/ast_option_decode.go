@@ -0,0 +1,277 @@
+package core
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+)
+
+// Decode decodes option value into v, see [Registry.DecodeOptionValue] for details.
+func (o *Option) Decode(r *Registry, v any) error {
+	value, err := o.TryValue()
+	if err != nil {
+		return err
+	}
+
+	return r.decodeOptionValue(value, o.Name(), v)
+}
+
+// DecodeOptionValue decodes option value into v, which must be a non-nil pointer.
+//
+// Messages are decoded into structs, where fields are matched with proto:"field_name"
+// tag or, if there is no tag, by Go field name compared with the proto one ignoring
+// underscores and case. Fields tagged with proto:"-" are skipped. Map fields are decoded
+// into Go maps, repeated fields into slices, enums into strings (value names) or
+// integers (value numbers). Pointers are allocated as needed and interfaces the value
+// variant implements, like OptionValueVariant itself, get the variant as is.
+func (r *Registry) DecodeOptionValue(value OptionValueVariant, v any) error {
+	return r.decodeOptionValue(value, "", v)
+}
+
+func (r *Registry) decodeOptionValue(value OptionValueVariant, path string, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.Newf("non-nil pointer expected to decode option value into, got %T", v)
+	}
+
+	return r.decodeOptionValueTo(value, path, rv.Elem())
+}
+
+func (r *Registry) decodeOptionValueTo(value OptionValueVariant, path string, dst reflect.Value) error {
+	if dst.Kind() == reflect.Interface {
+		if !reflect.TypeOf(value).Implements(dst.Type()) {
+			return decodeMismatch(path, value, dst)
+		}
+		dst.Set(reflect.ValueOf(value))
+		return nil
+	}
+
+	if dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return r.decodeOptionValueTo(value, path, dst.Elem())
+	}
+
+	switch v := value.(type) {
+	case *OptionValueBool:
+		if dst.Kind() != reflect.Bool {
+			return decodeMismatch(path, value, dst)
+		}
+		dst.SetBool(v.Value)
+
+	case *OptionValueInt:
+		return decodeOptionInteger(path, value, int64(v.Value), v.Value < 0, uint64(v.Value), dst)
+
+	case *OptionValueUint:
+		return decodeOptionInteger(path, value, int64(v.Value), false, uint64(v.Value), dst)
+
+	case *OptionValueFloat:
+		switch dst.Kind() {
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(v.Value)
+		default:
+			return decodeMismatch(path, value, dst)
+		}
+
+	case *OptionValueString:
+		switch {
+		case dst.Kind() == reflect.String:
+			dst.SetString(v.Value)
+		case isByteSlice(dst.Type()):
+			dst.SetBytes([]byte(v.Value))
+		default:
+			return decodeMismatch(path, value, dst)
+		}
+
+	case *OptionValueBytes:
+		switch {
+		case dst.Kind() == reflect.String:
+			dst.SetString(string(v.Value))
+		case isByteSlice(dst.Type()):
+			dst.SetBytes(append([]byte(nil), v.Value...))
+		default:
+			return decodeMismatch(path, value, dst)
+		}
+
+	case *OptionValueEnum:
+		if dst.Kind() == reflect.String {
+			dst.SetString(v.Value.Name())
+			return nil
+		}
+
+		number := v.Value.Value()
+		return decodeOptionInteger(path, value, int64(number), number < 0, uint64(number), dst)
+
+	case *OptionValueArray:
+		if dst.Kind() == reflect.Map {
+			return r.decodeOptionMap(v, path, dst)
+		}
+		if dst.Kind() != reflect.Slice {
+			return decodeMismatch(path, value, dst)
+		}
+
+		res := reflect.MakeSlice(dst.Type(), len(v.Value), len(v.Value))
+		for i, item := range v.Value {
+			if err := r.decodeOptionValueTo(item, path+"["+strconv.Itoa(i)+"]", res.Index(i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(res)
+
+	case *OptionValueMap:
+		if dst.Kind() != reflect.Struct {
+			return decodeMismatch(path, value, dst)
+		}
+
+		for _, item := range v.Value {
+			field, ok := structFieldByProtoName(dst, item.Key)
+			if !ok {
+				continue
+			}
+
+			if err := r.decodeOptionValueTo(item.Value, path+"."+item.Key, field); err != nil {
+				return err
+			}
+		}
+
+	case *OptionValueAny:
+		return r.decodeOptionValueTo(v.Value, path, dst)
+
+	default:
+		return errors.Newf("%s: unsupported option value %T", decodePath(path), value)
+	}
+
+	return nil
+}
+
+// decodeOptionMap decodes map field value, which is an array of entries with key and value fields.
+func (r *Registry) decodeOptionMap(value *OptionValueArray, path string, dst reflect.Value) error {
+	res := reflect.MakeMapWithSize(dst.Type(), len(value.Value))
+	for i, item := range value.Value {
+		entry, ok := item.(*OptionValueMap)
+		if !ok {
+			return decodeMismatch(path, value, dst)
+		}
+
+		itemPath := path + "[" + strconv.Itoa(i) + "]"
+		key := reflect.New(dst.Type().Key()).Elem()
+		val := reflect.New(dst.Type().Elem()).Elem()
+		for _, field := range entry.Value {
+			var err error
+			switch field.Key {
+			case "key":
+				err = r.decodeOptionValueTo(field.Value, itemPath+".key", key)
+			case "value":
+				err = r.decodeOptionValueTo(field.Value, itemPath+".value", val)
+			default:
+				return decodeMismatch(path, value, dst)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		res.SetMapIndex(key, val)
+	}
+	dst.Set(res)
+
+	return nil
+}
+
+func decodeOptionInteger(path string, value OptionValueVariant, v int64, negative bool, u uint64, dst reflect.Value) error {
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !negative && u > 1<<63-1 || dst.OverflowInt(v) {
+			return errors.Newf("%s: value %s overflows %s", decodePath(path), value, dst.Type())
+		}
+		dst.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if negative || dst.OverflowUint(u) {
+			return errors.Newf("%s: value %s overflows %s", decodePath(path), value, dst.Type())
+		}
+		dst.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		if negative {
+			dst.SetFloat(float64(v))
+		} else {
+			dst.SetFloat(float64(u))
+		}
+	default:
+		return decodeMismatch(path, value, dst)
+	}
+
+	return nil
+}
+
+// structFieldByProtoName looks for a struct field matching the proto field name.
+func structFieldByProtoName(dst reflect.Value, name string) (reflect.Value, bool) {
+	typ := dst.Type()
+	normalized := strings.ReplaceAll(name, "_", "")
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag, hasTag := field.Tag.Lookup("proto")
+		tag, _, _ = strings.Cut(tag, ",")
+		switch {
+		case tag == "-":
+			continue
+		case hasTag && tag != "":
+			if tag == name {
+				return dst.Field(i), true
+			}
+		case strings.EqualFold(field.Name, normalized):
+			return dst.Field(i), true
+		}
+	}
+
+	return reflect.Value{}, false
+}
+
+func decodeMismatch(path string, value OptionValueVariant, dst reflect.Value) error {
+	return errors.Newf("%s: cannot decode %s into %s", decodePath(path), optionValueKind(value), dst.Type())
+}
+
+func decodePath(path string) string {
+	if path == "" {
+		return "option value"
+	}
+
+	return strings.TrimPrefix(path, ".")
+}
+
+func optionValueKind(value OptionValueVariant) string {
+	switch value.(type) {
+	case *OptionValueBool:
+		return "bool"
+	case *OptionValueInt:
+		return "integer"
+	case *OptionValueUint:
+		return "unsigned integer"
+	case *OptionValueFloat:
+		return "float"
+	case *OptionValueString:
+		return "string"
+	case *OptionValueBytes:
+		return "bytes"
+	case *OptionValueEnum:
+		return "enum"
+	case *OptionValueArray:
+		return "array"
+	case *OptionValueMap:
+		return "message"
+	case *OptionValueAny:
+		return "any"
+	default:
+		return "value"
+	}
+}
+
+func isByteSlice(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -11,133 +12,240 @@ import (
 	"github.com/sirkon/protoast/v2/internal/errors"
 )
 
-func buildFromLiteral(r *Registry, option *proto.Option, field *proto.NormalField, literal *proto.Literal, ignoreRepeat bool) OptionValueVariant {
-	if field.Repeated && !ignoreRepeat {
-		var res []OptionValueVariant
-		for _, l := range literal.Array {
-			res = append(res, buildFromLiteral(r, nil, field, l, true))
-		}
-		return &OptionValueArray{
-			isOptionValueVariant: isOptionValueVariant{
-				option: option,
-			},
-			Value: res,
-		}
+// buildFromLiteral decodes literal as a value of the given type using protobuf text format rules.
+func buildFromLiteral(r *Registry, option *proto.Option, typ Type, literal *proto.Literal) (OptionValueVariant, error) {
+	base := isOptionValueVariant{
+		option:   option,
+		registry: r,
+		typ:      typ,
 	}
 
-	switch field.Type {
-	case "bool":
-		val, err := strconv.ParseBool(literal.Source)
-		if err != nil {
-			panic(errors.Wrap(err, "convert literal to bool"))
+	switch t := typ.(type) {
+	case *Repeated:
+		items := literal.Array
+		if items == nil {
+			items = []*proto.Literal{literal}
 		}
-		return &OptionValueBool{
-			isOptionValueVariant: isOptionValueVariant{
-				option: option,
-			},
-			proto: literal,
-			Value: val,
-		}
-	case "int32", "sint32", "sfixed32", "int64", "sint64", "sfixed64":
-		val, err := strconv.Atoi(literal.Source)
-		if err != nil {
-			panic(errors.Wrap(err, "convert literal to int"))
+
+		res := &OptionValueArray{
+			isOptionValueVariant: base,
+			proto:                literal,
 		}
-		return &OptionValueInt{
-			isOptionValueVariant: isOptionValueVariant{
-				option: option,
-			},
-			proto: literal,
-			Value: val,
+		for _, item := range items {
+			v, err := buildFromLiteral(r, option, t.Type, item)
+			if err != nil {
+				return nil, err
+			}
+			res.Value = append(res.Value, v)
 		}
-	case "uin32", "fixed32", "uin64", "fixed64":
-		val, err := strconv.ParseUint(literal.Source, 10, 64)
+		return res, nil
+
+	case *Map:
+		res, err := buildFromLiteral(r, option, &Repeated{Type: t.Entry(r)}, literal)
 		if err != nil {
-			panic(errors.Wrap(err, "convert literal to uint"))
-		}
-		return &OptionValueUint{
-			isOptionValueVariant: isOptionValueVariant{
-				option: option,
-			},
-			proto: literal,
-			Value: uint(val),
+			return nil, err
 		}
-	case "float", "double":
-		val, err := strconv.ParseFloat(literal.Source, 64)
-		if err != nil {
-			panic(errors.Wrap(err, "convert literal to float"))
+		res.isOptionValueVariantType().typ = t
+		return res, nil
+
+	case *Message:
+		if literal.OrderedMap == nil && (literal.IsString || literal.Source != "" || literal.Array != nil) {
+			return nil, literalError(option, literal, errors.Newf("message literal expected for %s", r.TypeName(t)))
 		}
-		return &OptionValueFloat{
-			isOptionValueVariant: isOptionValueVariant{
-				option: option,
-			},
-			proto: literal,
-			Value: val,
+
+		if r.TypeIsGoogleProtobufAny(t) {
+			if res, ok, err := buildAnyFromLiteral(r, option, base, literal); ok {
+				return res, err
+			}
 		}
-	case "string":
-		return &OptionValueString{
-			isOptionValueVariant: isOptionValueVariant{
-				option: option,
-			},
-			proto: literal,
-			Value: literal.Source,
+
+		res := &OptionValueMap{
+			isOptionValueVariant: base,
+			proto:                literal,
 		}
-	case "bytes":
-		return &OptionValueBytes{
-			isOptionValueVariant: isOptionValueVariant{
-				option: option,
-			},
-			proto: literal,
-			Value: []byte(literal.Source),
+		repeated := map[string]*OptionValueArray{}
+		singular := map[string]*proto.Literal{}
+		for _, item := range literal.OrderedMap {
+			fieldType := messageLiteralFieldType(r, t, item.Name)
+			if fieldType == nil {
+				name := item.Name
+				if url, ok := r.typeURLs[r.protoFileOf(option)][name]; ok {
+					name = "[" + url + "]"
+				}
+				return nil, literalError(option, item.Literal, errors.Newf("unknown message %s field %s", r.TypeName(t), name))
+			}
+
+			v, err := buildFromLiteral(r, option, fieldType, item.Literal)
+			if err != nil {
+				return nil, err
+			}
+
+			// Repeated fields can be set multiple times, their values are concatenated then.
+			if arr, ok := v.(*OptionValueArray); ok {
+				if prev, ok := repeated[item.Name]; ok {
+					prev.Value = append(prev.Value, arr.Value...)
+					continue
+				}
+				repeated[item.Name] = arr
+			} else {
+				if prev, ok := singular[item.Name]; ok {
+					return nil, literalError(option, item.Literal, errors.Newf(
+						"non-repeated field %s already set at %s",
+						item.Name,
+						literalPosition(option, prev),
+					))
+				}
+				singular[item.Name] = item.Literal
+			}
+
+			res.Value = append(res.Value, OptionValueMapItem{
+				isOptionValueVariant: base,
+				proto:                item.Literal,
+				Key:                  item.Name,
+				Value:                v,
+			})
 		}
+		return res, nil
 	}
 
-	switch t := r.getTypeByName(field, field.Type).(type) {
-	case *Enum:
-		val := t.Value(r, literal.Source)
-		if val == nil {
-			panic(errors.Newf("unknown enum %s value %s", field.Type, literal.Source))
-		}
-		return &OptionValueEnum{
-			isOptionValueVariant: isOptionValueVariant{
-				option: option,
-			},
-			proto: literal,
-			Value: val,
-		}
-	case *Message:
-		var res []OptionValueMapItem
-		for _, lit := range literal.OrderedMap {
-			f := t.Field(r, lit.Name)
-			if f == nil {
-				panic(errors.Newf("unknown message %s field %s", t.Name(), lit.Name))
+	val, err := decodeScalarLiteral(r, typ, literal)
+	if err != nil {
+		return nil, literalError(option, literal, err)
+	}
+
+	switch v := val.(type) {
+	case bool:
+		return &OptionValueBool{isOptionValueVariant: base, proto: literal, Value: v}, nil
+	case int:
+		return &OptionValueInt{isOptionValueVariant: base, proto: literal, Value: v}, nil
+	case uint:
+		return &OptionValueUint{isOptionValueVariant: base, proto: literal, Value: v}, nil
+	case float64:
+		return &OptionValueFloat{isOptionValueVariant: base, proto: literal, Value: v}, nil
+	case string:
+		return &OptionValueString{isOptionValueVariant: base, proto: literal, Value: v}, nil
+	case []byte:
+		return &OptionValueBytes{isOptionValueVariant: base, proto: literal, Value: v}, nil
+	case *EnumValue:
+		return &OptionValueEnum{isOptionValueVariant: base, proto: literal, Value: v}, nil
+	default:
+		panic(errors.Newf("unexpected scalar value type %T", val))
+	}
+}
+
+// buildAnyFromLiteral decodes Any expansion like [type.googleapis.com/pkg.Msg] { ... }.
+// It reports false if the literal is not an expansion.
+func buildAnyFromLiteral(
+	r *Registry,
+	option *proto.Option,
+	base isOptionValueVariant,
+	literal *proto.Literal,
+) (OptionValueVariant, bool, error) {
+	if len(literal.OrderedMap) != 1 {
+		return nil, false, nil
+	}
+
+	item := literal.OrderedMap[0]
+	url, ok := r.typeURLs[r.protoFileOf(option)][item.Name]
+	if !ok {
+		return nil, false, nil
+	}
+
+	name := url[strings.LastIndexByte(url, '/')+1:]
+	msg, ok := r.registry["."+name].(*proto.Message)
+	if !ok || msg.IsExtend {
+		return nil, true, literalError(option, item.Literal, errors.Newf("unknown message %s of type URL %s", name, url))
+	}
+
+	typ := r.wrap(msg).(*Message)
+	v, err := buildFromLiteral(r, option, typ, item.Literal)
+	if err != nil {
+		return nil, true, err
+	}
+
+	res := &OptionValueAny{
+		isOptionValueVariant: base,
+		proto:                literal,
+		TypeURL:              url,
+		Type:                 typ,
+		Value:                v,
+	}
+	return res, true, nil
+}
+
+// messageLiteralFieldType looks for a type of a field set in message literal.
+func messageLiteralFieldType(r *Registry, msg *Message, name string) Type {
+	_, typ := messageLiteralField(r, msg, name)
+	return typ
+}
+
+// messageLiteralField looks for a field set in message literal and its type. These can be
+// normal and map fields (*MessageField), oneof branches (*OneOfBranch) and extensions of the
+// message (*MessageField).
+func messageLiteralField(r *Registry, msg *Message, name string) (Node, Type) {
+	for field := range msg.Fields(r) {
+		oneof, ok := field.Type(r).(*OneOf)
+		if !ok {
+			if field.Name() == name {
+				return field, field.Type(r)
 			}
-			rr := buildFromLiteral(r, nil, f.proto.(*proto.NormalField), lit.Literal, false)
-			res = append(res, OptionValueMapItem{
-				Key:   lit.Name,
-				Value: rr,
-			})
+			continue
 		}
-		return &OptionValueMap{
-			isOptionValueVariant: isOptionValueVariant{
-				option: option,
-			},
-			proto: literal,
-			Value: res,
+
+		if branch := oneof.Branch(r, name); branch != nil {
+			return branch, branch.Type(r)
 		}
-	default:
-		panic(errors.Newf("unknown field type: %s", field.Type))
 	}
+
+	fullName, ok := r.resolveNameRaw(r.scopes[msg.proto], name)
+	if !ok {
+		return nil, nil
+	}
+	ext, ok := r.registry[fullName].(*proto.NormalField)
+	if !ok {
+		return nil, nil
+	}
+	if extendee, ok := r.extendee(ext); !ok || extendee != r.scopes[msg.proto] {
+		return nil, nil
+	}
+
+	field := r.wrap(ext).(*MessageField)
+	return field, field.Type(r)
+}
+
+// literalPosition returns the literal position. Nested aggregate literals do not have
+// a position, option position is used for them.
+func literalPosition(option *proto.Option, literal *proto.Literal) scanner.Position {
+	if literal.Position.Line == 0 && option != nil {
+		return option.Position
+	}
+
+	return literal.Position
+}
+
+// literalError annotates error with the literal position.
+func literalError(option *proto.Option, literal *proto.Literal, err error) error {
+	return errors.Wrap(err, literalPosition(option, literal).String())
 }
 
 type OptionValueVariant interface {
 	Positionable
 	fmt.Stringer
+	json.Marshaler
+
+	// Interface converts the value into plain Go values: messages become map[string]any
+	// keyed by field names, repeated fields become []any, map fields become map[string]any
+	// keyed by string representation of keys, enums become their value names and scalars
+	// are bool, int, uint, float64, string and []byte.
+	Interface() any
+
 	isOptionValueVariantType() *isOptionValueVariant
 }
 
 type isOptionValueVariant struct {
-	option *proto.Option
+	option   *proto.Option
+	registry *Registry
+	typ      Type
 }
 
 func (v *isOptionValueVariant) nodeProto() proto.Visitee { return v.option }
@@ -209,6 +317,16 @@ type OptionValueMap struct {
 	Value []OptionValueMapItem
 }
 
+// OptionValueAny is google.protobuf.Any set with expansion like [type.googleapis.com/pkg.Msg] { ... }.
+type OptionValueAny struct {
+	isOptionValueVariant
+	proto *proto.Literal
+
+	TypeURL string
+	Type    *Message
+	Value   OptionValueVariant
+}
+
 type OptionValueMapItem struct {
 	isOptionValueVariant
 	proto *proto.Literal
@@ -276,6 +394,10 @@ func (o *OptionValueMap) String() string {
 	return res.String()
 }
 
+func (o *OptionValueAny) String() string {
+	return "{[" + o.TypeURL + "]: " + o.Value.String() + "}"
+}
+
 var (
 	_ Positionable = new(OptionValueBool)
 	_ Positionable = new(OptionValueInt)
@@ -286,4 +408,5 @@ var (
 	_ Positionable = new(OptionValueEnum)
 	_ Positionable = new(OptionValueArray)
 	_ Positionable = new(OptionValueMap)
+	_ Positionable = new(OptionValueAny)
 )
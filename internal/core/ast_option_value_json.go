@@ -0,0 +1,306 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/emicklei/proto"
+)
+
+func (o *OptionValueBool) Interface() any   { return o.Value }
+func (o *OptionValueInt) Interface() any    { return o.Value }
+func (o *OptionValueUint) Interface() any   { return o.Value }
+func (o *OptionValueFloat) Interface() any  { return o.Value }
+func (o *OptionValueString) Interface() any { return o.Value }
+func (o *OptionValueBytes) Interface() any  { return o.Value }
+func (o *OptionValueEnum) Interface() any   { return o.Value.Name() }
+
+func (o *OptionValueArray) Interface() any {
+	if t, ok := o.typ.(*Map); ok {
+		keys, values := o.mapEntries(t)
+		res := make(map[string]any, len(keys))
+		for _, key := range keys {
+			res[key] = values[key].Interface()
+		}
+		return res
+	}
+
+	res := make([]any, 0, len(o.Value))
+	for _, item := range o.Value {
+		res = append(res, item.Interface())
+	}
+	return res
+}
+
+func (o *OptionValueMap) Interface() any {
+	res := make(map[string]any, len(o.Value))
+	for _, item := range o.Value {
+		res[item.Key] = item.Value.Interface()
+	}
+	return res
+}
+
+// Interface represents Any the way protojson does: fields of the value are accompanied
+// with "@type" one, values of other kinds are put into "value" field.
+func (o *OptionValueAny) Interface() any {
+	v := o.Value.Interface()
+	res, ok := v.(map[string]any)
+	if !ok {
+		res = map[string]any{"value": v}
+	}
+	res["@type"] = o.TypeURL
+	return res
+}
+
+func (o *OptionValueBool) MarshalJSON() ([]byte, error) {
+	return strconv.AppendBool(nil, o.Value), nil
+}
+
+// MarshalJSON follows protojson rules: 64-bit integers are strings.
+func (o *OptionValueInt) MarshalJSON() ([]byte, error) {
+	return jsonInteger(o.typ, strconv.Itoa(o.Value)), nil
+}
+
+// MarshalJSON follows protojson rules: 64-bit integers are strings.
+func (o *OptionValueUint) MarshalJSON() ([]byte, error) {
+	return jsonInteger(o.typ, strconv.FormatUint(uint64(o.Value), 10)), nil
+}
+
+// MarshalJSON follows protojson rules: non-finite values are "NaN", "Infinity" and "-Infinity" strings.
+func (o *OptionValueFloat) MarshalJSON() ([]byte, error) {
+	switch {
+	case math.IsNaN(o.Value):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(o.Value, 1):
+		return []byte(`"Infinity"`), nil
+	case math.IsInf(o.Value, -1):
+		return []byte(`"-Infinity"`), nil
+	}
+
+	if _, ok := o.typ.(*Float); ok {
+		return json.Marshal(float32(o.Value))
+	}
+	return json.Marshal(o.Value)
+}
+
+func (o *OptionValueString) MarshalJSON() ([]byte, error) {
+	return jsonString(o.Value)
+}
+
+// MarshalJSON follows protojson rules: bytes are base64 encoded.
+func (o *OptionValueBytes) MarshalJSON() ([]byte, error) {
+	return jsonString(base64.StdEncoding.EncodeToString(o.Value))
+}
+
+// MarshalJSON follows protojson rules: enums are represented with value names.
+func (o *OptionValueEnum) MarshalJSON() ([]byte, error) {
+	return jsonString(o.Value.Name())
+}
+
+// MarshalJSON follows protojson rules: map fields are objects.
+func (o *OptionValueArray) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if t, ok := o.typ.(*Map); ok {
+		keys, values := o.mapEntries(t)
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if err := writeJSONItem(&buf, i, key, values[key]); err != nil {
+				return nil, err
+			}
+		}
+		buf.WriteByte('}')
+		return buf.Bytes(), nil
+	}
+
+	buf.WriteByte('[')
+	for i, item := range o.Value {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		data, err := item.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	buf.WriteByte(']')
+
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON follows protojson rules: fields are keyed with their JSON names and
+// extensions with their full names in brackets. The last of values with the same key wins.
+func (o *OptionValueMap) MarshalJSON() ([]byte, error) {
+	var keys []string
+	values := make(map[string]OptionValueVariant, len(o.Value))
+	for _, item := range o.Value {
+		key := o.jsonKey(item.Key)
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = item.Value
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if err := writeJSONItem(&buf, i, key, values[key]); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON follows protojson rules: the type URL is put into "@type" field followed by value fields.
+func (o *OptionValueAny) MarshalJSON() ([]byte, error) {
+	data, err := o.Value.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := jsonString(o.TypeURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"@type":`)
+	buf.Write(url)
+	switch {
+	case bytes.Equal(data, []byte("{}")):
+	case bytes.HasPrefix(data, []byte("{")):
+		buf.WriteByte(',')
+		buf.Write(data[1 : len(data)-1])
+	default:
+		buf.WriteString(`,"value":`)
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func (o *OptionValueMap) jsonKey(name string) string {
+	msg, ok := o.typ.(*Message)
+	if !ok || o.registry == nil {
+		return name
+	}
+
+	switch field, _ := messageLiteralField(o.registry, msg, name); f := field.(type) {
+	case *OneOfBranch:
+		return f.JSONName()
+	case *MessageField:
+		if v, ok := f.proto.(*proto.NormalField); ok {
+			if parent, ok := v.Parent.(*proto.Message); ok && parent.IsExtend {
+				return "[" + strings.TrimPrefix(o.registry.NodeIndex(f), ".") + "]"
+			}
+		}
+		return f.JSONName()
+	default:
+		return name
+	}
+}
+
+func writeJSONItem(buf *bytes.Buffer, i int, key string, value OptionValueVariant) error {
+	if i > 0 {
+		buf.WriteByte(',')
+	}
+
+	data, err := jsonString(key)
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	buf.WriteByte(':')
+
+	data, err = value.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+
+	return nil
+}
+
+// mapEntries returns keys of map entries in the order they are first met and values by keys.
+// Omitted keys and values are defaults of their types and the last entry of the same key wins,
+// like protoc and protojson do.
+func (o *OptionValueArray) mapEntries(typ *Map) ([]string, map[string]OptionValueVariant) {
+	var keys []string
+	values := make(map[string]OptionValueVariant, len(o.Value))
+	for _, entry := range o.Value {
+		base := *entry.isOptionValueVariantType()
+		key := optionZeroValue(o.registry, base, typ.Key())
+		value := optionZeroValue(o.registry, base, typ.Value(o.registry))
+		if v, ok := entry.(*OptionValueMap); ok {
+			for _, item := range v.Value {
+				switch item.Key {
+				case "key":
+					key = item.Value
+				case "value":
+					value = item.Value
+				}
+			}
+		}
+
+		if _, ok := values[key.String()]; !ok {
+			keys = append(keys, key.String())
+		}
+		values[key.String()] = value
+	}
+
+	return keys, values
+}
+
+// optionZeroValue returns the default value of the type, the one an omitted field has.
+func optionZeroValue(r *Registry, base isOptionValueVariant, typ Type) OptionValueVariant {
+	base.typ = typ
+	literal := &proto.Literal{}
+	switch t := typ.(type) {
+	case *Bool:
+		return &OptionValueBool{isOptionValueVariant: base, proto: literal}
+	case *Int32, *Int64, *Sint32, *Sint64, *Sfixed32, *Sfixed64:
+		return &OptionValueInt{isOptionValueVariant: base, proto: literal}
+	case *Uint32, *Uint64, *Fixed32, *Fixed64:
+		return &OptionValueUint{isOptionValueVariant: base, proto: literal}
+	case *Float, *Double:
+		return &OptionValueFloat{isOptionValueVariant: base, proto: literal}
+	case *String:
+		return &OptionValueString{isOptionValueVariant: base, proto: literal}
+	case *Bytes:
+		return &OptionValueBytes{isOptionValueVariant: base, proto: literal}
+	case *Enum:
+		for value := range t.Values(r) {
+			return &OptionValueEnum{isOptionValueVariant: base, proto: literal, Value: value}
+		}
+	}
+
+	return &OptionValueMap{isOptionValueVariant: base, proto: literal}
+}
+
+func jsonInteger(typ Type, digits string) []byte {
+	switch typ.(type) {
+	case *Int64, *Sint64, *Sfixed64, *Uint64, *Fixed64:
+		return []byte(`"` + digits + `"`)
+	default:
+		return []byte(digits)
+	}
+}
+
+func jsonString(s string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
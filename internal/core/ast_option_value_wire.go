@@ -0,0 +1,150 @@
+package core
+
+import (
+	"slices"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+	"github.com/sirkon/protoast/v2/internal/wire"
+)
+
+// appendOptionValue appends option value as a field with the given number and type.
+// The field node tells if repeated values are to be packed.
+func (r *Registry) appendOptionValue(b []byte, num int, field Node, typ Type, value OptionValueVariant) ([]byte, error) {
+	switch t := typ.(type) {
+	case *Repeated:
+		arr, ok := value.(*OptionValueArray)
+		if !ok {
+			return nil, errors.Newf("array expected for repeated field %d, got %s", num, optionValueKind(value))
+		}
+
+		if !isPackable(t.Type) || !r.isPacked(field) {
+			for _, item := range arr.Value {
+				var err error
+				if b, err = r.appendOptionValue(b, num, field, t.Type, item); err != nil {
+					return nil, err
+				}
+			}
+			return b, nil
+		}
+
+		var packed []byte
+		for _, item := range arr.Value {
+			var err error
+			if packed, err = appendScalarValue(packed, t.Type, optionScalar(item)); err != nil {
+				return nil, errors.Wrapf(err, "encode field %d", num)
+			}
+		}
+		b = wire.AppendTag(b, num, wire.BytesType)
+		return wire.AppendBytes(b, packed), nil
+
+	case *Map:
+		return r.appendOptionValue(b, num, field, &Repeated{Type: t.Entry(r)}, value)
+
+	case *Message:
+		body, err := r.encodeOptionMessage(t, value)
+		if err != nil {
+			return nil, err
+		}
+		b = wire.AppendTag(b, num, wire.BytesType)
+		return wire.AppendBytes(b, body), nil
+
+	default:
+		res, err := appendScalar(b, num, typ, optionScalar(value))
+		if err != nil {
+			return nil, errors.Wrapf(err, "encode field %d", num)
+		}
+		return res, nil
+	}
+}
+
+// encodeOptionMessage encodes message value with fields ordered by their numbers.
+func (r *Registry) encodeOptionMessage(msg *Message, value OptionValueVariant) ([]byte, error) {
+	switch v := value.(type) {
+	case *OptionValueAny:
+		body, err := r.encodeOptionMessage(v.Type, v.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		b := wire.AppendTag(nil, 1, wire.BytesType)
+		b = wire.AppendString(b, v.TypeURL)
+		b = wire.AppendTag(b, 2, wire.BytesType)
+		return wire.AppendBytes(b, body), nil
+
+	case *OptionValueMap:
+		type item struct {
+			num   int
+			field Node
+			typ   Type
+			value OptionValueVariant
+		}
+
+		items := make([]item, 0, len(v.Value))
+		for _, it := range v.Value {
+			field, typ := messageLiteralField(r, msg, it.Key)
+			if field == nil {
+				return nil, errors.Newf("unknown message %s field %s", r.TypeName(msg), it.Key)
+			}
+
+			items = append(items, item{
+				num:   fieldNumber(field),
+				field: field,
+				typ:   typ,
+				value: it.Value,
+			})
+		}
+		slices.SortStableFunc(items, func(a, b item) int {
+			return a.num - b.num
+		})
+
+		var b []byte
+		for _, it := range items {
+			var err error
+			if b, err = r.appendOptionValue(b, it.num, it.field, it.typ, it.value); err != nil {
+				return nil, errors.Wrapf(err, "encode %s", r.TypeName(msg))
+			}
+		}
+		return b, nil
+
+	default:
+		return nil, errors.Newf("message value expected for %s, got %s", r.TypeName(msg), optionValueKind(value))
+	}
+}
+
+// isPacked checks if repeated values of the field are packed.
+func (r *Registry) isPacked(field Node) bool {
+	return r.Features(field).RepeatedFieldEncoding == RepeatedFieldEncodingPacked
+}
+
+// optionScalar returns a scalar value the way decodeScalarLiteral does.
+func optionScalar(value OptionValueVariant) any {
+	switch v := value.(type) {
+	case *OptionValueBool:
+		return v.Value
+	case *OptionValueInt:
+		return v.Value
+	case *OptionValueUint:
+		return v.Value
+	case *OptionValueFloat:
+		return v.Value
+	case *OptionValueString:
+		return v.Value
+	case *OptionValueBytes:
+		return v.Value
+	case *OptionValueEnum:
+		return v.Value
+	default:
+		return value
+	}
+}
+
+func fieldNumber(field Node) int {
+	switch f := field.(type) {
+	case *MessageField:
+		return f.Value()
+	case *OneOfBranch:
+		return f.Value()
+	default:
+		panic(errors.Newf("unexpected field node %T", field))
+	}
+}
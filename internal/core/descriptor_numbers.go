@@ -0,0 +1,148 @@
+package core
+
+// Field numbers of google/protobuf/descriptor.proto messages.
+
+const (
+	descFileSetFile = 1
+)
+
+const (
+	descFileName             = 1
+	descFilePackage          = 2
+	descFileDependency       = 3
+	descFileMessageType      = 4
+	descFileEnumType         = 5
+	descFileService          = 6
+	descFileExtension        = 7
+	descFileOptions          = 8
+	descFileSourceCodeInfo   = 9
+	descFilePublicDependency = 10
+	descFileWeakDependency   = 11
+	descFileSyntax           = 12
+	descFileEdition          = 14
+)
+
+const (
+	descMessageName           = 1
+	descMessageField          = 2
+	descMessageNestedType     = 3
+	descMessageEnumType       = 4
+	descMessageExtensionRange = 5
+	descMessageExtension      = 6
+	descMessageOptions        = 7
+	descMessageOneofDecl      = 8
+	descMessageReservedRange  = 9
+	descMessageReservedName   = 10
+)
+
+// MessageOptions.map_entry.
+const descMessageOptionsMapEntry = 7
+
+const (
+	descRangeStart   = 1
+	descRangeEnd     = 2
+	descRangeOptions = 3
+)
+
+const (
+	descFieldName           = 1
+	descFieldExtendee       = 2
+	descFieldNumber         = 3
+	descFieldLabel          = 4
+	descFieldType           = 5
+	descFieldTypeName       = 6
+	descFieldDefaultValue   = 7
+	descFieldOptions        = 8
+	descFieldOneofIndex     = 9
+	descFieldJSONName       = 10
+	descFieldProto3Optional = 17
+)
+
+const (
+	descOneofName    = 1
+	descOneofOptions = 2
+)
+
+const (
+	descEnumName          = 1
+	descEnumValue         = 2
+	descEnumOptions       = 3
+	descEnumReservedRange = 4
+	descEnumReservedName  = 5
+)
+
+const (
+	descEnumValueName    = 1
+	descEnumValueNumber  = 2
+	descEnumValueOptions = 3
+)
+
+const (
+	descServiceName    = 1
+	descServiceMethod  = 2
+	descServiceOptions = 3
+)
+
+const (
+	descMethodName            = 1
+	descMethodInputType       = 2
+	descMethodOutputType      = 3
+	descMethodOptions         = 4
+	descMethodClientStreaming = 5
+	descMethodServerStreaming = 6
+)
+
+const (
+	descSourceCodeInfoLocation = 1
+)
+
+const (
+	descLocationPath                    = 1
+	descLocationSpan                    = 2
+	descLocationLeadingComments         = 3
+	descLocationTrailingComments        = 4
+	descLocationLeadingDetachedComments = 6
+)
+
+// FieldDescriptorProto.Label values.
+const (
+	descLabelOptional = 1
+	descLabelRequired = 2
+	descLabelRepeated = 3
+)
+
+// FieldDescriptorProto.Type values.
+const (
+	descTypeDouble   = 1
+	descTypeFloat    = 2
+	descTypeInt64    = 3
+	descTypeUint64   = 4
+	descTypeInt32    = 5
+	descTypeFixed64  = 6
+	descTypeFixed32  = 7
+	descTypeBool     = 8
+	descTypeString   = 9
+	descTypeGroup    = 10
+	descTypeMessage  = 11
+	descTypeBytes    = 12
+	descTypeUint32   = 13
+	descTypeEnum     = 14
+	descTypeSfixed32 = 15
+	descTypeSfixed64 = 16
+	descTypeSint32   = 17
+	descTypeSint64   = 18
+)
+
+// Edition values.
+const (
+	descEditionProto2 = 998
+	descEditionProto3 = 999
+	descEdition2023   = 1000
+	descEdition2024   = 1001
+)
+
+// descMaxMessageNumber is an exclusive end of max ranges of fields and extensions.
+const descMaxMessageNumber = 1 << 29
+
+// descMaxEnumNumber is an inclusive end of max ranges of enum values.
+const descMaxEnumNumber = 1<<31 - 1
@@ -0,0 +1,273 @@
+package core
+
+import (
+	"slices"
+
+	"github.com/emicklei/proto"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+)
+
+// DynamicMessage is a message value built with the registry schema instead of a generated code.
+//
+// Values of fields are
+//   - int32, int64, uint32, uint64, float32, float64, bool, string and []byte for scalars
+//     of the matching types: sint32, sfixed32 are int32, fixed64 is uint64, etc.
+//   - *EnumValue for enums. Values of open enums that are not defined are int32.
+//   - *DynamicMessage for messages.
+//   - []any of the above for repeated fields.
+//   - []DynamicMapEntry for maps.
+type DynamicMessage struct {
+	Type *Message
+
+	// Fields are set fields in the order they were met.
+	Fields []*DynamicField
+
+	// Unknown are fields the schema has no definition for, in the order they were met.
+	Unknown []*DynamicUnknownField
+}
+
+// DynamicField is a value of a message field.
+type DynamicField struct {
+	// Field is either *MessageField or *OneOfBranch.
+	Field FieldNode
+	Value any
+}
+
+// DynamicMapEntry is an entry of map field value. A key is one of scalar values.
+type DynamicMapEntry struct {
+	Key   any
+	Value any
+}
+
+// DynamicUnknownField is a field of unknown number or a field having unexpected wire type.
+type DynamicUnknownField struct {
+	Number   int
+	WireType int
+
+	// Value is the field value encoded with the wire type: varint, fixed bytes, length prefixed
+	// contents without the prefix or group contents without the end tag.
+	Value []byte
+}
+
+// Name returns the field name.
+func (f *DynamicField) Name() string {
+	return fieldNodeName(f.Field)
+}
+
+// Number returns the field number.
+func (f *DynamicField) Number() int {
+	return fieldNumber(f.Field)
+}
+
+// Get returns a set field or oneof branch with the given name. Nil is returned if it is not set.
+func (m *DynamicMessage) Get(name string) *DynamicField {
+	for _, field := range m.Fields {
+		if field.Name() == name {
+			return field
+		}
+	}
+
+	return nil
+}
+
+// WhichOneOf returns a set branch of the oneof with the given name. Nil is returned if none is set.
+func (m *DynamicMessage) WhichOneOf(name string) *DynamicField {
+	for _, field := range m.Fields {
+		branch, ok := field.Field.(*OneOfBranch)
+		if !ok {
+			continue
+		}
+
+		if oneof, ok := branch.proto.Parent.(*proto.Oneof); ok && oneof.Name == name {
+			return field
+		}
+	}
+
+	return nil
+}
+
+// set sets the field value replacing the previous one. Other branches of the same oneof are cleared.
+func (m *DynamicMessage) set(field *dynamicField, value any) {
+	if prev := m.lookup(field); prev != nil {
+		prev.Value = value
+		return
+	}
+
+	if field.oneof != nil {
+		m.Fields = slices.DeleteFunc(m.Fields, func(f *DynamicField) bool {
+			return dynamicOneOf(f.Field) == field.oneof
+		})
+	}
+	m.Fields = append(m.Fields, &DynamicField{
+		Field: field.node,
+		Value: value,
+	})
+}
+
+// lookup returns the field value or nil if it is not set.
+func (m *DynamicMessage) lookup(field *dynamicField) *DynamicField {
+	for _, f := range m.Fields {
+		if f.Field == field.node {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// dynamicField is a field of a message with the schema information dynamic values need.
+type dynamicField struct {
+	node FieldNode
+	name string
+	json string
+	num  int
+	typ  Type
+
+	// oneof is set for oneof branches.
+	oneof *proto.Oneof
+
+	packed     bool
+	delimited  bool
+	verifyUTF8 bool
+
+	// implicit is set for fields with no presence, which are not written when they have zero values.
+	implicit bool
+}
+
+// dynamicMessage is a message schema with fields indexed.
+type dynamicMessage struct {
+	msg *Message
+
+	// fields are sorted by their numbers, declared are in the order of declaration.
+	fields   []*dynamicField
+	declared []*dynamicField
+	byNumber map[int]*dynamicField
+	byName   map[string]*dynamicField
+	byJSON   map[string]*dynamicField
+}
+
+// dynamicSchema caches message schemas for a single run of decoding, encoding, etc.
+type dynamicSchema struct {
+	r        *Registry
+	messages map[*Message]*dynamicMessage
+}
+
+func newDynamicSchema(r *Registry) *dynamicSchema {
+	return &dynamicSchema{
+		r:        r,
+		messages: map[*Message]*dynamicMessage{},
+	}
+}
+
+// message returns the schema of the message.
+func (s *dynamicSchema) message(msg *Message) *dynamicMessage {
+	if res, ok := s.messages[msg]; ok {
+		return res
+	}
+
+	res := &dynamicMessage{
+		msg:      msg,
+		byNumber: map[int]*dynamicField{},
+		byName:   map[string]*dynamicField{},
+		byJSON:   map[string]*dynamicField{},
+	}
+	add := func(field *dynamicField) {
+		res.declared = append(res.declared, field)
+		res.byNumber[field.num] = field
+		res.byName[field.name] = field
+		res.byJSON[field.json] = field
+	}
+
+	for field := range msg.Fields(s.r) {
+		oneof, ok := field.Type(s.r).(*OneOf)
+		if !ok {
+			add(s.field(field, field.Type(s.r), nil))
+			continue
+		}
+
+		for branch := range oneof.Branches(s.r) {
+			add(s.field(branch, branch.Type(s.r), oneof.proto))
+		}
+	}
+	res.fields = slices.SortedStableFunc(slices.Values(res.declared), func(a, b *dynamicField) int {
+		return a.num - b.num
+	})
+
+	s.messages[msg] = res
+	return res
+}
+
+func (s *dynamicSchema) field(node FieldNode, typ Type, oneof *proto.Oneof) *dynamicField {
+	features := s.r.Features(node)
+	res := &dynamicField{
+		node:       node,
+		name:       fieldNodeName(node),
+		num:        fieldNumber(node),
+		typ:        typ,
+		oneof:      oneof,
+		delimited:  features.MessageEncoding == MessageEncodingDelimited,
+		verifyUTF8: features.UTF8Validation == UTF8ValidationVerify,
+	}
+
+	switch f := node.(type) {
+	case *MessageField:
+		res.json = f.JSONName()
+	case *OneOfBranch:
+		res.json = f.JSONName()
+	}
+
+	switch t := typ.(type) {
+	case *Repeated:
+		res.packed = isPackable(t.Type) && features.RepeatedFieldEncoding == RepeatedFieldEncodingPacked
+	case *Map, *Message:
+	default:
+		res.implicit = oneof == nil && features.FieldPresence == FieldPresenceImplicit
+	}
+
+	return res
+}
+
+// dynamicOneOf returns oneof of the branch or nil for other fields.
+func dynamicOneOf(field FieldNode) *proto.Oneof {
+	branch, ok := field.(*OneOfBranch)
+	if !ok {
+		return nil
+	}
+
+	oneof, _ := branch.proto.Parent.(*proto.Oneof)
+	return oneof
+}
+
+// zero returns default value of the type: zero scalars, the first enum value or an empty message.
+func (s *dynamicSchema) zero(typ Type) any {
+	switch t := typ.(type) {
+	case *Int32, *Sint32, *Sfixed32:
+		return int32(0)
+	case *Int64, *Sint64, *Sfixed64:
+		return int64(0)
+	case *Uint32, *Fixed32:
+		return uint32(0)
+	case *Uint64, *Fixed64:
+		return uint64(0)
+	case *Float:
+		return float32(0)
+	case *Double:
+		return float64(0)
+	case *Bool:
+		return false
+	case *String:
+		return ""
+	case *Bytes:
+		return []byte{}
+	case *Enum:
+		for value := range t.Values(s.r) {
+			return value
+		}
+		return int32(0)
+	case *Message:
+		return &DynamicMessage{Type: t}
+	default:
+		panic(errors.Newf("unexpected field type %T", typ))
+	}
+}
@@ -0,0 +1,348 @@
+package core
+
+import (
+	"slices"
+	"unicode/utf8"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+	"github.com/sirkon/protoast/v2/internal/wire"
+)
+
+// DecodeMessage decodes wire bytes of the message into a dynamic value.
+//
+// Fields that are not in the schema and fields encoded with unexpected wire types are kept
+// in [DynamicMessage.Unknown], as well as values of closed enums that are not defined.
+// Repeated fields are accepted both packed and expanded, a message met several times is
+// merged and the last scalar value wins, like protobuf runtimes do. Messages nested deeper
+// than protobuf-go allows are rejected.
+func (r *Registry) DecodeMessage(msg *Message, data []byte) (*DynamicMessage, error) {
+	return newDynamicSchema(r).decode(msg, data)
+}
+
+func (s *dynamicSchema) decode(msg *Message, data []byte) (*DynamicMessage, error) {
+	return s.decodeNested(msg, data, wire.RecursionLimit)
+}
+
+// decodeNested decodes the message allowing the given depth of nested messages in it.
+func (s *dynamicSchema) decodeNested(msg *Message, data []byte, depth int) (*DynamicMessage, error) {
+	if depth < 0 {
+		return nil, errors.Newf("decode %s: exceeded maximum recursion depth", s.r.TypeName(msg))
+	}
+
+	fields, err := wire.Fields(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "decode %s", s.r.TypeName(msg))
+	}
+
+	res := &DynamicMessage{Type: msg}
+	schema := s.message(msg)
+	for _, f := range fields {
+		field := schema.byNumber[f.Number]
+		if field == nil {
+			res.Unknown = append(res.Unknown, dynamicUnknown(f))
+			continue
+		}
+
+		if err := s.decodeField(res, field, f, depth); err != nil {
+			return nil, errors.Wrapf(err, "decode %s field %s", s.r.TypeName(msg), field.name)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *dynamicSchema) decodeField(res *DynamicMessage, field *dynamicField, f wire.Field, depth int) error {
+	switch t := field.typ.(type) {
+	case *Repeated:
+		var values []any
+		var unknown []*DynamicUnknownField
+		switch {
+		case f.Type == wire.BytesType && isPackable(t.Type):
+			for rest := f.Value; len(rest) > 0; {
+				value, n, err := s.decodeScalar(t.Type, field, scalarWireTypeOf(t.Type), rest)
+				if err != nil {
+					return errors.Wrap(err, "decode packed value")
+				}
+
+				if value == nil {
+					unknown = append(unknown, &DynamicUnknownField{
+						Number:   f.Number,
+						WireType: int(wire.VarintType),
+						Value:    slices.Clone(rest[:n]),
+					})
+				} else {
+					values = append(values, value)
+				}
+				rest = rest[n:]
+			}
+
+		default:
+			value, ok, err := s.decodeValue(t.Type, field, f, depth)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				res.Unknown = append(res.Unknown, dynamicUnknown(f))
+				return nil
+			}
+			values = append(values, value)
+		}
+
+		res.Unknown = append(res.Unknown, unknown...)
+		if prev := res.lookup(field); prev != nil {
+			prev.Value = append(prev.Value.([]any), values...)
+			return nil
+		}
+		if len(values) > 0 {
+			res.set(field, values)
+		}
+		return nil
+
+	case *Map:
+		if f.Type != wire.BytesType {
+			res.Unknown = append(res.Unknown, dynamicUnknown(f))
+			return nil
+		}
+
+		entry, err := s.decodeNested(t.Entry(s.r), f.Value, depth-1)
+		if err != nil {
+			return err
+		}
+
+		// An entry with undefined value of a closed enum is kept unknown as a whole.
+		if _, ok := t.Value(s.r).(*Enum); ok {
+			for _, item := range entry.Unknown {
+				if item.Number == 2 && item.WireType == int(wire.VarintType) {
+					res.Unknown = append(res.Unknown, dynamicUnknown(f))
+					return nil
+				}
+			}
+		}
+
+		key := s.zero(t.Key())
+		value := s.zero(t.Value(s.r))
+		for _, item := range entry.Fields {
+			switch item.Number() {
+			case 1:
+				key = item.Value
+			case 2:
+				value = item.Value
+			}
+		}
+
+		var entries []DynamicMapEntry
+		if prev := res.lookup(field); prev != nil {
+			entries = prev.Value.([]DynamicMapEntry)
+		}
+		entries = setDynamicMapEntry(entries, key, value)
+		res.set(field, entries)
+		return nil
+
+	default:
+		value, ok, err := s.decodeValue(t, field, f, depth)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			res.Unknown = append(res.Unknown, dynamicUnknown(f))
+			return nil
+		}
+
+		if msg, ok := value.(*DynamicMessage); ok {
+			if prev := res.lookup(field); prev != nil {
+				mergeDynamicMessages(prev.Value.(*DynamicMessage), msg)
+				return nil
+			}
+		}
+		res.set(field, value)
+		return nil
+	}
+}
+
+// decodeValue decodes a single value of the type. False is returned for values that must be kept
+// as unknown fields: ones with mismatched wire type and undefined values of closed enums.
+func (s *dynamicSchema) decodeValue(typ Type, field *dynamicField, f wire.Field, depth int) (any, bool, error) {
+	if msg, ok := typ.(*Message); ok {
+		// Delimited encoding of messages is the same as groups one.
+		if f.Type != wire.BytesType && f.Type != wire.StartGroupType {
+			return nil, false, nil
+		}
+
+		value, err := s.decodeNested(msg, f.Value, depth-1)
+		if err != nil {
+			return nil, false, err
+		}
+		return value, true, nil
+	}
+
+	wt, ok := scalarWireType(typ)
+	if !ok {
+		return nil, false, errors.Newf("unexpected field type %T", typ)
+	}
+	if wt != f.Type {
+		return nil, false, nil
+	}
+
+	var raw []byte
+	switch wt {
+	case wire.BytesType:
+		raw = wire.AppendBytes(nil, f.Value)
+	default:
+		raw = f.Value
+	}
+	value, _, err := s.decodeScalar(typ, field, wt, raw)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, value != nil, nil
+}
+
+// decodeScalar decodes a scalar value encoded with the wire type returning it with the encoded length.
+// Nil value is returned for undefined values of closed enums.
+func (s *dynamicSchema) decodeScalar(typ Type, field *dynamicField, wt wire.Type, b []byte) (any, int, error) {
+	switch wt {
+	case wire.VarintType:
+		v, n, err := wire.ConsumeVarint(b)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		switch t := typ.(type) {
+		case *Int32:
+			return int32(v), n, nil
+		case *Int64:
+			return int64(v), n, nil
+		case *Uint32:
+			return uint32(v), n, nil
+		case *Uint64:
+			return v, n, nil
+		case *Sint32:
+			return int32(wire.DecodeZigZag(v)), n, nil
+		case *Sint64:
+			return wire.DecodeZigZag(v), n, nil
+		case *Bool:
+			return v != 0, n, nil
+		case *Enum:
+			if value := t.ValueByNumber(s.r, int(int32(v))); value != nil {
+				return value, n, nil
+			}
+			if !t.IsOpen(s.r) {
+				return nil, n, nil
+			}
+			return int32(v), n, nil
+		}
+
+	case wire.Fixed32Type:
+		v, n, err := wire.ConsumeFixed32(b)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		switch typ.(type) {
+		case *Fixed32:
+			return v, n, nil
+		case *Sfixed32:
+			return int32(v), n, nil
+		case *Float:
+			return wire.Float32(v), n, nil
+		}
+
+	case wire.Fixed64Type:
+		v, n, err := wire.ConsumeFixed64(b)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		switch typ.(type) {
+		case *Fixed64:
+			return v, n, nil
+		case *Sfixed64:
+			return int64(v), n, nil
+		case *Double:
+			return wire.Float64(v), n, nil
+		}
+
+	case wire.BytesType:
+		v, n, err := wire.ConsumeBytes(b)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		switch typ.(type) {
+		case *String:
+			if field.verifyUTF8 && !utf8.Valid(v) {
+				return nil, 0, errors.New("invalid UTF-8 in string value")
+			}
+			return string(v), n, nil
+		case *Bytes:
+			return slices.Clone(v), n, nil
+		}
+	}
+
+	return nil, 0, errors.Newf("cannot decode %s value with wire type %d", s.r.TypeName(typ), wt)
+}
+
+// scalarWireTypeOf returns the wire type of the scalar type known to have one.
+func scalarWireTypeOf(typ Type) wire.Type {
+	wt, _ := scalarWireType(typ)
+	return wt
+}
+
+// mergeDynamicMessages merges src into dst: repeated fields are concatenated, maps entries
+// are set, messages are merged and other values are replaced.
+func mergeDynamicMessages(dst, src *DynamicMessage) {
+	for _, field := range src.Fields {
+		prev := dst.Get(field.Name())
+		if prev == nil {
+			// A set branch of a oneof clears other ones.
+			if oneof := dynamicOneOf(field.Field); oneof != nil {
+				dst.Fields = slices.DeleteFunc(dst.Fields, func(f *DynamicField) bool {
+					return dynamicOneOf(f.Field) == oneof
+				})
+			}
+			dst.Fields = append(dst.Fields, field)
+			continue
+		}
+
+		switch v := field.Value.(type) {
+		case []any:
+			prev.Value = append(prev.Value.([]any), v...)
+		case []DynamicMapEntry:
+			entries := prev.Value.([]DynamicMapEntry)
+			for _, entry := range v {
+				entries = setDynamicMapEntry(entries, entry.Key, entry.Value)
+			}
+			prev.Value = entries
+		case *DynamicMessage:
+			mergeDynamicMessages(prev.Value.(*DynamicMessage), v)
+		default:
+			prev.Value = v
+		}
+	}
+
+	dst.Unknown = append(dst.Unknown, src.Unknown...)
+}
+
+// setDynamicMapEntry sets a value of the key keeping the order of entries.
+func setDynamicMapEntry(entries []DynamicMapEntry, key, value any) []DynamicMapEntry {
+	for i, entry := range entries {
+		if entry.Key == key {
+			entries[i].Value = value
+			return entries
+		}
+	}
+
+	return append(entries, DynamicMapEntry{
+		Key:   key,
+		Value: value,
+	})
+}
+
+func dynamicUnknown(f wire.Field) *DynamicUnknownField {
+	return &DynamicUnknownField{
+		Number:   f.Number,
+		WireType: int(f.Type),
+		Value:    slices.Clone(f.Value),
+	}
+}
@@ -0,0 +1,610 @@
+package core
+
+import (
+	"cmp"
+	"encoding/json"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+	"github.com/sirkon/protoast/v2/internal/wire"
+)
+
+// EncodeMessage encodes a value of the message into canonical wire bytes: fields go in the order
+// of their numbers, repeated scalars are packed unless the schema says otherwise, map entries are
+// sorted by their keys and unknown fields are written last.
+//
+// The value is either a *DynamicMessage or a tree [Registry.NewDynamicMessage] accepts. It is
+// checked against the schema first.
+func (r *Registry) EncodeMessage(msg *Message, value any) ([]byte, error) {
+	s := newDynamicSchema(r)
+	m, err := s.normalizeMessage(msg, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.encode(m)
+}
+
+// NewDynamicMessage builds a dynamic value of the message checking it against the schema.
+//
+// The value is either a *DynamicMessage or a map[string]any keyed with field names or their
+// JSON names. Values of fields are
+//   - Go integers, floats, json.Number, bool, string and []byte for scalars. A value must fit
+//     into the field type. Strings are accepted for bytes as well.
+//   - *EnumValue, value name or number for enums.
+//   - *DynamicMessage or map[string]any for messages.
+//   - Slices for repeated fields.
+//   - []DynamicMapEntry or Go maps for maps. Keys of integer and bool types can be strings, like
+//     they are in JSON.
+//
+// Nil values are the same as unset fields.
+func (r *Registry) NewDynamicMessage(msg *Message, value any) (*DynamicMessage, error) {
+	return newDynamicSchema(r).normalizeMessage(msg, value)
+}
+
+func (s *dynamicSchema) normalizeMessage(msg *Message, value any) (*DynamicMessage, error) {
+	schema := s.message(msg)
+	res := &DynamicMessage{Type: msg}
+
+	switch v := value.(type) {
+	case *DynamicMessage:
+		if v.Type == nil || v.Type.proto != msg.proto {
+			return nil, errors.Newf("%s value expected, got %s", s.r.TypeName(msg), dynamicTypeName(s.r, v))
+		}
+
+		for _, f := range v.Fields {
+			field := schema.byNumber[f.Number()]
+			if field == nil || field.node.nodeProto() != f.Field.nodeProto() {
+				return nil, errors.Newf("%s is not a field of %s", f.Name(), s.r.TypeName(msg))
+			}
+
+			if err := s.setNormalized(res, field, f.Value); err != nil {
+				return nil, err
+			}
+		}
+		res.Unknown = slices.Clone(v.Unknown)
+
+	case map[string]any:
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			field := schema.byName[key]
+			if field == nil {
+				field = schema.byJSON[key]
+			}
+			if field == nil {
+				return nil, errors.Newf("unknown %s field %s", s.r.TypeName(msg), key)
+			}
+
+			if err := s.setNormalized(res, field, v[key]); err != nil {
+				return nil, err
+			}
+		}
+
+	default:
+		return nil, errors.Newf("%s value expected, got %T", s.r.TypeName(msg), value)
+	}
+
+	return res, nil
+}
+
+func (s *dynamicSchema) setNormalized(res *DynamicMessage, field *dynamicField, value any) error {
+	if value == nil {
+		return nil
+	}
+
+	if res.lookup(field) != nil {
+		return errors.Newf("field %s is set several times", field.name)
+	}
+	if field.oneof != nil {
+		for _, f := range res.Fields {
+			if dynamicOneOf(f.Field) == field.oneof {
+				return errors.Newf("oneof %s has both %s and %s set", field.oneof.Name, f.Name(), field.name)
+			}
+		}
+	}
+
+	v, err := s.normalize(field, field.typ, value)
+	if err != nil {
+		return errors.Wrapf(err, "field %s", field.name)
+	}
+
+	res.set(field, v)
+	return nil
+}
+
+// normalize checks the value against the type and converts it into a form dynamic messages keep values in.
+func (s *dynamicSchema) normalize(field *dynamicField, typ Type, value any) (any, error) {
+	switch t := typ.(type) {
+	case *Repeated:
+		items, ok := dynamicSlice(value)
+		if !ok {
+			return nil, errors.Newf("list expected for repeated field, got %T", value)
+		}
+
+		res := make([]any, 0, len(items))
+		for i, item := range items {
+			v, err := s.normalize(field, t.Type, item)
+			if err != nil {
+				return nil, errors.Wrapf(err, "item %d", i)
+			}
+			res = append(res, v)
+		}
+		return res, nil
+
+	case *Map:
+		entries, ok := dynamicMapEntries(value)
+		if !ok {
+			return nil, errors.Newf("map expected for map field, got %T", value)
+		}
+
+		var res []DynamicMapEntry
+		for _, entry := range entries {
+			key, err := s.normalizeMapKey(field, t.Key(), entry.Key)
+			if err != nil {
+				return nil, errors.Wrapf(err, "key %v", entry.Key)
+			}
+
+			v, err := s.normalize(field, t.Value(s.r), entry.Value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "value of key %v", entry.Key)
+			}
+			res = setDynamicMapEntry(res, key, v)
+		}
+		slices.SortFunc(res, func(a, b DynamicMapEntry) int {
+			return compareDynamicKeys(a.Key, b.Key)
+		})
+		return res, nil
+
+	case *Message:
+		return s.normalizeMessage(t, value)
+
+	case *Enum:
+		return s.normalizeEnum(t, value)
+
+	default:
+		return s.normalizeScalar(field, typ, value)
+	}
+}
+
+func (s *dynamicSchema) normalizeEnum(enum *Enum, value any) (any, error) {
+	switch v := value.(type) {
+	case *EnumValue:
+		if v.proto.Parent != enum.proto {
+			return nil, errors.Newf("%s is not a value of %s", v.Name(), s.r.TypeName(enum))
+		}
+		return v, nil
+
+	case string:
+		res := enum.Value(s.r, v)
+		if res == nil {
+			return nil, errors.Newf("unknown %s value %s", s.r.TypeName(enum), v)
+		}
+		return res, nil
+
+	default:
+		number, err := dynamicInt(value, math.MinInt32, math.MaxInt32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s value expected", s.r.TypeName(enum))
+		}
+
+		if res := enum.ValueByNumber(s.r, int(number)); res != nil {
+			return res, nil
+		}
+		if !enum.IsOpen(s.r) {
+			return nil, errors.Newf("closed enum %s has no value %d", s.r.TypeName(enum), number)
+		}
+		return int32(number), nil
+	}
+}
+
+func (s *dynamicSchema) normalizeScalar(field *dynamicField, typ Type, value any) (any, error) {
+	switch typ.(type) {
+	case *Bool:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+
+	case *String:
+		if v, ok := value.(string); ok {
+			if field.verifyUTF8 && !utf8.ValidString(v) {
+				return nil, errors.New("invalid UTF-8 in string value")
+			}
+			return v, nil
+		}
+
+	case *Bytes:
+		switch v := value.(type) {
+		case []byte:
+			return slices.Clone(v), nil
+		case string:
+			return []byte(v), nil
+		}
+
+	case *Float:
+		v, err := dynamicFloat(value)
+		if err != nil {
+			return nil, err
+		}
+		if !math.IsInf(v, 0) && math.IsInf(float64(float32(v)), 0) {
+			return nil, errors.Newf("value %g overflows float", v)
+		}
+		return float32(v), nil
+
+	case *Double:
+		return dynamicFloat(value)
+
+	case *Int32, *Sint32, *Sfixed32:
+		v, err := dynamicInt(value, math.MinInt32, math.MaxInt32)
+		return int32(v), err
+
+	case *Int64, *Sint64, *Sfixed64:
+		return dynamicInt(value, math.MinInt64, math.MaxInt64)
+
+	case *Uint32, *Fixed32:
+		v, err := dynamicUint(value, math.MaxUint32)
+		return uint32(v), err
+
+	case *Uint64, *Fixed64:
+		return dynamicUint(value, math.MaxUint64)
+
+	default:
+		return nil, errors.Newf("unexpected field type %T", typ)
+	}
+
+	return nil, errors.Newf("%s value expected, got %T", s.r.TypeName(typ), value)
+}
+
+// normalizeMapKey also accepts strings for integer and bool keys, the way JSON represents them.
+func (s *dynamicSchema) normalizeMapKey(field *dynamicField, typ ComparableType, value any) (any, error) {
+	key, ok := value.(string)
+	if !ok {
+		return s.normalizeScalar(field, typ, value)
+	}
+
+	switch typ.(type) {
+	case *String:
+		return key, nil
+	case *Bool:
+		v, err := strconv.ParseBool(key)
+		if err != nil {
+			return nil, errors.Newf("bool value expected, got %q", key)
+		}
+		return v, nil
+	default:
+		return s.normalizeScalar(field, typ, json.Number(key))
+	}
+}
+
+// encode encodes already normalized message value.
+func (s *dynamicSchema) encode(m *DynamicMessage) ([]byte, error) {
+	var b []byte
+	for _, field := range s.message(m.Type).fields {
+		f := m.lookup(field)
+		if f == nil {
+			continue
+		}
+
+		var err error
+		if b, err = s.appendField(b, field, f.Value); err != nil {
+			return nil, errors.Wrapf(err, "encode %s field %s", s.r.TypeName(m.Type), field.name)
+		}
+	}
+
+	for _, f := range m.Unknown {
+		b = wire.AppendTag(b, f.Number, wire.Type(f.WireType))
+		switch wire.Type(f.WireType) {
+		case wire.BytesType:
+			b = wire.AppendBytes(b, f.Value)
+		case wire.StartGroupType:
+			b = append(b, f.Value...)
+			b = wire.AppendTag(b, f.Number, wire.EndGroupType)
+		default:
+			b = append(b, f.Value...)
+		}
+	}
+
+	return b, nil
+}
+
+func (s *dynamicSchema) appendField(b []byte, field *dynamicField, value any) ([]byte, error) {
+	switch t := field.typ.(type) {
+	case *Repeated:
+		items := value.([]any)
+		if len(items) == 0 {
+			return b, nil
+		}
+
+		if !field.packed {
+			for _, item := range items {
+				var err error
+				if b, err = s.appendValue(b, field.num, t.Type, field.delimited, item); err != nil {
+					return nil, err
+				}
+			}
+			return b, nil
+		}
+
+		var packed []byte
+		for _, item := range items {
+			var err error
+			if packed, err = appendScalarValue(packed, t.Type, item); err != nil {
+				return nil, err
+			}
+		}
+		b = wire.AppendTag(b, field.num, wire.BytesType)
+		return wire.AppendBytes(b, packed), nil
+
+	case *Map:
+		entries := slices.SortedStableFunc(slices.Values(value.([]DynamicMapEntry)), func(a, b DynamicMapEntry) int {
+			return compareDynamicKeys(a.Key, b.Key)
+		})
+		for _, entry := range entries {
+			body, err := appendScalar(nil, 1, t.Key(), entry.Key)
+			if err != nil {
+				return nil, err
+			}
+			if body, err = s.appendValue(body, 2, t.Value(s.r), false, entry.Value); err != nil {
+				return nil, err
+			}
+
+			b = wire.AppendTag(b, field.num, wire.BytesType)
+			b = wire.AppendBytes(b, body)
+		}
+		return b, nil
+
+	default:
+		if field.implicit && isZeroDynamic(value) {
+			return b, nil
+		}
+		return s.appendValue(b, field.num, t, field.delimited, value)
+	}
+}
+
+func (s *dynamicSchema) appendValue(b []byte, num int, typ Type, delimited bool, value any) ([]byte, error) {
+	if _, ok := typ.(*Message); !ok {
+		return appendScalar(b, num, typ, value)
+	}
+
+	body, err := s.encode(value.(*DynamicMessage))
+	if err != nil {
+		return nil, err
+	}
+
+	if delimited {
+		b = wire.AppendTag(b, num, wire.StartGroupType)
+		b = append(b, body...)
+		return wire.AppendTag(b, num, wire.EndGroupType), nil
+	}
+
+	b = wire.AppendTag(b, num, wire.BytesType)
+	return wire.AppendBytes(b, body), nil
+}
+
+// isZeroDynamic checks if the scalar value is a default one, fields with no presence omit them.
+func isZeroDynamic(value any) bool {
+	switch v := value.(type) {
+	case *EnumValue:
+		return v.Value() == 0
+	case float32:
+		return math.Float32bits(v) == 0
+	case float64:
+		return math.Float64bits(v) == 0
+	case []byte:
+		return len(v) == 0
+	default:
+		return reflect.ValueOf(value).IsZero()
+	}
+}
+
+// compareDynamicKeys orders map keys of the same type.
+func compareDynamicKeys(a, b any) int {
+	switch v := a.(type) {
+	case int32:
+		return cmp.Compare(v, b.(int32))
+	case int64:
+		return cmp.Compare(v, b.(int64))
+	case uint32:
+		return cmp.Compare(v, b.(uint32))
+	case uint64:
+		return cmp.Compare(v, b.(uint64))
+	case string:
+		return cmp.Compare(v, b.(string))
+	case bool:
+		switch {
+		case v == b.(bool):
+			return 0
+		case v:
+			return 1
+		default:
+			return -1
+		}
+	default:
+		panic(errors.Newf("unexpected map key type %T", a))
+	}
+}
+
+// dynamicSlice returns items of a slice of any type. Bytes are not a list.
+func dynamicSlice(value any) ([]any, bool) {
+	switch v := value.(type) {
+	case []any:
+		return v, true
+	case []byte, string:
+		return nil, false
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	res := make([]any, rv.Len())
+	for i := range res {
+		res[i] = rv.Index(i).Interface()
+	}
+	return res, true
+}
+
+// dynamicMapEntries returns entries of []DynamicMapEntry or of a map of any type. Entries of
+// maps are sorted by the keys' string representation to keep errors reproducible.
+func dynamicMapEntries(value any) ([]DynamicMapEntry, bool) {
+	if v, ok := value.([]DynamicMapEntry); ok {
+		return v, true
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Map {
+		return nil, false
+	}
+
+	res := make([]DynamicMapEntry, 0, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		res = append(res, DynamicMapEntry{
+			Key:   iter.Key().Interface(),
+			Value: iter.Value().Interface(),
+		})
+	}
+	slices.SortFunc(res, func(a, b DynamicMapEntry) int {
+		return cmp.Compare(dynamicKeyString(a.Key), dynamicKeyString(b.Key))
+	})
+
+	return res, true
+}
+
+func dynamicKeyString(key any) string {
+	data, _ := json.Marshal(key)
+	return string(data)
+}
+
+// dynamicInt extracts an integer in the given range from Go numbers and json.Number.
+// Floats are accepted if they have no fractional part.
+func dynamicInt(value any, lo, hi int64) (int64, error) {
+	var res int64
+	switch v := value.(type) {
+	case json.Number:
+		var err error
+		if res, err = strconv.ParseInt(string(v), 10, 64); err != nil {
+			if errors.Is(err, strconv.ErrRange) {
+				return 0, errors.Newf("value %s is out of range", v)
+			}
+			f, ferr := strconv.ParseFloat(string(v), 64)
+			if ferr != nil || f != math.Trunc(f) {
+				return 0, errors.Newf("integer expected, got %s", v)
+			}
+			return dynamicInt(f, lo, hi)
+		}
+
+	default:
+		rv := reflect.ValueOf(value)
+		switch {
+		case rv.CanInt():
+			res = rv.Int()
+		case rv.CanUint():
+			if rv.Uint() > math.MaxInt64 {
+				return 0, errors.Newf("value %d is out of range", rv.Uint())
+			}
+			res = int64(rv.Uint())
+		case rv.CanFloat():
+			f := rv.Float()
+			if f != math.Trunc(f) {
+				return 0, errors.Newf("integer expected, got %g", f)
+			}
+			if f < math.MinInt64 || f >= math.MaxInt64 {
+				return 0, errors.Newf("value %g is out of range", f)
+			}
+			res = int64(f)
+		default:
+			return 0, errors.Newf("integer expected, got %T", value)
+		}
+	}
+
+	if res < lo || res > hi {
+		return 0, errors.Newf("value %d is out of range", res)
+	}
+
+	return res, nil
+}
+
+// dynamicUint extracts a non-negative integer up to the given limit from Go numbers and json.Number.
+func dynamicUint(value any, hi uint64) (uint64, error) {
+	var res uint64
+	switch v := value.(type) {
+	case json.Number:
+		var err error
+		if res, err = strconv.ParseUint(string(v), 10, 64); err != nil {
+			if _, ierr := strconv.ParseInt(string(v), 10, 64); errors.Is(err, strconv.ErrRange) || ierr == nil {
+				return 0, errors.Newf("value %s is out of range", v)
+			}
+			f, ferr := strconv.ParseFloat(string(v), 64)
+			if ferr != nil || f != math.Trunc(f) {
+				return 0, errors.Newf("unsigned integer expected, got %s", v)
+			}
+			return dynamicUint(f, hi)
+		}
+
+	default:
+		rv := reflect.ValueOf(value)
+		switch {
+		case rv.CanUint():
+			res = rv.Uint()
+		case rv.CanInt():
+			if rv.Int() < 0 {
+				return 0, errors.Newf("value %d is out of range", rv.Int())
+			}
+			res = uint64(rv.Int())
+		case rv.CanFloat():
+			f := rv.Float()
+			if f != math.Trunc(f) {
+				return 0, errors.Newf("unsigned integer expected, got %g", f)
+			}
+			if f < 0 || f >= math.MaxUint64 {
+				return 0, errors.Newf("value %g is out of range", f)
+			}
+			res = uint64(f)
+		default:
+			return 0, errors.Newf("unsigned integer expected, got %T", value)
+		}
+	}
+
+	if res > hi {
+		return 0, errors.Newf("value %d is out of range", res)
+	}
+
+	return res, nil
+}
+
+// dynamicFloat extracts a float from Go numbers and json.Number.
+func dynamicFloat(value any) (float64, error) {
+	if v, ok := value.(json.Number); ok {
+		res, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return 0, errors.Newf("number expected, got %s", v)
+		}
+		return res, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch {
+	case rv.CanFloat():
+		return rv.Float(), nil
+	case rv.CanInt():
+		return float64(rv.Int()), nil
+	case rv.CanUint():
+		return float64(rv.Uint()), nil
+	default:
+		return 0, errors.Newf("number expected, got %T", value)
+	}
+}
+
+// dynamicTypeName names the message type of the dynamic value.
+func dynamicTypeName(r *Registry, m *DynamicMessage) string {
+	if m.Type == nil {
+		return "message of unknown type"
+	}
+
+	return r.TypeName(m.Type)
+}
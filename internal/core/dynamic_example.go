@@ -0,0 +1,226 @@
+package core
+
+import (
+	"github.com/emicklei/proto"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+)
+
+// ExampleOptions tunes example values generation.
+type ExampleOptions struct {
+	// MaxDepth is the maximal nesting of messages, message fields deeper than that are left
+	// unset to stop recursion. Well-known types are not recursive and are set at any depth.
+	// Zero means the depth of 3.
+	MaxDepth int
+
+	// Hook overrides generated values. It is called for every field about to be set and
+	// its value is used when it reports true. The value is accepted in any form
+	// [Registry.NewDynamicMessage] accepts, nil leaves the field unset and lets the next
+	// branch of its oneof be chosen. Options of the field are a natural source of examples.
+	Hook func(field FieldNode) (any, bool)
+}
+
+// Example generates a deterministic example value of the message: every field is set, the first branch
+// of every oneof that gets a value is chosen, repeated fields and maps get a single element. Numbers
+// are 42 or 1.5, strings and bytes have field names as contents and enums take their first non-zero
+// values. Timestamp, Duration, Value and Any get realistic values.
+func (r *Registry) Example(msg *Message, opts ExampleOptions) (*DynamicMessage, error) {
+	if opts.MaxDepth == 0 {
+		opts.MaxDepth = 3
+	}
+
+	g := &exampleGenerator{
+		s:    newDynamicSchema(r),
+		opts: opts,
+	}
+	return g.message(msg, 0)
+}
+
+// ExampleJSON generates an example value of the message in JSON, see [Registry.Example].
+func (r *Registry) ExampleJSON(msg *Message, opts ExampleOptions) ([]byte, error) {
+	m, err := r.Example(msg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDynamicSchema(r).appendJSONMessage(nil, m)
+}
+
+// ExampleText generates an example value of the message in text format, see [Registry.Example].
+func (r *Registry) ExampleText(msg *Message, opts ExampleOptions) ([]byte, error) {
+	m, err := r.Example(msg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDynamicSchema(r).appendTextMessage(nil, m, "")
+}
+
+// Example values of well-known types: 2024-01-01T00:00:00Z and 30s.
+const (
+	exampleTimestamp = 1704067200
+	exampleDuration  = 30
+)
+
+type exampleGenerator struct {
+	s    *dynamicSchema
+	opts ExampleOptions
+}
+
+func (g *exampleGenerator) message(msg *Message, depth int) (*DynamicMessage, error) {
+	res := &DynamicMessage{Type: msg}
+	schema := g.s.message(msg)
+	set := func(name string, value any) {
+		res.set(schema.byName[name], value)
+	}
+
+	switch g.s.wellKnownType(msg) {
+	case "Timestamp":
+		set("seconds", int64(exampleTimestamp))
+		return res, nil
+
+	case "Duration":
+		set("seconds", int64(exampleDuration))
+		return res, nil
+
+	case "Value":
+		set("string_value", "value")
+		return res, nil
+
+	case "Any":
+		// Any needs a packed value of a known type, Duration is the simplest one to show.
+		inner, err := g.s.anyMessage("type.googleapis.com/google.protobuf.Duration")
+		if err != nil {
+			return res, nil
+		}
+
+		value, err := g.message(inner, depth)
+		if err != nil {
+			return nil, err
+		}
+		body, err := g.s.encode(value)
+		if err != nil {
+			return nil, err
+		}
+		set("type_url", "type.googleapis.com/google.protobuf.Duration")
+		set("value", body)
+		return res, nil
+	}
+
+	// Oneof is chosen by its first branch having a value, others are tried until then.
+	chosen := map[*proto.Oneof]bool{}
+	for _, field := range schema.declared {
+		if field.oneof != nil && chosen[field.oneof] {
+			continue
+		}
+
+		value, ok, err := g.field(msg, field, depth)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		res.set(field, value)
+		if field.oneof != nil {
+			chosen[field.oneof] = true
+		}
+	}
+
+	return res, nil
+}
+
+// field generates a value of the field with the hook taking precedence. False is returned
+// for the field to be left unset.
+func (g *exampleGenerator) field(msg *Message, field *dynamicField, depth int) (any, bool, error) {
+	if g.opts.Hook != nil {
+		if value, ok := g.opts.Hook(field.node); ok {
+			if value == nil {
+				return nil, false, nil
+			}
+
+			v, err := g.s.normalize(field, field.typ, value)
+			if err != nil {
+				return nil, false, errors.Wrapf(err, "%s field %s hook value", g.s.r.TypeName(msg), field.name)
+			}
+			return v, true, nil
+		}
+	}
+
+	return g.value(field, field.typ, depth)
+}
+
+// value generates a value of the type. False is returned for messages deeper than allowed,
+// well-known types excepted.
+func (g *exampleGenerator) value(field *dynamicField, typ Type, depth int) (any, bool, error) {
+	switch t := typ.(type) {
+	case *Repeated:
+		value, ok, err := g.value(field, t.Type, depth)
+		if !ok || err != nil {
+			return nil, false, err
+		}
+		return []any{value}, true, nil
+
+	case *Map:
+		value, ok, err := g.value(field, t.Value(g.s.r), depth)
+		if !ok || err != nil {
+			return nil, false, err
+		}
+		return []DynamicMapEntry{{Key: g.key(t.Key()), Value: value}}, true, nil
+
+	case *Message:
+		if depth >= g.opts.MaxDepth && g.s.wellKnownType(t) == "" {
+			return nil, false, nil
+		}
+
+		value, err := g.message(t, depth+1)
+		if err != nil {
+			return nil, false, err
+		}
+		return value, true, nil
+
+	case *Enum:
+		for value := range t.Values(g.s.r) {
+			if value.Value() != 0 {
+				return value, true, nil
+			}
+		}
+		return g.s.zero(t), true, nil
+
+	case *String:
+		return field.name, true, nil
+
+	case *Bytes:
+		return []byte(field.name), true, nil
+
+	case *Bool:
+		return true, true, nil
+
+	case *Float:
+		return float32(1.5), true, nil
+
+	case *Double:
+		return 1.5, true, nil
+
+	default:
+		value, err := g.s.normalizeScalar(field, typ, 42)
+		if err != nil {
+			return nil, false, err
+		}
+		return value, true, nil
+	}
+}
+
+// key generates a map key: "key", 1 or true.
+func (g *exampleGenerator) key(typ ComparableType) any {
+	switch typ.(type) {
+	case *String:
+		return "key"
+	case *Bool:
+		return true
+	default:
+		value, _ := g.s.normalizeScalar(nil, typ, 1)
+		return value
+	}
+}
@@ -0,0 +1,432 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emicklei/proto"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+)
+
+// EncodeJSON encodes the message value into JSON following the protojson mapping. Fields are keyed
+// with their JSON names in the order of declaration, fields with no presence are omitted when they
+// have zero values, 64-bit integers are strings, bytes are base64 encoded and enums are represented
+// with value names. Well-known types like Timestamp, Duration, Any, wrappers, Struct and FieldMask
+// have their special representations. Unknown fields are dropped.
+func (r *Registry) EncodeJSON(m *DynamicMessage) ([]byte, error) {
+	if m.Type == nil {
+		return nil, errors.New("message of unknown type")
+	}
+
+	s := newDynamicSchema(r)
+	v, err := s.normalizeMessage(m.Type, m)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.appendJSONMessage(nil, v)
+}
+
+// BinaryToJSON transcodes wire bytes of the message into JSON, see [Registry.EncodeJSON].
+func (r *Registry) BinaryToJSON(msg *Message, data []byte) ([]byte, error) {
+	s := newDynamicSchema(r)
+	m, err := s.decode(msg, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.appendJSONMessage(nil, m)
+}
+
+// Ranges of Timestamp and Duration values protojson accepts: 0001-01-01T00:00:00Z to
+// 9999-12-31T23:59:59Z and ±10000 years.
+const (
+	jsonMinTimestamp = -62135596800
+	jsonMaxTimestamp = 253402300799
+	jsonMaxDuration  = 315576000000
+)
+
+// wellKnownType returns a name of google.protobuf message having special JSON representation.
+func (s *dynamicSchema) wellKnownType(msg *Message) string {
+	switch {
+	case s.r.TypeIsGoogleProtobufAny(msg):
+		return "Any"
+	case s.r.TypeIsGoogleProtobufTimestamp(msg):
+		return "Timestamp"
+	case s.r.TypeIsGoogleProtobufDuration(msg):
+		return "Duration"
+	case s.r.TypeIsGoogleProtobufEmpty(msg):
+		return "Empty"
+	}
+
+	for _, name := range []string{
+		"Struct", "Value", "ListValue", "FieldMask",
+		"DoubleValue", "FloatValue", "Int64Value", "UInt64Value", "Int32Value", "UInt32Value",
+		"BoolValue", "StringValue", "BytesValue",
+	} {
+		if s.r.TypeIsDefined(msg, ".google.protobuf."+name) {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// isNullValue checks if this is google.protobuf.NullValue, which is represented with JSON null.
+func (s *dynamicSchema) isNullValue(typ Type) bool {
+	return s.r.TypeIsDefined(typ, ".google.protobuf.NullValue")
+}
+
+func (s *dynamicSchema) appendJSONMessage(b []byte, m *DynamicMessage) ([]byte, error) {
+	if name := s.wellKnownType(m.Type); name != "" {
+		res, err := s.appendJSONWellKnown(b, name, m)
+		if err != nil {
+			return nil, errors.Wrapf(err, "encode google.protobuf.%s", name)
+		}
+		return res, nil
+	}
+
+	b = append(b, '{')
+	var count int
+	for _, field := range s.message(m.Type).declared {
+		f := m.lookup(field)
+		if f == nil || isUnpopulatedDynamic(field, f.Value) {
+			continue
+		}
+
+		if count > 0 {
+			b = append(b, ',')
+		}
+		count++
+
+		b = appendJSONString(b, field.json)
+		b = append(b, ':')
+		var err error
+		if b, err = s.appendJSONValue(b, field.typ, f.Value); err != nil {
+			return nil, errors.Wrapf(err, "encode field %s", field.name)
+		}
+	}
+
+	return append(b, '}'), nil
+}
+
+func (s *dynamicSchema) appendJSONValue(b []byte, typ Type, value any) ([]byte, error) {
+	switch t := typ.(type) {
+	case *Repeated:
+		b = append(b, '[')
+		for i, item := range value.([]any) {
+			if i > 0 {
+				b = append(b, ',')
+			}
+
+			var err error
+			if b, err = s.appendJSONValue(b, t.Type, item); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, ']'), nil
+
+	case *Map:
+		entries := slices.SortedStableFunc(slices.Values(value.([]DynamicMapEntry)), func(a, b DynamicMapEntry) int {
+			return compareDynamicKeys(a.Key, b.Key)
+		})
+
+		b = append(b, '{')
+		for i, entry := range entries {
+			if i > 0 {
+				b = append(b, ',')
+			}
+
+			b = appendJSONString(b, fmt.Sprint(entry.Key))
+			b = append(b, ':')
+			var err error
+			if b, err = s.appendJSONValue(b, t.Value(s.r), entry.Value); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, '}'), nil
+
+	case *Message:
+		return s.appendJSONMessage(b, value.(*DynamicMessage))
+
+	case *Enum:
+		if s.isNullValue(t) {
+			return append(b, "null"...), nil
+		}
+
+		switch v := value.(type) {
+		case *EnumValue:
+			return appendJSONString(b, v.Name()), nil
+		default:
+			return strconv.AppendInt(b, int64(v.(int32)), 10), nil
+		}
+
+	default:
+		return appendJSONScalar(b, value), nil
+	}
+}
+
+// appendJSONScalar appends a normalized scalar value.
+func appendJSONScalar(b []byte, value any) []byte {
+	switch v := value.(type) {
+	case int32:
+		return strconv.AppendInt(b, int64(v), 10)
+	case uint32:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case int64:
+		b = append(b, '"')
+		b = strconv.AppendInt(b, v, 10)
+		return append(b, '"')
+	case uint64:
+		b = append(b, '"')
+		b = strconv.AppendUint(b, v, 10)
+		return append(b, '"')
+	case float32:
+		return appendJSONFloat(b, float64(v), 32)
+	case float64:
+		return appendJSONFloat(b, v, 64)
+	case bool:
+		return strconv.AppendBool(b, v)
+	case string:
+		return appendJSONString(b, v)
+	case []byte:
+		return appendJSONString(b, base64.StdEncoding.EncodeToString(v))
+	default:
+		panic(errors.Newf("unexpected scalar value %T", value))
+	}
+}
+
+// appendJSONFloat follows protojson rules: non-finite values are "NaN", "Infinity" and "-Infinity" strings.
+func appendJSONFloat(b []byte, v float64, bits int) []byte {
+	switch {
+	case math.IsNaN(v):
+		return append(b, `"NaN"`...)
+	case math.IsInf(v, 1):
+		return append(b, `"Infinity"`...)
+	case math.IsInf(v, -1):
+		return append(b, `"-Infinity"`...)
+	}
+
+	var data []byte
+	if bits == 32 {
+		data, _ = json.Marshal(float32(v))
+	} else {
+		data, _ = json.Marshal(v)
+	}
+	return append(b, data...)
+}
+
+func appendJSONString(b []byte, v string) []byte {
+	data, _ := jsonString(v)
+	return append(b, data...)
+}
+
+// isUnpopulatedDynamic checks if protojson omits the field value: zero values of fields with no presence,
+// empty lists and maps.
+func isUnpopulatedDynamic(field *dynamicField, value any) bool {
+	switch v := value.(type) {
+	case []any:
+		return len(v) == 0
+	case []DynamicMapEntry:
+		return len(v) == 0
+	default:
+		return field.implicit && isZeroDynamic(value)
+	}
+}
+
+func (s *dynamicSchema) appendJSONWellKnown(b []byte, name string, m *DynamicMessage) ([]byte, error) {
+	switch name {
+	case "Any":
+		return s.appendJSONAny(b, m)
+
+	case "Timestamp":
+		seconds, nanos := dynamicInt64(m, "seconds"), dynamicInt32(m, "nanos")
+		if seconds < jsonMinTimestamp || seconds > jsonMaxTimestamp || nanos < 0 || nanos >= 1e9 {
+			return nil, errors.Newf("timestamp %d.%09d is out of range", seconds, nanos)
+		}
+
+		v := time.Unix(seconds, int64(nanos)).UTC().Format("2006-01-02T15:04:05.000000000")
+		return appendJSONString(b, trimJSONFraction(v)+"Z"), nil
+
+	case "Duration":
+		seconds, nanos := dynamicInt64(m, "seconds"), dynamicInt32(m, "nanos")
+		if seconds < -jsonMaxDuration || seconds > jsonMaxDuration || nanos <= -1e9 || nanos >= 1e9 ||
+			seconds > 0 && nanos < 0 || seconds < 0 && nanos > 0 {
+			return nil, errors.Newf("duration %ds %dns is out of range", seconds, nanos)
+		}
+
+		var sign string
+		if seconds < 0 || nanos < 0 {
+			sign, seconds, nanos = "-", -seconds, -nanos
+		}
+		v := fmt.Sprintf("%s%d.%09d", sign, seconds, nanos)
+		return appendJSONString(b, trimJSONFraction(v)+"s"), nil
+
+	case "Empty":
+		return append(b, "{}"...), nil
+
+	case "Struct":
+		return s.appendJSONWrapped(b, m, "fields")
+
+	case "ListValue":
+		return s.appendJSONWrapped(b, m, "values")
+
+	case "Value":
+		kind := m.WhichOneOf("kind")
+		if kind == nil {
+			return nil, errors.New("none of the oneof fields is set")
+		}
+		if v, ok := kind.Value.(float64); ok && (math.IsNaN(v) || math.IsInf(v, 0)) {
+			return nil, errors.Newf("%v cannot be represented with number_value", v)
+		}
+		return s.appendJSONWrapped(b, m, kind.Name())
+
+	case "FieldMask":
+		var paths []string
+		if f := m.Get("paths"); f != nil {
+			for _, item := range f.Value.([]any) {
+				path := item.(string)
+				camel := jsonName(path)
+				if jsonSnakeCase(camel) != path {
+					return nil, errors.Newf("path %q cannot be represented in JSON", path)
+				}
+				paths = append(paths, camel)
+			}
+		}
+		return appendJSONString(b, strings.Join(paths, ",")), nil
+
+	default:
+		// Wrappers are represented with their values.
+		return s.appendJSONWrapped(b, m, "value")
+	}
+}
+
+// appendJSONWrapped appends a value of the field representing the whole message.
+// Unset fields are represented with their zero values.
+func (s *dynamicSchema) appendJSONWrapped(b []byte, m *DynamicMessage, name string) ([]byte, error) {
+	field := s.message(m.Type).byName[name]
+	var value any
+	if f := m.lookup(field); f != nil {
+		value = f.Value
+	} else {
+		switch field.typ.(type) {
+		case *Repeated:
+			value = []any{}
+		case *Map:
+			value = []DynamicMapEntry{}
+		default:
+			value = s.zero(field.typ)
+		}
+	}
+
+	return s.appendJSONValue(b, field.typ, value)
+}
+
+// appendJSONAny puts the type URL into "@type" field followed by fields of the value.
+// Values of well-known types are put into "value" field.
+func (s *dynamicSchema) appendJSONAny(b []byte, m *DynamicMessage) ([]byte, error) {
+	url := dynamicString(m, "type_url")
+	var value []byte
+	if f := m.Get("value"); f != nil {
+		value = f.Value.([]byte)
+	}
+	if url == "" && len(value) == 0 {
+		return append(b, "{}"...), nil
+	}
+
+	msg, err := s.anyMessage(url)
+	if err != nil {
+		return nil, err
+	}
+
+	inner, err := s.decode(msg, value)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := s.appendJSONMessage(nil, inner)
+	if err != nil {
+		return nil, err
+	}
+
+	b = append(b, `{"@type":`...)
+	b = appendJSONString(b, url)
+	switch {
+	case s.wellKnownType(msg) != "":
+		b = append(b, `,"value":`...)
+		b = append(b, body...)
+	case len(body) > 2:
+		b = append(b, ',')
+		b = append(b, body[1:len(body)-1]...)
+	}
+
+	return append(b, '}'), nil
+}
+
+// anyMessage resolves message type of the Any type URL, like type.googleapis.com/pkg.Message.
+func (s *dynamicSchema) anyMessage(url string) (*Message, error) {
+	if url == "" {
+		return nil, errors.New("missing type URL")
+	}
+
+	name := url[strings.LastIndexByte(url, '/')+1:]
+	msg, ok := s.r.registry["."+name].(*proto.Message)
+	if !ok || msg.IsExtend {
+		return nil, errors.Newf("unknown message type %s of type URL %s", name, url)
+	}
+
+	return s.r.wrap(msg).(*Message), nil
+}
+
+// trimJSONFraction leaves 0, 3, 6 or 9 digits of nanoseconds, as protojson does.
+func trimJSONFraction(v string) string {
+	v = strings.TrimSuffix(v, "000")
+	v = strings.TrimSuffix(v, "000")
+	return strings.TrimSuffix(v, ".000")
+}
+
+// jsonSnakeCase reverts lowerCamelCase JSON name into snake_case.
+func jsonSnakeCase(name string) string {
+	var res strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if 'A' <= c && c <= 'Z' {
+			res.WriteByte('_')
+			c += 'a' - 'A'
+		}
+		res.WriteByte(c)
+	}
+
+	return res.String()
+}
+
+func dynamicInt64(m *DynamicMessage, name string) int64 {
+	if f := m.Get(name); f != nil {
+		return f.Value.(int64)
+	}
+
+	return 0
+}
+
+func dynamicInt32(m *DynamicMessage, name string) int32 {
+	if f := m.Get(name); f != nil {
+		return f.Value.(int32)
+	}
+
+	return 0
+}
+
+func dynamicString(m *DynamicMessage, name string) string {
+	if f := m.Get(name); f != nil {
+		return f.Value.(string)
+	}
+
+	return ""
+}
@@ -0,0 +1,836 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+)
+
+// DecodeJSON decodes JSON representation of the message following the protojson mapping. Fields can
+// be keyed with both their JSON and proto names, integers can be strings, floats can be "NaN",
+// "Infinity" and "-Infinity" and enums can be represented with value numbers. Null is the same as
+// an unset field. Duplicate keys and map keys not written the canonical way, like "01" or "t", are
+// rejected. Errors point to wrong values with JSON pointers, like /items/0/id.
+func (r *Registry) DecodeJSON(msg *Message, data []byte) (*DynamicMessage, error) {
+	return newDynamicSchema(r).decodeJSON(msg, data)
+}
+
+// JSONToBinary transcodes JSON representation of the message into wire bytes,
+// see [Registry.DecodeJSON] and [Registry.EncodeMessage].
+func (r *Registry) JSONToBinary(msg *Message, data []byte) ([]byte, error) {
+	s := newDynamicSchema(r)
+	m, err := s.decodeJSON(msg, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.encode(m)
+}
+
+func (s *dynamicSchema) decodeJSON(msg *Message, data []byte) (*DynamicMessage, error) {
+	v, err := parseJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.jsonMessage(msg, v, "")
+}
+
+// parseJSON parses JSON document keeping numbers as json.Number. Objects with duplicate keys
+// and strings which are not valid UTF-8 are rejected like protojson does.
+func parseJSON(data []byte) (any, error) {
+	if err := checkJSONText(data); err != nil {
+		return nil, errors.Wrap(err, "parse JSON")
+	}
+
+	p := newJSONParser(data)
+	res, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	if len(p.duplicates) > 0 {
+		return nil, jsonError(p.duplicates[0], errors.New("duplicate key"))
+	}
+
+	return res, nil
+}
+
+// jsonParser reads JSON document token by token as encoding/json silently takes the last one
+// of duplicate keys.
+type jsonParser struct {
+	dec *json.Decoder
+
+	// duplicates are pointers of repeated object keys, the last value of a key is kept.
+	duplicates []string
+}
+
+func newJSONParser(data []byte) *jsonParser {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	return &jsonParser{dec: dec}
+}
+
+func (p *jsonParser) parse() (any, error) {
+	res, err := p.value("")
+	if err != nil {
+		return nil, errors.Wrap(err, "parse JSON")
+	}
+	if _, err := p.dec.Token(); err != io.EOF {
+		return nil, errors.New("parse JSON: unexpected data after the top level value")
+	}
+
+	return res, nil
+}
+
+func (p *jsonParser) value(pointer string) (any, error) {
+	token, err := p.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		res := map[string]any{}
+		for p.dec.More() {
+			token, err := p.dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			key := token.(string)
+			item := jsonPointer(pointer, key)
+			if _, ok := res[key]; ok {
+				p.duplicates = append(p.duplicates, item)
+			}
+			if res[key], err = p.value(item); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := p.dec.Token(); err != nil {
+			return nil, err
+		}
+		return res, nil
+
+	case json.Delim('['):
+		res := []any{}
+		for i := 0; p.dec.More(); i++ {
+			item, err := p.value(jsonPointer(pointer, strconv.Itoa(i)))
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, item)
+		}
+		if _, err := p.dec.Token(); err != nil {
+			return nil, err
+		}
+		return res, nil
+
+	default:
+		return token, nil
+	}
+}
+
+// checkJSONText looks for invalid UTF-8 and escaped unpaired surrogates, encoding/json silently
+// replaces them with U+FFFD.
+func checkJSONText(data []byte) error {
+	if !utf8.Valid(data) {
+		return errors.New("invalid UTF-8 in string")
+	}
+
+	for i := 0; i < len(data); i++ {
+		if data[i] != '\\' {
+			continue
+		}
+
+		r, ok := jsonEscapedRune(data[i+1:])
+		if !ok || !utf16.IsSurrogate(r) {
+			i++
+			continue
+		}
+
+		// Surrogates are only valid in pairs like \ud83d\ude00.
+		var low rune
+		ok = i+6 < len(data) && data[i+6] == '\\'
+		if ok {
+			low, ok = jsonEscapedRune(data[i+7:])
+		}
+		if !ok || utf16.DecodeRune(r, low) == utf8.RuneError {
+			return errors.Newf("invalid escape code %q in string", data[i:i+6])
+		}
+		i += 11
+	}
+
+	return nil
+}
+
+// jsonEscapedRune decodes uXXXX escape which follows a backslash.
+func jsonEscapedRune(data []byte) (rune, bool) {
+	if len(data) < 5 || data[0] != 'u' {
+		return 0, false
+	}
+
+	v, err := strconv.ParseUint(string(data[1:5]), 16, 16)
+	if err != nil {
+		return 0, false
+	}
+
+	return rune(v), true
+}
+
+// jsonError annotates error with JSON pointer of the value.
+func jsonError(pointer string, err error) error {
+	if pointer == "" {
+		return err
+	}
+
+	return errors.Wrap(err, pointer)
+}
+
+// jsonPointer appends escaped reference token to the pointer.
+func jsonPointer(pointer string, token string) string {
+	return pointer + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+func (s *dynamicSchema) jsonMessage(msg *Message, v any, pointer string) (*DynamicMessage, error) {
+	if name := s.wellKnownType(msg); name != "" && name != "Empty" {
+		return s.jsonWellKnown(name, msg, v, pointer)
+	}
+
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, jsonError(pointer, errors.Newf("object expected for %s, got %s", s.r.TypeName(msg), jsonKind(v)))
+	}
+
+	schema := s.message(msg)
+	res := &DynamicMessage{Type: msg}
+	for _, key := range slices.Sorted(maps.Keys(obj)) {
+		item := jsonPointer(pointer, key)
+		field := schema.byJSON[key]
+		if field == nil {
+			field = schema.byName[key]
+		}
+		if field == nil {
+			return nil, jsonError(item, errors.Newf("unknown %s field %s", s.r.TypeName(msg), key))
+		}
+
+		if obj[key] == nil && !s.jsonAcceptsNull(field.typ) {
+			continue
+		}
+
+		if res.lookup(field) != nil {
+			return nil, jsonError(item, errors.Newf("field %s is set several times", field.name))
+		}
+		if field.oneof != nil {
+			for _, f := range res.Fields {
+				if dynamicOneOf(f.Field) == field.oneof {
+					return nil, jsonError(item, errors.Newf("oneof %s has both %s and %s set", field.oneof.Name, f.Name(), field.name))
+				}
+			}
+		}
+
+		value, err := s.jsonValue(field, field.typ, obj[key], item)
+		if err != nil {
+			return nil, err
+		}
+		res.set(field, value)
+	}
+
+	return res, nil
+}
+
+// jsonAcceptsNull checks if null is a value of the type rather than an unset field.
+func (s *dynamicSchema) jsonAcceptsNull(typ Type) bool {
+	if msg, ok := typ.(*Message); ok {
+		return s.wellKnownType(msg) == "Value"
+	}
+
+	return s.isNullValue(typ)
+}
+
+func (s *dynamicSchema) jsonValue(field *dynamicField, typ Type, v any, pointer string) (any, error) {
+	switch t := typ.(type) {
+	case *Repeated:
+		items, ok := v.([]any)
+		if !ok {
+			return nil, jsonError(pointer, errors.Newf("array expected, got %s", jsonKind(v)))
+		}
+
+		res := make([]any, 0, len(items))
+		for i, item := range items {
+			value, err := s.jsonValue(field, t.Type, item, jsonPointer(pointer, strconv.Itoa(i)))
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, value)
+		}
+		return res, nil
+
+	case *Map:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, jsonError(pointer, errors.Newf("object expected, got %s", jsonKind(v)))
+		}
+
+		var res []DynamicMapEntry
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			item := jsonPointer(pointer, key)
+			k, err := s.jsonMapKey(field, t.Key(), key)
+			if err != nil {
+				return nil, jsonError(item, errors.Wrap(err, "invalid map key"))
+			}
+
+			value, err := s.jsonValue(field, t.Value(s.r), obj[key], item)
+			if err != nil {
+				return nil, err
+			}
+			res = setDynamicMapEntry(res, k, value)
+		}
+		slices.SortFunc(res, func(a, b DynamicMapEntry) int {
+			return compareDynamicKeys(a.Key, b.Key)
+		})
+		return res, nil
+
+	case *Message:
+		return s.jsonMessage(t, v, pointer)
+
+	case *Enum:
+		switch value := v.(type) {
+		case nil:
+			if s.isNullValue(t) {
+				return s.zero(t), nil
+			}
+		case string:
+			if res := t.Value(s.r, value); res != nil {
+				return res, nil
+			}
+			return nil, jsonError(pointer, errors.Newf("unknown %s value %s", s.r.TypeName(t), value))
+		case json.Number:
+			res, err := s.normalizeEnum(t, value)
+			if err != nil {
+				return nil, jsonError(pointer, err)
+			}
+			return res, nil
+		}
+		return nil, jsonError(pointer, errors.Newf("%s value expected, got %s", s.r.TypeName(t), jsonKind(v)))
+
+	default:
+		res, err := s.jsonScalar(field, typ, v)
+		if err != nil {
+			return nil, jsonError(pointer, err)
+		}
+		return res, nil
+	}
+}
+
+// jsonMapKey parses map key the way protojson does: integers are decimal, where signed ones
+// can have a sign, and bools are either "true" or "false".
+func (s *dynamicSchema) jsonMapKey(field *dynamicField, typ ComparableType, key string) (any, error) {
+	switch typ.(type) {
+	case *String:
+		return key, nil
+
+	case *Bool:
+		switch key {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, errors.Newf("bool value expected, got %q", key)
+
+	case *Uint32, *Fixed32, *Uint64, *Fixed64:
+		v, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			return nil, jsonMapKeyError(key, err)
+		}
+		return s.normalizeScalar(field, typ, v)
+
+	default:
+		v, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return nil, jsonMapKeyError(key, err)
+		}
+		return s.normalizeScalar(field, typ, v)
+	}
+}
+
+func jsonMapKeyError(key string, err error) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return errors.Newf("value %s is out of range", key)
+	}
+
+	return errors.Newf("integer expected, got %s", key)
+}
+
+func (s *dynamicSchema) jsonScalar(field *dynamicField, typ Type, v any) (any, error) {
+	switch typ.(type) {
+	case *Bool:
+		if _, ok := v.(bool); ok {
+			return v, nil
+		}
+
+	case *String:
+		if _, ok := v.(string); ok {
+			return v, nil
+		}
+
+	case *Bytes:
+		if value, ok := v.(string); ok {
+			return decodeJSONBytes(value)
+		}
+
+	case *Float, *Double:
+		switch value := v.(type) {
+		case json.Number:
+			return s.normalizeScalar(field, typ, value)
+		case string:
+			switch value {
+			case "NaN":
+				return s.normalizeScalar(field, typ, math.NaN())
+			case "Infinity":
+				return s.normalizeScalar(field, typ, math.Inf(1))
+			case "-Infinity":
+				return s.normalizeScalar(field, typ, math.Inf(-1))
+			}
+			if !isJSONNumber(value) {
+				return nil, errors.Newf("number expected, got %s", value)
+			}
+			return s.normalizeScalar(field, typ, json.Number(value))
+		}
+
+	default:
+		var number string
+		switch value := v.(type) {
+		case json.Number:
+			number = string(value)
+		case string:
+			number = value
+		default:
+			return nil, errors.Newf("%s value expected, got %s", s.r.TypeName(typ), jsonKind(v))
+		}
+
+		integer, ok := jsonIntegerDigits(number)
+		if !ok {
+			return nil, errors.Newf("integer expected, got %s", number)
+		}
+		return s.normalizeScalar(field, typ, json.Number(integer))
+	}
+
+	return nil, errors.Newf("%s value expected, got %s", s.r.TypeName(typ), jsonKind(v))
+}
+
+// decodeJSONBytes accepts both standard and URL-safe base64 encodings, with or without padding.
+func decodeJSONBytes(v string) ([]byte, error) {
+	enc := base64.StdEncoding
+	if strings.ContainsAny(v, "-_") {
+		enc = base64.URLEncoding
+	}
+	if len(v)%4 != 0 {
+		enc = enc.WithPadding(base64.NoPadding)
+	}
+
+	res, err := enc.DecodeString(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid base64 value")
+	}
+
+	return res, nil
+}
+
+func (s *dynamicSchema) jsonWellKnown(name string, msg *Message, v any, pointer string) (*DynamicMessage, error) {
+	schema := s.message(msg)
+	res := &DynamicMessage{Type: msg}
+	set := func(name string, value any) {
+		res.set(schema.byName[name], value)
+	}
+	fail := func(err error) (*DynamicMessage, error) {
+		return nil, jsonError(pointer, errors.Wrapf(err, "invalid google.protobuf.%s value", name))
+	}
+
+	switch name {
+	case "Any":
+		return s.jsonAny(msg, v, pointer)
+
+	case "Timestamp":
+		value, ok := v.(string)
+		if !ok {
+			return fail(errors.Newf("string expected, got %s", jsonKind(v)))
+		}
+
+		seconds, nanos, err := parseJSONTimestamp(value)
+		if err != nil {
+			return fail(err)
+		}
+		set("seconds", seconds)
+		set("nanos", nanos)
+		return res, nil
+
+	case "Duration":
+		value, ok := v.(string)
+		if !ok {
+			return fail(errors.Newf("string expected, got %s", jsonKind(v)))
+		}
+
+		seconds, nanos, err := parseJSONDuration(value)
+		if err != nil {
+			return fail(err)
+		}
+		set("seconds", seconds)
+		set("nanos", nanos)
+		return res, nil
+
+	case "Struct":
+		field := schema.byName["fields"]
+		value, err := s.jsonValue(field, field.typ, v, pointer)
+		if err != nil {
+			return nil, err
+		}
+		set("fields", value)
+		return res, nil
+
+	case "ListValue":
+		field := schema.byName["values"]
+		value, err := s.jsonValue(field, field.typ, v, pointer)
+		if err != nil {
+			return nil, err
+		}
+		set("values", value)
+		return res, nil
+
+	case "Value":
+		kind := jsonValueKind(v)
+		field := schema.byName[kind]
+		value, err := s.jsonValue(field, field.typ, v, pointer)
+		if err != nil {
+			return nil, err
+		}
+		set(kind, value)
+		return res, nil
+
+	case "FieldMask":
+		value, ok := v.(string)
+		if !ok {
+			return fail(errors.Newf("string expected, got %s", jsonKind(v)))
+		}
+
+		var paths []any
+		if value != "" {
+			for _, path := range strings.Split(value, ",") {
+				if strings.Contains(path, "_") || !isFieldMaskPath(path) {
+					return fail(errors.Newf("invalid path %q", path))
+				}
+				paths = append(paths, jsonSnakeCase(path))
+			}
+		}
+		set("paths", paths)
+		return res, nil
+
+	default:
+		// Wrappers are represented with their values.
+		field := schema.byName["value"]
+		value, err := s.jsonValue(field, field.typ, v, pointer)
+		if err != nil {
+			return nil, err
+		}
+		set("value", value)
+		return res, nil
+	}
+}
+
+// jsonValueKind returns google.protobuf.Value field keeping the JSON value.
+func jsonValueKind(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null_value"
+	case bool:
+		return "bool_value"
+	case json.Number:
+		return "number_value"
+	case string:
+		return "string_value"
+	case map[string]any:
+		return "struct_value"
+	default:
+		return "list_value"
+	}
+}
+
+// jsonAny takes the type URL from "@type" field. Fields of the value are either
+// next to it or in "value" field for well-known types.
+func (s *dynamicSchema) jsonAny(msg *Message, v any, pointer string) (*DynamicMessage, error) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, jsonError(pointer, errors.Newf("object expected for %s, got %s", s.r.TypeName(msg), jsonKind(v)))
+	}
+
+	res := &DynamicMessage{Type: msg}
+	if len(obj) == 0 {
+		return res, nil
+	}
+
+	url, ok := obj["@type"].(string)
+	if !ok {
+		return nil, jsonError(jsonPointer(pointer, "@type"), errors.New("type URL string expected"))
+	}
+
+	inner, err := s.anyMessage(url)
+	if err != nil {
+		return nil, jsonError(jsonPointer(pointer, "@type"), err)
+	}
+
+	var value *DynamicMessage
+	if s.wellKnownType(inner) != "" {
+		for key := range obj {
+			if key != "@type" && key != "value" {
+				return nil, jsonError(jsonPointer(pointer, key), errors.Newf("unexpected field %s of %s", key, s.r.TypeName(msg)))
+			}
+		}
+
+		if value, err = s.jsonMessage(inner, obj["value"], jsonPointer(pointer, "value")); err != nil {
+			return nil, err
+		}
+	} else {
+		fields := make(map[string]any, len(obj)-1)
+		for key, item := range obj {
+			if key != "@type" {
+				fields[key] = item
+			}
+		}
+
+		if value, err = s.jsonMessage(inner, fields, pointer); err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := s.encode(value)
+	if err != nil {
+		return nil, jsonError(pointer, err)
+	}
+
+	schema := s.message(msg)
+	res.set(schema.byName["type_url"], url)
+	res.set(schema.byName["value"], body)
+	return res, nil
+}
+
+// parseJSONTimestamp parses RFC 3339 timestamp protojson uses.
+func parseJSONTimestamp(v string) (int64, int32, error) {
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return 0, 0, errors.Newf("RFC 3339 timestamp expected, got %q", v)
+	}
+
+	// Fraction is limited to nanoseconds, time.Parse accepts any number of digits.
+	if i := strings.IndexByte(v, '.'); i >= 0 {
+		digits := strings.IndexFunc(v[i+1:], func(c rune) bool { return c < '0' || c > '9' })
+		if digits > 9 {
+			return 0, 0, errors.Newf("too many fractional digits in %q", v)
+		}
+	}
+
+	seconds := t.Unix()
+	if seconds < jsonMinTimestamp || seconds > jsonMaxTimestamp {
+		return 0, 0, errors.Newf("timestamp %q is out of range", v)
+	}
+
+	return seconds, int32(t.Nanosecond()), nil
+}
+
+// parseJSONDuration parses durations like "1.5s" and "-0.000001s". Like protojson does, it accepts
+// a sign, no leading zeros and either of whole and fractional parts may be empty: "+1.s" or ".5s".
+func parseJSONDuration(v string) (int64, int32, error) {
+	fail := func() (int64, int32, error) {
+		return 0, 0, errors.Newf("duration like 1.5s expected, got %q", v)
+	}
+
+	rest, ok := strings.CutSuffix(v, "s")
+	if !ok {
+		return fail()
+	}
+
+	negative := strings.HasPrefix(rest, "-")
+	if negative || strings.HasPrefix(rest, "+") {
+		rest = rest[1:]
+	}
+	whole, fraction, hasFraction := strings.Cut(rest, ".")
+	switch {
+	case whole == "" && !hasFraction,
+		!isDigits(whole) || len(whole) > 1 && whole[0] == '0',
+		!isDigits(fraction) || len(fraction) > 9:
+		return fail()
+	}
+
+	var seconds int64
+	if whole != "" {
+		var err error
+		if seconds, err = strconv.ParseInt(whole, 10, 64); err != nil || seconds > jsonMaxDuration {
+			return 0, 0, errors.Newf("duration %q is out of range", v)
+		}
+	}
+
+	var nanos int64
+	if hasFraction {
+		nanos, _ = strconv.ParseInt(fraction+strings.Repeat("0", 9-len(fraction)), 10, 32)
+	}
+	if negative {
+		seconds, nanos = -seconds, -nanos
+	}
+
+	return seconds, int32(nanos), nil
+}
+
+// isFieldMaskPath checks if the path is a sequence of identifiers separated with dots.
+func isFieldMaskPath(path string) bool {
+	for _, part := range strings.Split(path, ".") {
+		if part == "" || '0' <= part[0] && part[0] <= '9' {
+			return false
+		}
+
+		for _, c := range []byte(part) {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// isJSONNumber checks if the value is written by JSON number grammar, protojson requires it from
+// numbers in strings too.
+func isJSONNumber(v string) bool {
+	_, ok := parseJSONNumber(v)
+	return ok
+}
+
+// jsonNumber is a number split into parts of JSON number grammar:
+//
+//	-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?
+type jsonNumber struct {
+	negative bool
+	whole    string
+	fraction string
+	exponent string
+}
+
+func parseJSONNumber(v string) (jsonNumber, bool) {
+	var res jsonNumber
+	res.negative = strings.HasPrefix(v, "-")
+	rest := strings.TrimPrefix(v, "-")
+
+	end := strings.IndexAny(rest, ".eE")
+	if end < 0 {
+		end = len(rest)
+	}
+	res.whole, rest = rest[:end], rest[end:]
+	if res.whole == "" || !isDigits(res.whole) || len(res.whole) > 1 && res.whole[0] == '0' {
+		return res, false
+	}
+
+	if strings.HasPrefix(rest, ".") {
+		end := strings.IndexAny(rest, "eE")
+		if end < 0 {
+			end = len(rest)
+		}
+		res.fraction, rest = rest[1:end], rest[end:]
+		if res.fraction == "" || !isDigits(res.fraction) {
+			return res, false
+		}
+	}
+
+	if rest != "" {
+		res.exponent = rest[1:]
+		digits := strings.TrimLeft(res.exponent, "+-")
+		if len(res.exponent)-len(digits) > 1 || digits == "" || !isDigits(digits) {
+			return res, false
+		}
+	}
+
+	return res, true
+}
+
+// jsonIntegerDigits rewrites an integer written by JSON number grammar in plain decimal digits.
+// Numbers like 1.5e1 are integers too, protojson accepts them. Values too long for any integer
+// type are returned as is to be reported out of range.
+func jsonIntegerDigits(v string) (string, bool) {
+	number, ok := parseJSONNumber(v)
+	if !ok {
+		return "", false
+	}
+
+	var exponent int
+	if number.exponent != "" {
+		var err error
+		if exponent, err = strconv.Atoi(number.exponent); err != nil {
+			return "", false
+		}
+	}
+
+	// The value is digits×10^exponent now.
+	fraction := strings.TrimRight(number.fraction, "0")
+	digits := strings.TrimLeft(number.whole+fraction, "0")
+	exponent -= len(fraction)
+	switch {
+	case digits == "":
+		return "0", true
+	case exponent >= 0:
+		// Even the largest uint64 value has 20 digits, don't build huge strings for out of range values.
+		if len(digits)+exponent > 20 {
+			return v, true
+		}
+		digits += strings.Repeat("0", exponent)
+	default:
+		rest := len(digits) + exponent
+		if rest <= 0 || strings.Trim(digits[rest:], "0") != "" {
+			return "", false
+		}
+		digits = digits[:rest]
+	}
+
+	if number.negative {
+		return "-" + digits, true
+	}
+	return digits, true
+}
+
+func isDigits(v string) bool {
+	for _, c := range []byte(v) {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// jsonKind names a kind of JSON value for errors.
+func jsonKind(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return "unexpected value"
+	}
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/emicklei/proto"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+)
+
+// JSONViolation is a mismatch between JSON document and the message schema.
+type JSONViolation struct {
+	// Pointer is JSON pointer of the wrong value, like /items/0/id. It is empty for the document itself.
+	Pointer string
+	Message string
+}
+
+func (v *JSONViolation) String() string {
+	if v.Pointer == "" {
+		return v.Message
+	}
+
+	return v.Pointer + ": " + v.Message
+}
+
+// ValidateJSON checks JSON representation of the message against the schema. Unlike [Registry.DecodeJSON]
+// it does not stop at the first problem and returns all violations: unknown fields, values of wrong types,
+// integers out of range, unknown enum values, malformed values of well-known types, etc. Object keys
+// are visited in sorted order, so violations come in a stable order, duplicate keys are reported first.
+// Nil is returned for a valid document.
+func (r *Registry) ValidateJSON(msg *Message, data []byte) []*JSONViolation {
+	p := newJSONParser(data)
+	v, err := p.parse()
+	if err != nil {
+		return []*JSONViolation{{Message: err.Error()}}
+	}
+
+	validator := &jsonValidator{s: newDynamicSchema(r)}
+	for _, pointer := range p.duplicates {
+		validator.report(pointer, errors.New("duplicate key"))
+	}
+	validator.message(msg, v, "")
+	return validator.res
+}
+
+// jsonValidator walks messages, lists and maps itself and checks other values with the decoder.
+type jsonValidator struct {
+	s   *dynamicSchema
+	res []*JSONViolation
+}
+
+func (v *jsonValidator) report(pointer string, err error) {
+	v.res = append(v.res, &JSONViolation{
+		Pointer: pointer,
+		Message: err.Error(),
+	})
+}
+
+func (v *jsonValidator) message(msg *Message, value any, pointer string) {
+	switch name := v.s.wellKnownType(msg); name {
+	case "", "Empty":
+	case "Any":
+		v.any(msg, value, pointer)
+		return
+	case "Struct", "ListValue", "Value":
+		v.container(name, msg, value, pointer)
+		return
+	default:
+		if _, err := v.s.jsonWellKnown(name, msg, value, ""); err != nil {
+			v.report(pointer, err)
+		}
+		return
+	}
+
+	obj, ok := value.(map[string]any)
+	if !ok {
+		v.report(pointer, errors.Newf("object expected for %s, got %s", v.s.r.TypeName(msg), jsonKind(value)))
+		return
+	}
+
+	schema := v.s.message(msg)
+	set := map[*dynamicField]bool{}
+	oneofs := map[*proto.Oneof]*dynamicField{}
+	for _, key := range slices.Sorted(maps.Keys(obj)) {
+		item := jsonPointer(pointer, key)
+		field := schema.byJSON[key]
+		if field == nil {
+			field = schema.byName[key]
+		}
+		if field == nil {
+			v.report(item, errors.Newf("unknown %s field %s", v.s.r.TypeName(msg), key))
+			continue
+		}
+
+		if obj[key] == nil && !v.s.jsonAcceptsNull(field.typ) {
+			continue
+		}
+
+		switch {
+		case set[field]:
+			v.report(item, errors.Newf("field %s is set several times", field.name))
+		case field.oneof != nil && oneofs[field.oneof] != nil:
+			v.report(item, errors.Newf("oneof %s has both %s and %s set", field.oneof.Name, oneofs[field.oneof].name, field.name))
+		case field.oneof != nil:
+			oneofs[field.oneof] = field
+		}
+		set[field] = true
+
+		v.value(field, field.typ, obj[key], item)
+	}
+}
+
+func (v *jsonValidator) value(field *dynamicField, typ Type, value any, pointer string) {
+	switch t := typ.(type) {
+	case *Repeated:
+		items, ok := value.([]any)
+		if !ok {
+			v.report(pointer, errors.Newf("array expected, got %s", jsonKind(value)))
+			return
+		}
+
+		for i, item := range items {
+			v.value(field, t.Type, item, jsonPointer(pointer, strconv.Itoa(i)))
+		}
+
+	case *Map:
+		obj, ok := value.(map[string]any)
+		if !ok {
+			v.report(pointer, errors.Newf("object expected, got %s", jsonKind(value)))
+			return
+		}
+
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			item := jsonPointer(pointer, key)
+			if _, err := v.s.jsonMapKey(field, t.Key(), key); err != nil {
+				v.report(item, errors.Wrap(err, "invalid map key"))
+			}
+			v.value(field, t.Value(v.s.r), obj[key], item)
+		}
+
+	case *Message:
+		v.message(t, value, pointer)
+
+	default:
+		if _, err := v.s.jsonValue(field, typ, value, ""); err != nil {
+			v.report(pointer, err)
+		}
+	}
+}
+
+// container walks contents of Struct, ListValue and Value, they may have violations deep inside.
+func (v *jsonValidator) container(name string, msg *Message, value any, pointer string) {
+	schema := v.s.message(msg)
+	var field *dynamicField
+	switch name {
+	case "Struct":
+		field = schema.byName["fields"]
+	case "ListValue":
+		field = schema.byName["values"]
+	default:
+		field = schema.byName[jsonValueKind(value)]
+	}
+
+	v.value(field, field.typ, value, pointer)
+}
+
+// any validates fields of the packed value instead of decoding it.
+func (v *jsonValidator) any(msg *Message, value any, pointer string) {
+	obj, ok := value.(map[string]any)
+	if !ok {
+		v.report(pointer, errors.Newf("object expected for %s, got %s", v.s.r.TypeName(msg), jsonKind(value)))
+		return
+	}
+	if len(obj) == 0 {
+		return
+	}
+
+	url, ok := obj["@type"].(string)
+	if !ok {
+		v.report(jsonPointer(pointer, "@type"), errors.New("type URL string expected"))
+		return
+	}
+
+	inner, err := v.s.anyMessage(url)
+	if err != nil {
+		v.report(jsonPointer(pointer, "@type"), err)
+		return
+	}
+
+	if v.s.wellKnownType(inner) == "" {
+		fields := make(map[string]any, len(obj)-1)
+		for key, item := range obj {
+			if key != "@type" {
+				fields[key] = item
+			}
+		}
+		v.message(inner, fields, pointer)
+		return
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(obj)) {
+		if key != "@type" && key != "value" {
+			v.report(jsonPointer(pointer, key), errors.Newf("unexpected field %s of %s", key, v.s.r.TypeName(msg)))
+		}
+	}
+	v.message(inner, obj["value"], jsonPointer(pointer, "value"))
+}
@@ -0,0 +1,202 @@
+package core
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+)
+
+// EncodeText formats the message value in canonical text format: a field per line in the order
+// of field numbers, nested messages are indented with two spaces, repeated fields are repeated
+// lines and map entries are sorted by keys. Fields with no presence are omitted when they have
+// zero values, Any values of known types are expanded and unknown fields are dropped.
+func (r *Registry) EncodeText(m *DynamicMessage) ([]byte, error) {
+	if m.Type == nil {
+		return nil, errors.New("message of unknown type")
+	}
+
+	s := newDynamicSchema(r)
+	v, err := s.normalizeMessage(m.Type, m)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.appendTextMessage(nil, v, "")
+}
+
+// BinaryToText transcodes wire bytes of the message into text format, see [Registry.EncodeText].
+func (r *Registry) BinaryToText(msg *Message, data []byte) ([]byte, error) {
+	s := newDynamicSchema(r)
+	m, err := s.decode(msg, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.appendTextMessage(nil, m, "")
+}
+
+func (s *dynamicSchema) appendTextMessage(b []byte, m *DynamicMessage, indent string) ([]byte, error) {
+	if s.r.TypeIsGoogleProtobufAny(m.Type) {
+		if res, ok := s.appendTextAny(b, m, indent); ok {
+			return res, nil
+		}
+	}
+
+	for _, field := range s.message(m.Type).fields {
+		f := m.lookup(field)
+		if f == nil || isUnpopulatedDynamic(field, f.Value) {
+			continue
+		}
+
+		var err error
+		switch t := field.typ.(type) {
+		case *Repeated:
+			for _, item := range f.Value.([]any) {
+				if b, err = s.appendTextField(b, indent, field.name, t.Type, item); err != nil {
+					break
+				}
+			}
+
+		case *Map:
+			entries := slices.SortedStableFunc(slices.Values(f.Value.([]DynamicMapEntry)), func(a, b DynamicMapEntry) int {
+				return compareDynamicKeys(a.Key, b.Key)
+			})
+			for _, entry := range entries {
+				b = append(b, indent...)
+				b = append(b, field.name...)
+				b = append(b, " {\n"...)
+				b = appendTextScalar(append(b, indent+"  key: "...), entry.Key)
+				b = append(b, '\n')
+				if b, err = s.appendTextField(b, indent+"  ", "value", t.Value(s.r), entry.Value); err != nil {
+					break
+				}
+				b = append(b, indent...)
+				b = append(b, "}\n"...)
+			}
+
+		default:
+			b, err = s.appendTextField(b, indent, field.name, t, f.Value)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "encode %s field %s", s.r.TypeName(m.Type), field.name)
+		}
+	}
+
+	return b, nil
+}
+
+func (s *dynamicSchema) appendTextField(b []byte, indent, name string, typ Type, value any) ([]byte, error) {
+	b = append(b, indent...)
+	b = append(b, name...)
+	if _, ok := typ.(*Message); !ok {
+		b = append(b, ": "...)
+		return append(appendTextScalar(b, value), '\n'), nil
+	}
+
+	b = append(b, " {\n"...)
+	b, err := s.appendTextMessage(b, value.(*DynamicMessage), indent+"  ")
+	if err != nil {
+		return nil, err
+	}
+	b = append(b, indent...)
+	return append(b, "}\n"...), nil
+}
+
+// appendTextAny writes Any value with expansion like [type.googleapis.com/pkg.Message] { ... }.
+// It reports false when the type of the value is not known and plain fields are to be written.
+func (s *dynamicSchema) appendTextAny(b []byte, m *DynamicMessage, indent string) ([]byte, bool) {
+	url := dynamicString(m, "type_url")
+	var value []byte
+	if f := m.Get("value"); f != nil {
+		value = f.Value.([]byte)
+	}
+
+	msg, err := s.anyMessage(url)
+	if err != nil {
+		return nil, false
+	}
+	inner, err := s.decode(msg, value)
+	if err != nil {
+		return nil, false
+	}
+
+	b = append(b, indent...)
+	b = append(b, "["+url+"] {\n"...)
+	if b, err = s.appendTextMessage(b, inner, indent+"  "); err != nil {
+		return nil, false
+	}
+	b = append(b, indent...)
+	return append(b, "}\n"...), true
+}
+
+func appendTextScalar(b []byte, value any) []byte {
+	switch v := value.(type) {
+	case *EnumValue:
+		return append(b, v.Name()...)
+	case int32:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(b, v, 10)
+	case uint32:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint64:
+		return strconv.AppendUint(b, v, 10)
+	case bool:
+		return strconv.AppendBool(b, v)
+	case float32:
+		return appendTextFloat(b, float64(v), 32)
+	case float64:
+		return appendTextFloat(b, v, 64)
+	case string:
+		return appendTextString(b, v, true)
+	case []byte:
+		return appendTextString(b, string(v), false)
+	default:
+		panic(errors.Newf("unexpected scalar value type %T", value))
+	}
+}
+
+func appendTextFloat(b []byte, v float64, bits int) []byte {
+	switch {
+	case math.IsNaN(v):
+		return append(b, "nan"...)
+	case math.IsInf(v, 1):
+		return append(b, "inf"...)
+	case math.IsInf(v, -1):
+		return append(b, "-inf"...)
+	default:
+		return strconv.AppendFloat(b, v, 'g', -1, bits)
+	}
+}
+
+// appendTextString writes double quoted string literal. Non printable characters are written with
+// octal escapes, printable UTF-8 characters are kept in strings and escaped in bytes.
+func appendTextString(b []byte, v string, text bool) []byte {
+	b = append(b, '"')
+	for i := 0; i < len(v); {
+		r, size := utf8.DecodeRuneInString(v[i:])
+		switch {
+		case r == '"' || r == '\\':
+			b = append(b, '\\', byte(r))
+		case r == '\n':
+			b = append(b, `\n`...)
+		case r == '\r':
+			b = append(b, `\r`...)
+		case r == '\t':
+			b = append(b, `\t`...)
+		case r < utf8.RuneSelf && unicode.IsPrint(r), text && r != utf8.RuneError && unicode.IsPrint(r):
+			b = append(b, v[i:i+size]...)
+		default:
+			for _, c := range []byte(v[i : i+size]) {
+				b = append(b, '\\', '0'+c>>6, '0'+c>>3&7, '0'+c&7)
+			}
+		}
+		i += size
+	}
+
+	return append(b, '"')
+}
@@ -0,0 +1,477 @@
+package core
+
+import (
+	"strings"
+	"text/scanner"
+	"unicode/utf8"
+
+	"github.com/emicklei/proto"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+)
+
+// DecodeText parses a value of the message written in protobuf text format, like
+//
+//	id: 1
+//	tags: ["a", "b"]
+//	children { key: "x" value { name: "y" } }
+//
+// Fields are referenced by their names, message values are put into {} or <>, repeated
+// fields can be set with lists or several times and Any values can be expanded
+// with [type.googleapis.com/pkg.Message] { ... }. Scalars follow the rules of option
+// aggregate values. Errors are prefixed with line:column positions of the wrong tokens.
+func (r *Registry) DecodeText(msg *Message, data []byte) (*DynamicMessage, error) {
+	return newDynamicSchema(r).decodeText(msg, data)
+}
+
+// TextToBinary transcodes text format representation of the message into wire bytes,
+// see [Registry.DecodeText] and [Registry.EncodeMessage].
+func (r *Registry) TextToBinary(msg *Message, data []byte) ([]byte, error) {
+	s := newDynamicSchema(r)
+	m, err := s.decodeText(msg, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.encode(m)
+}
+
+func (s *dynamicSchema) decodeText(msg *Message, data []byte) (*DynamicMessage, error) {
+	tokens, err := scanText(data)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &textParser{
+		s:      s,
+		tokens: tokens,
+	}
+	return p.message(msg, "")
+}
+
+type textTokenKind int
+
+const (
+	textEOF textTokenKind = iota
+	textIdent
+	textNumber
+	textString
+	textSymbol
+)
+
+// textToken is a token of text format. String tokens keep literal contents without quotes.
+type textToken struct {
+	kind textTokenKind
+	text string
+	pos  scanner.Position
+}
+
+func (t textToken) is(symbol string) bool {
+	return t.kind == textSymbol && t.text == symbol
+}
+
+func (t textToken) String() string {
+	switch t.kind {
+	case textEOF:
+		return "end of input"
+	case textString:
+		return `"` + t.text + `"`
+	default:
+		return t.text
+	}
+}
+
+// scanText splits text format document into tokens, comments start with # and last till the end of line.
+func scanText(data []byte) ([]textToken, error) {
+	var res []textToken
+	pos := scanner.Position{Line: 1, Column: 1}
+	next := func() {
+		r, size := utf8.DecodeRune(data[pos.Offset:])
+		pos.Offset += size
+		if r == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+
+	for pos.Offset < len(data) {
+		c := data[pos.Offset]
+		start := pos
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\v' || c == '\f':
+			next()
+
+		case c == '#':
+			for pos.Offset < len(data) && data[pos.Offset] != '\n' {
+				next()
+			}
+
+		case isTextIdentStart(c):
+			for pos.Offset < len(data) && (isTextIdentStart(data[pos.Offset]) || isTextDigit(data[pos.Offset])) {
+				next()
+			}
+			res = append(res, textToken{kind: textIdent, text: string(data[start.Offset:pos.Offset]), pos: start})
+
+		case isTextDigit(c) || c == '.' && pos.Offset+1 < len(data) && isTextDigit(data[pos.Offset+1]):
+			hex := c == '0' && pos.Offset+1 < len(data) && (data[pos.Offset+1] == 'x' || data[pos.Offset+1] == 'X')
+			for pos.Offset < len(data) {
+				c := data[pos.Offset]
+				exp := !hex && (c == '+' || c == '-') && (data[pos.Offset-1] == 'e' || data[pos.Offset-1] == 'E')
+				if !isTextIdentStart(c) && !isTextDigit(c) && c != '.' && !exp {
+					break
+				}
+				next()
+			}
+			res = append(res, textToken{kind: textNumber, text: string(data[start.Offset:pos.Offset]), pos: start})
+
+		case c == '"' || c == '\'':
+			next()
+			for {
+				if pos.Offset >= len(data) || data[pos.Offset] == '\n' {
+					return nil, textPosError(start, errors.New("unterminated string literal"))
+				}
+
+				d := data[pos.Offset]
+				next()
+				if d == c {
+					break
+				}
+				if d == '\\' && pos.Offset < len(data) && data[pos.Offset] != '\n' {
+					next()
+				}
+			}
+			res = append(res, textToken{kind: textString, text: string(data[start.Offset+1 : pos.Offset-1]), pos: start})
+
+		case strings.IndexByte("{}<>[]:,;/.-", c) >= 0:
+			next()
+			res = append(res, textToken{kind: textSymbol, text: string(c), pos: start})
+
+		default:
+			r, _ := utf8.DecodeRune(data[pos.Offset:])
+			return nil, textPosError(start, errors.Newf("unexpected character %q", r))
+		}
+	}
+
+	return append(res, textToken{kind: textEOF, pos: pos}), nil
+}
+
+func isTextIdentStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_'
+}
+
+func isTextDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// textParser builds dynamic values from text format tokens.
+type textParser struct {
+	s      *dynamicSchema
+	tokens []textToken
+	index  int
+}
+
+func (p *textParser) peek() textToken {
+	return p.tokens[p.index]
+}
+
+func (p *textParser) next() textToken {
+	res := p.tokens[p.index]
+	if res.kind != textEOF {
+		p.index++
+	}
+
+	return res
+}
+
+// skip consumes the symbol if it is the next token.
+func (p *textParser) skip(symbol string) bool {
+	if p.peek().is(symbol) {
+		p.index++
+		return true
+	}
+
+	return false
+}
+
+func textError(tok textToken, err error) error {
+	return textPosError(tok.pos, err)
+}
+
+// textPosError annotates error with line:column position, documents have no file names.
+func textPosError(pos scanner.Position, err error) error {
+	return errors.Wrapf(err, "%d:%d", pos.Line, pos.Column)
+}
+
+// message parses fields of the message until the closing symbol, or until the end of input for the
+// empty one. The closing symbol is consumed.
+func (p *textParser) message(msg *Message, end string) (*DynamicMessage, error) {
+	res := &DynamicMessage{Type: msg}
+	schema := p.s.message(msg)
+	for {
+		tok := p.next()
+		switch {
+		case end == "" && tok.kind == textEOF, end != "" && tok.is(end):
+			return res, nil
+		case tok.kind == textEOF:
+			return nil, textError(tok, errors.Newf("%s expected, got %s", end, tok))
+		case tok.is("["):
+			if err := p.extension(res, tok); err != nil {
+				return nil, err
+			}
+			p.separator()
+			continue
+		case tok.kind != textIdent:
+			return nil, textError(tok, errors.Newf("field name expected, got %s", tok))
+		}
+
+		field := schema.byName[tok.text]
+		if field == nil {
+			return nil, textError(tok, errors.Newf("unknown %s field %s", p.s.r.TypeName(msg), tok.text))
+		}
+
+		if err := p.field(res, field, tok); err != nil {
+			return nil, err
+		}
+		p.separator()
+	}
+}
+
+// separator consumes an optional field separator.
+func (p *textParser) separator() {
+	if !p.skip(",") {
+		p.skip(";")
+	}
+}
+
+func (p *textParser) field(res *DynamicMessage, field *dynamicField, name textToken) error {
+	elem := field.typ
+	switch t := field.typ.(type) {
+	case *Repeated:
+		elem = t.Type
+	case *Map:
+		elem = t.Entry(p.s.r)
+	}
+
+	if _, ok := elem.(*Message); ok {
+		p.skip(":")
+	} else if tok := p.next(); !tok.is(":") {
+		return textError(tok, errors.Newf(": expected after field name %s, got %s", field.name, tok))
+	}
+
+	switch t := field.typ.(type) {
+	case *Repeated, *Map:
+		var values []any
+		if p.skip("[") {
+			for !p.skip("]") {
+				if len(values) > 0 {
+					if tok := p.next(); !tok.is(",") {
+						return textError(tok, errors.Newf(", or ] expected, got %s", tok))
+					}
+				}
+
+				value, err := p.value(field, elem)
+				if err != nil {
+					return err
+				}
+				values = append(values, value)
+			}
+		} else {
+			value, err := p.value(field, elem)
+			if err != nil {
+				return err
+			}
+			values = append(values, value)
+		}
+
+		if m, ok := t.(*Map); ok {
+			var entries []DynamicMapEntry
+			if prev := res.lookup(field); prev != nil {
+				entries = prev.Value.([]DynamicMapEntry)
+			}
+			for _, value := range values {
+				key, v := p.s.mapEntry(m, value.(*DynamicMessage))
+				entries = setDynamicMapEntry(entries, key, v)
+			}
+			res.set(field, entries)
+			return nil
+		}
+
+		if prev := res.lookup(field); prev != nil {
+			prev.Value = append(prev.Value.([]any), values...)
+			return nil
+		}
+		res.set(field, values)
+		return nil
+
+	default:
+		if res.lookup(field) != nil {
+			return textError(name, errors.Newf("field %s is set several times", field.name))
+		}
+		if field.oneof != nil {
+			for _, f := range res.Fields {
+				if dynamicOneOf(f.Field) == field.oneof {
+					return textError(name, errors.Newf("oneof %s has both %s and %s set", field.oneof.Name, f.Name(), field.name))
+				}
+			}
+		}
+
+		value, err := p.value(field, elem)
+		if err != nil {
+			return err
+		}
+		res.set(field, value)
+		return nil
+	}
+}
+
+// mapEntry takes key and value from the map entry message, missing ones are zero.
+func (s *dynamicSchema) mapEntry(m *Map, entry *DynamicMessage) (key, value any) {
+	key = s.zero(m.Key())
+	value = s.zero(m.Value(s.r))
+	for _, item := range entry.Fields {
+		switch item.Number() {
+		case 1:
+			key = item.Value
+		case 2:
+			value = item.Value
+		}
+	}
+
+	return key, value
+}
+
+// extension parses a field named with [...]. Only Any expansions like [type.googleapis.com/pkg.Message]
+// are supported, dynamic messages have no extensions.
+func (p *textParser) extension(res *DynamicMessage, open textToken) error {
+	var name strings.Builder
+	for {
+		tok := p.next()
+		if tok.is("]") {
+			break
+		}
+		if tok.kind != textIdent && !tok.is(".") && !tok.is("/") {
+			return textError(tok, errors.Newf("extension name or type URL expected, got %s", tok))
+		}
+		name.WriteString(tok.text)
+	}
+
+	url := name.String()
+	if !strings.Contains(url, "/") || !p.s.r.TypeIsGoogleProtobufAny(res.Type) {
+		return textError(open, errors.Newf("%s has no extension %s, extensions are not supported", p.s.r.TypeName(res.Type), url))
+	}
+
+	schema := p.s.message(res.Type)
+	for _, name := range []string{"type_url", "value"} {
+		if res.lookup(schema.byName[name]) != nil {
+			return textError(open, errors.Newf("field %s is set several times", name))
+		}
+	}
+
+	inner, err := p.s.anyMessage(url)
+	if err != nil {
+		return textError(open, err)
+	}
+
+	p.skip(":")
+	tok := p.next()
+	var value *DynamicMessage
+	switch {
+	case tok.is("{"):
+		value, err = p.message(inner, "}")
+	case tok.is("<"):
+		value, err = p.message(inner, ">")
+	default:
+		return textError(tok, errors.Newf("%s value expected, got %s", p.s.r.TypeName(inner), tok))
+	}
+	if err != nil {
+		return err
+	}
+
+	body, err := p.s.encode(value)
+	if err != nil {
+		return textError(open, err)
+	}
+
+	res.set(schema.byName["type_url"], url)
+	res.set(schema.byName["value"], body)
+	return nil
+}
+
+// value parses a single value of the type.
+func (p *textParser) value(field *dynamicField, typ Type) (any, error) {
+	tok := p.next()
+	if msg, ok := typ.(*Message); ok {
+		switch {
+		case tok.is("{"):
+			return p.message(msg, "}")
+		case tok.is("<"):
+			return p.message(msg, ">")
+		default:
+			return nil, textError(tok, errors.Newf("%s value expected, got %s", p.s.r.TypeName(msg), tok))
+		}
+	}
+
+	literal := &proto.Literal{Source: tok.text}
+	switch {
+	case tok.kind == textString:
+		// Adjacent strings are concatenated.
+		literal.IsString = true
+		for p.peek().kind == textString {
+			literal.Source += p.next().text
+		}
+
+	case tok.is("-"):
+		num := p.next()
+		if num.kind != textNumber && num.kind != textIdent {
+			return nil, textError(num, errors.Newf("number expected after -, got %s", num))
+		}
+		literal.Source += num.text
+
+	case tok.kind != textNumber && tok.kind != textIdent:
+		return nil, textError(tok, errors.Newf("%s value expected, got %s", p.s.r.TypeName(typ), tok))
+	}
+
+	value, err := p.s.textScalar(field, typ, literal)
+	if err != nil {
+		return nil, textError(tok, err)
+	}
+
+	return value, nil
+}
+
+// textScalar converts a scalar literal the way option values are converted. Text format also
+// allows True, t, False, f and 0, 1 for booleans and numbers of undefined values of open enums.
+func (s *dynamicSchema) textScalar(field *dynamicField, typ Type, literal *proto.Literal) (any, error) {
+	switch t := typ.(type) {
+	case *Bool:
+		if !literal.IsString {
+			switch literal.Source {
+			case "true", "True", "t", "1":
+				return true, nil
+			case "false", "False", "f", "0":
+				return false, nil
+			}
+		}
+		return nil, errors.Newf("invalid bool literal %s", literal.Source)
+
+	case *Enum:
+		if !literal.IsString {
+			if value := t.Value(s.r, literal.Source); value != nil {
+				return value, nil
+			}
+			if number, err := parseIntLiteral(literal.Source, 32); err == nil {
+				return s.normalizeEnum(t, number)
+			}
+		}
+		return nil, errors.Newf("unknown %s value %s", s.r.TypeName(t), literal.Source)
+	}
+
+	value, err := decodeScalarLiteral(s.r, typ, literal)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.normalizeScalar(field, typ, value)
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"math"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+	"github.com/sirkon/protoast/v2/internal/wire"
+)
+
+// scalarWireType returns the wire type values of the given scalar type are encoded with.
+func scalarWireType(typ Type) (wire.Type, bool) {
+	switch typ.(type) {
+	case *Int32, *Int64, *Uint32, *Uint64, *Sint32, *Sint64, *Bool, *Enum:
+		return wire.VarintType, true
+	case *Fixed32, *Sfixed32, *Float:
+		return wire.Fixed32Type, true
+	case *Fixed64, *Sfixed64, *Double:
+		return wire.Fixed64Type, true
+	case *String, *Bytes:
+		return wire.BytesType, true
+	default:
+		return 0, false
+	}
+}
+
+// isPackable checks if repeated values of the type can be packed.
+func isPackable(typ Type) bool {
+	wt, ok := scalarWireType(typ)
+	return ok && wt != wire.BytesType
+}
+
+// appendScalar appends a field of scalar type. The value is one of int, uint, float64,
+// bool, string, []byte or *EnumValue, as decodeScalarLiteral returns them, or a value
+// of matching Go type dynamic messages have.
+func appendScalar(b []byte, num int, typ Type, value any) ([]byte, error) {
+	wt, ok := scalarWireType(typ)
+	if !ok {
+		return nil, errors.Newf("%T is not a scalar type", typ)
+	}
+
+	return appendScalarValue(wire.AppendTag(b, num, wt), typ, value)
+}
+
+// appendScalarValue appends scalar value without a tag, this is how packed values are encoded.
+func appendScalarValue(b []byte, typ Type, value any) ([]byte, error) {
+	switch typ.(type) {
+	case *String, *Bytes:
+		switch v := value.(type) {
+		case string:
+			return wire.AppendString(b, v), nil
+		case []byte:
+			return wire.AppendBytes(b, v), nil
+		}
+	case *Bool:
+		if v, ok := value.(bool); ok {
+			return wire.AppendVarint(b, wire.EncodeBool(v)), nil
+		}
+	case *Float:
+		if v, ok := scalarFloat(value); ok {
+			return wire.AppendFixed32(b, wire.FromFloat32(float32(v))), nil
+		}
+	case *Double:
+		if v, ok := scalarFloat(value); ok {
+			return wire.AppendFixed64(b, wire.FromFloat64(v)), nil
+		}
+	default:
+		v, ok := scalarInteger(value)
+		if !ok {
+			break
+		}
+
+		switch typ.(type) {
+		case *Int32, *Int64, *Uint32, *Uint64, *Enum:
+			return wire.AppendVarint(b, uint64(v)), nil
+		case *Sint32, *Sint64:
+			return wire.AppendVarint(b, wire.EncodeZigZag(v)), nil
+		case *Fixed32, *Sfixed32:
+			return wire.AppendFixed32(b, uint32(v)), nil
+		case *Fixed64, *Sfixed64:
+			return wire.AppendFixed64(b, uint64(v)), nil
+		}
+	}
+
+	return nil, errors.Newf("cannot encode %T as %T", value, typ)
+}
+
+func scalarInteger(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint32:
+		return int64(v), true
+	case uint:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	case *EnumValue:
+		return int64(v.Value()), true
+	default:
+		return 0, false
+	}
+}
+
+func scalarFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	default:
+		return math.NaN(), false
+	}
+}
@@ -0,0 +1,284 @@
+package core
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/emicklei/proto"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+)
+
+// parseIntLiteral parses decimal, hexadecimal and octal integers with the given bit size.
+func parseIntLiteral(source string, bitSize int) (int64, error) {
+	negative, digits := cutSign(source)
+	val, err := parseUnsignedLiteral(digits)
+	if err != nil {
+		return 0, err
+	}
+
+	limit := uint64(1) << (bitSize - 1)
+	if negative {
+		if val > limit {
+			return 0, errors.Newf("value %s is out of int%d range", source, bitSize)
+		}
+		return -int64(val-1) - 1, nil
+	}
+
+	if val >= limit {
+		return 0, errors.Newf("value %s is out of int%d range", source, bitSize)
+	}
+
+	return int64(val), nil
+}
+
+// parseUintLiteral parses decimal, hexadecimal and octal unsigned integers with the given bit size.
+func parseUintLiteral(source string, bitSize int) (uint64, error) {
+	negative, digits := cutSign(source)
+	if negative {
+		return 0, errors.Newf("value %s is out of uint%d range", source, bitSize)
+	}
+
+	val, err := parseUnsignedLiteral(digits)
+	if err != nil {
+		return 0, err
+	}
+
+	if bitSize < 64 && val >= uint64(1)<<bitSize {
+		return 0, errors.Newf("value %s is out of uint%d range", source, bitSize)
+	}
+
+	return val, nil
+}
+
+func parseUnsignedLiteral(digits string) (uint64, error) {
+	base := 10
+	switch {
+	case strings.HasPrefix(digits, "0x"), strings.HasPrefix(digits, "0X"):
+		base = 16
+		digits = digits[2:]
+	case len(digits) > 1 && digits[0] == '0':
+		base = 8
+		digits = digits[1:]
+	}
+
+	if digits == "" || strings.ContainsAny(digits, "_+-") {
+		return 0, errors.New("invalid integer literal")
+	}
+
+	val, err := strconv.ParseUint(digits, base, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "parse integer literal")
+	}
+
+	return val, nil
+}
+
+// parseFloatLiteral parses floating point literals, including integer ones and inf/nan identifiers.
+func parseFloatLiteral(source string, bitSize int) (float64, error) {
+	negative, body := cutSign(source)
+	sign := 1.0
+	if negative {
+		sign = -1
+	}
+
+	switch strings.ToLower(body) {
+	case "inf", "infinity":
+		return math.Inf(int(sign)), nil
+	case "nan":
+		return math.NaN(), nil
+	}
+
+	if strings.HasPrefix(body, "0x") || strings.HasPrefix(body, "0X") {
+		val, err := parseUnsignedLiteral(body)
+		if err != nil {
+			return 0, err
+		}
+		return sign * float64(val), nil
+	}
+
+	body = strings.TrimRight(body, "fF")
+	if body == "" || strings.ContainsAny(body, "_xXpPiInN") {
+		return 0, errors.Newf("invalid floating point literal %s", source)
+	}
+
+	val, err := strconv.ParseFloat(body, bitSize)
+	if err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			return sign * val, nil
+		}
+		return 0, errors.Wrap(err, "parse floating point literal")
+	}
+
+	return sign * val, nil
+}
+
+// parseBoolLiteral parses true and false identifiers.
+func parseBoolLiteral(source string) (bool, error) {
+	switch source {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, errors.Newf("invalid bool literal %s", source)
+	}
+}
+
+// unescapeLiteral decodes escape sequences of a string literal contents.
+// The result may not be a valid UTF-8 as octal and hexadecimal escapes
+// denote raw bytes.
+func unescapeLiteral(source string) (string, error) {
+	if !strings.ContainsRune(source, '\\') {
+		return source, nil
+	}
+
+	var res strings.Builder
+	for i := 0; i < len(source); i++ {
+		c := source[i]
+		if c != '\\' {
+			res.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i >= len(source) {
+			return "", errors.New("string literal ends with unfinished escape sequence")
+		}
+
+		switch c = source[i]; c {
+		case 'a':
+			res.WriteByte('\a')
+		case 'b':
+			res.WriteByte('\b')
+		case 'f':
+			res.WriteByte('\f')
+		case 'n':
+			res.WriteByte('\n')
+		case 'r':
+			res.WriteByte('\r')
+		case 't':
+			res.WriteByte('\t')
+		case 'v':
+			res.WriteByte('\v')
+		case '\\', '\'', '"', '?':
+			res.WriteByte(c)
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			end := i + 1
+			for end < len(source) && end < i+3 && source[end] >= '0' && source[end] <= '7' {
+				end++
+			}
+			val, err := strconv.ParseUint(source[i:end], 8, 16)
+			if err != nil || val > math.MaxUint8 {
+				return "", errors.Newf("invalid octal escape sequence \\%s", source[i:end])
+			}
+			res.WriteByte(byte(val))
+			i = end - 1
+		case 'x', 'X':
+			end := i + 1
+			for end < len(source) && end < i+3 && isHexDigit(source[end]) {
+				end++
+			}
+			if end == i+1 {
+				return "", errors.New("hexadecimal escape sequence without digits")
+			}
+			val, _ := strconv.ParseUint(source[i+1:end], 16, 8)
+			res.WriteByte(byte(val))
+			i = end - 1
+		case 'u', 'U':
+			size := 4
+			if c == 'U' {
+				size = 8
+			}
+			if i+size >= len(source) {
+				return "", errors.Newf("unfinished unicode escape sequence \\%s", source[i:])
+			}
+			val, err := strconv.ParseUint(source[i+1:i+1+size], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(val)) {
+				return "", errors.Newf("invalid unicode escape sequence \\%s", source[i:i+1+size])
+			}
+			res.WriteRune(rune(val))
+			i += size
+		default:
+			return "", errors.Newf("unknown escape sequence \\%c", c)
+		}
+	}
+
+	return res.String(), nil
+}
+
+func cutSign(source string) (negative bool, rest string) {
+	if strings.HasPrefix(source, "-") {
+		return true, strings.TrimSpace(source[1:])
+	}
+
+	return false, source
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// decodeScalarLiteral converts a scalar literal into a value of the given type.
+// It is int, uint, float64, bool, string, []byte or *EnumValue.
+func decodeScalarLiteral(r *Registry, typ Type, literal *proto.Literal) (any, error) {
+	if literal.OrderedMap != nil || literal.Array != nil {
+		return nil, errors.Newf("scalar value expected for %s", r.TypeName(typ))
+	}
+
+	switch t := typ.(type) {
+	case *String, *Bytes:
+		if !literal.IsString {
+			return nil, errors.Newf("string literal expected for %s, got %s", t, literal.Source)
+		}
+
+		val, err := unescapeLiteral(literal.Source)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := t.(*Bytes); ok {
+			return []byte(val), nil
+		}
+		return val, nil
+	}
+
+	if literal.IsString {
+		return nil, errors.Newf("unexpected string literal for %s", r.TypeName(typ))
+	}
+
+	switch t := typ.(type) {
+	case *Bool:
+		return parseBoolLiteral(literal.Source)
+	case *Int32, *Sint32, *Sfixed32:
+		val, err := parseIntLiteral(literal.Source, 32)
+		return int(val), err
+	case *Int64, *Sint64, *Sfixed64:
+		val, err := parseIntLiteral(literal.Source, 64)
+		return int(val), err
+	case *Uint32, *Fixed32:
+		val, err := parseUintLiteral(literal.Source, 32)
+		return uint(val), err
+	case *Uint64, *Fixed64:
+		val, err := parseUintLiteral(literal.Source, 64)
+		return uint(val), err
+	case *Float:
+		return parseFloatLiteral(literal.Source, 32)
+	case *Double:
+		return parseFloatLiteral(literal.Source, 64)
+	case *Enum:
+		if val := t.Value(r, literal.Source); val != nil {
+			return val, nil
+		}
+		if number, err := parseIntLiteral(literal.Source, 32); err == nil {
+			if val := t.ValueByNumber(r, int(number)); val != nil {
+				return val, nil
+			}
+		}
+		return nil, errors.Newf("unknown enum %s value %s", r.TypeName(t), literal.Source)
+	default:
+		return nil, errors.Newf("%s is not a scalar type", r.TypeName(typ))
+	}
+}
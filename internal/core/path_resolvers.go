@@ -115,7 +115,7 @@ func (b *PathResolversBuilder) WithRoot(roots ...string) *PathResolversBuilder {
 func (b *PathResolversBuilder) Build() ([]PathResolver, error) {
 	roots := slices.Clone(b.roots)
 	sort.Strings(roots)
-	slices.Compact(roots)
+	roots = slices.Compact(roots)
 
 	var result []PathResolver
 
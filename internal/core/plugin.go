@@ -0,0 +1,165 @@
+package core
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+)
+
+// Field numbers of google/protobuf/compiler/plugin.proto messages.
+const (
+	pluginRequestFileToGenerate  = 1
+	pluginRequestParameter       = 2
+	pluginRequestCompilerVersion = 3
+	pluginRequestProtoFile       = 15
+
+	pluginVersionMajor  = 1
+	pluginVersionMinor  = 2
+	pluginVersionPatch  = 3
+	pluginVersionSuffix = 4
+
+	pluginResponseError             = 1
+	pluginResponseSupportedFeatures = 2
+	pluginResponseMinimumEdition    = 3
+	pluginResponseMaximumEdition    = 4
+	pluginResponseFile              = 15
+
+	pluginFileName           = 1
+	pluginFileInsertionPoint = 2
+	pluginFileContent        = 15
+)
+
+// CodeGeneratorResponse.Feature values.
+const (
+	pluginFeatureProto3Optional   = 1
+	pluginFeatureSupportsEditions = 2
+)
+
+// Plugin is a protoc plugin invocation: a registry of every file protoc passed
+// and the files to generate code for.
+type Plugin struct {
+	// Registry has all files of the request, including dependencies of ones to generate.
+	Registry *Registry
+
+	// Files are files to generate code for, in the order protoc lists them.
+	Files []*File
+
+	// Parameter is a parameter passed to the plugin, like "paths=source_relative" with
+	// --xxx_out=paths=source_relative:. or --xxx_opt.
+	Parameter string
+
+	// CompilerVersion is a version of protoc, like "5.29.0". It is empty if protoc did not report it.
+	CompilerVersion string
+
+	generated []pluginFile
+}
+
+type pluginFile struct {
+	name           string
+	insertionPoint string
+	content        string
+}
+
+// AddFile adds generated file with the given name relative to the output directory.
+func (p *Plugin) AddFile(name, content string) {
+	p.generated = append(p.generated, pluginFile{
+		name:    name,
+		content: content,
+	})
+}
+
+// AddInsertion adds content to the insertion point of a file generated by another plugin.
+func (p *Plugin) AddInsertion(name, insertionPoint, content string) {
+	p.generated = append(p.generated, pluginFile{
+		name:           name,
+		insertionPoint: insertionPoint,
+		content:        content,
+	})
+}
+
+// RunPlugin reads CodeGeneratorRequest from in, passes it to gen and writes CodeGeneratorResponse
+// with generated files to out. An error returned by gen is reported to protoc in the response,
+// generated files are dropped then. Errors of reading the request and writing the response are
+// returned, a plugin is to exit with non-zero code on them.
+func RunPlugin(in io.Reader, out io.Writer, gen func(p *Plugin) error) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return errors.Wrap(err, "read code generator request")
+	}
+
+	p, err := newPlugin(data)
+	if err != nil {
+		return errors.Wrap(err, "decode code generator request")
+	}
+
+	res := descriptorFields{}
+	if err := gen(p); err != nil {
+		res.string(pluginResponseError, err.Error())
+	} else {
+		for _, file := range p.generated {
+			var b []byte
+			b = appendStringField(b, pluginFileName, file.name)
+			if file.insertionPoint != "" {
+				b = appendStringField(b, pluginFileInsertionPoint, file.insertionPoint)
+			}
+			b = appendStringField(b, pluginFileContent, file.content)
+			res.bytes(pluginResponseFile, b)
+		}
+	}
+	res.varint(pluginResponseSupportedFeatures, pluginFeatureProto3Optional|pluginFeatureSupportsEditions)
+	res.varint(pluginResponseMinimumEdition, descEditionProto2)
+	res.varint(pluginResponseMaximumEdition, descEdition2023)
+
+	if _, err := out.Write(res.encode()); err != nil {
+		return errors.Wrap(err, "write code generator response")
+	}
+
+	return nil
+}
+
+func newPlugin(data []byte) (*Plugin, error) {
+	m, err := decodeDescriptorMessage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files of the request are FileDescriptorProto, the same a descriptor set consists of.
+	var set []byte
+	for _, file := range m.bytes(pluginRequestProtoFile) {
+		set = appendBytesField(set, descFileSetFile, file)
+	}
+
+	r, err := NewRegistryFromDescriptorSet(set)
+	if err != nil {
+		return nil, errors.Wrap(err, "load request files")
+	}
+
+	p := &Plugin{
+		Registry:  r,
+		Parameter: m.string(pluginRequestParameter),
+	}
+	for _, name := range m.bytes(pluginRequestFileToGenerate) {
+		file, err := r.Proto(string(name))
+		if err != nil {
+			return nil, errors.Wrap(err, "get file to generate "+string(name))
+		}
+		p.Files = append(p.Files, file)
+	}
+
+	if m.has(pluginRequestCompilerVersion) {
+		version, err := decodeDescriptorMessage(m.message(pluginRequestCompilerVersion))
+		if err != nil {
+			return nil, errors.Wrap(err, "decode compiler version")
+		}
+
+		p.CompilerVersion = strconv.FormatUint(version.varint(pluginVersionMajor), 10) + "." +
+			strconv.FormatUint(version.varint(pluginVersionMinor), 10) + "." +
+			strconv.FormatUint(version.varint(pluginVersionPatch), 10)
+		if suffix := version.string(pluginVersionSuffix); suffix != "" {
+			p.CompilerVersion += "-" + suffix
+		}
+	}
+
+	return p, nil
+}
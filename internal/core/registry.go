@@ -2,7 +2,12 @@ package core
 
 import (
 	"bytes"
+	"iter"
+	"maps"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/emicklei/proto"
 	"github.com/sirkon/protoast/v2/internal/errors"
@@ -15,24 +20,41 @@ type Registry struct {
 	registry map[string]proto.Visitee
 	scopes   map[proto.Visitee]string
 
+	mapEntries map[*proto.MapField]*proto.Message
+	collisions []symbolCollision
+
+	// annotated is an index of nodes having options keyed by option full names.
+	annotated map[string][]proto.Visitee
+
+	// typeURLs keeps type URLs of Any expansions of every file by their parseable replacements.
+	typeURLs map[*proto.Proto]map[string]string
+
 	cache   map[proto.Visitee]Node
 	ftcache map[*MessageField]Type
 }
 
 func NewRegistry(resolvers ...PathResolver) (*Registry, error) {
-	res := &Registry{
+	res := newRegistry(resolvers)
+	if err := res.demarkFile(descriptorProtoPath); err != nil {
+		return nil, errors.Wrap(err, "set up proto descriptor")
+	}
+
+	return res, nil
+}
+
+func newRegistry(resolvers []PathResolver) *Registry {
+	return &Registry{
 		resolvers: resolvers,
 		protos:    map[string]*proto.Proto{},
 		registry:  map[string]proto.Visitee{},
 		scopes:    map[proto.Visitee]string{},
-		cache:     map[proto.Visitee]Node{},
-		ftcache:   map[*MessageField]Type{},
-	}
-	if err := res.demarkFile("google/protobuf/descriptor.proto"); err != nil {
-		return nil, errors.Wrap(err, "set up proto descriptor")
-	}
 
-	return res, nil
+		mapEntries: map[*proto.MapField]*proto.Message{},
+		annotated:  map[string][]proto.Visitee{},
+		typeURLs:   map[*proto.Proto]map[string]string{},
+		cache:      map[proto.Visitee]Node{},
+		ftcache:    map[*MessageField]Type{},
+	}
 }
 
 func (r *Registry) Proto(path string) (*File, error) {
@@ -54,6 +76,49 @@ func (r *Registry) Proto(path string) (*File, error) {
 	return nil, errors.New("proto file not found")
 }
 
+// Files returns all loaded files ordered by their names.
+func (r *Registry) Files() iter.Seq[*File] {
+	return func(yield func(*File) bool) {
+		names := slices.Sorted(maps.Keys(r.protos))
+		for _, name := range names {
+			if !yield(r.wrap(r.protos[name]).(*File)) {
+				return
+			}
+		}
+	}
+}
+
+// SymbolCollision describes two definitions sharing the same fully qualified name.
+// Previous is the one the name is bound to.
+type SymbolCollision struct {
+	Name     string
+	Previous Node
+	Node     Node
+}
+
+type symbolCollision struct {
+	name     string
+	previous proto.Visitee
+	node     proto.Visitee
+}
+
+// Collisions returns definitions sharing fully qualified names with ones registered earlier.
+// An enum value collides with other definitions in the scope of its enum, not of the enum itself.
+func (r *Registry) Collisions() iter.Seq[*SymbolCollision] {
+	return func(yield func(*SymbolCollision) bool) {
+		for _, c := range r.collisions {
+			collision := &SymbolCollision{
+				Name:     c.name,
+				Previous: r.wrap(c.previous),
+				Node:     r.wrap(c.node),
+			}
+			if !yield(collision) {
+				return
+			}
+		}
+	}
+}
+
 func (r *Registry) demarkFile(path string) error {
 	file, err := r.protoFile(path)
 	if err != nil {
@@ -65,6 +130,7 @@ func (r *Registry) demarkFile(path string) error {
 		file: file,
 	}
 	file.Accept(v)
+	r.indexOptions(file)
 
 	return nil
 }
@@ -93,7 +159,7 @@ func (r *Registry) protoFile(path string) (*proto.Proto, error) {
 		return nil, errors.New("not found")
 	}
 
-	parsed, err := readProtoFile(protoName, path)
+	parsed, err := r.readProtoFile(protoName, path)
 	if err != nil {
 		return nil, errors.Wrap(err, "get proto definition from resolved file "+protoName)
 	}
@@ -103,6 +169,8 @@ func (r *Registry) protoFile(path string) (*proto.Proto, error) {
 	return parsed, nil
 }
 
+const descriptorProtoPath = "google/protobuf/descriptor.proto"
+
 func (r *Registry) optionContextFile() *proto.Message {
 	return r.registry[registryOptionsFile].(*proto.Message)
 }
@@ -135,18 +203,111 @@ func (r *Registry) optionContextMethod() *proto.Message {
 	return r.registry[registryOptionsMethod].(*proto.Message)
 }
 
-func readProtoFile(protoName string, path string) (*proto.Proto, error) {
+func (r *Registry) readProtoFile(protoName string, path string) (*proto.Proto, error) {
 	file, err := os.ReadFile(protoName)
 	if err != nil {
 		return nil, errors.Wrap(err, "read file")
 	}
 
+	return r.parseProtoFile(file, path)
+}
+
+func (r *Registry) parseProtoFile(file []byte, path string) (*proto.Proto, error) {
+	file, urls := hideTypeURLs(file)
+
 	parser := proto.NewParser(bytes.NewReader(file))
 	parser.Filename(path)
 	parsed, err := parser.Parse()
 	if err != nil {
 		return nil, errors.Wrap(err, "parse file")
 	}
+	if urls != nil {
+		r.typeURLs[parsed] = urls
+	}
+
+	if err := checkEdition(parsed.Elements); err != nil {
+		return nil, err
+	}
+	if err := checkFeatures(parsed.Elements); err != nil {
+		return nil, errors.Wrap(err, "check features")
+	}
 
 	return parsed, nil
 }
+
+// hideTypeURLs replaces type URLs in Any expansions like [type.googleapis.com/pkg.Msg] with
+// identifiers as the parser does not support URLs. Every URL gets its own replacement which
+// does not occur anywhere else in the source, so neither different URLs nor extension names
+// can be confused with each other. The source length is kept, so are positions. Original URLs
+// are returned keyed by their replacements.
+func hideTypeURLs(src []byte) ([]byte, map[string]string) {
+	var res []byte
+	var urls map[string]string
+	for i := 0; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == '"' || c == '\'':
+			for i++; i < len(src) && src[i] != c && src[i] != '\n'; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				return src, urls
+			}
+			i += end + 3
+		case c == '[':
+			end := i + 1
+			for end < len(src) && isTypeURLChar(src[end]) {
+				end++
+			}
+			if end == len(src) || src[end] != ']' || bytes.IndexByte(src[i+1:end], '/') < 0 {
+				continue
+			}
+
+			name, ok := typeURLReplacement(src, urls, end-i-1)
+			if !ok {
+				continue
+			}
+
+			if res == nil {
+				res = slices.Clone(src)
+				urls = map[string]string{}
+			}
+			copy(res[i+1:end], name)
+			urls[name] = string(src[i+1 : end])
+			i = end
+		}
+	}
+
+	if res == nil {
+		return src, nil
+	}
+	return res, urls
+}
+
+// typeURLReplacement returns an identifier of the given length like _0__ for a type URL. It is
+// the first one neither occurring in the source nor taken by other URLs. False is returned if
+// there is no such identifier of the length.
+func typeURLReplacement(src []byte, urls map[string]string, length int) (string, bool) {
+	for n := len(urls); ; n++ {
+		name := "_" + strconv.FormatInt(int64(n), 36)
+		if len(name) > length {
+			return "", false
+		}
+
+		name += strings.Repeat("_", length-len(name))
+		if _, ok := urls[name]; !ok && !bytes.Contains(src, []byte(name)) {
+			return name, true
+		}
+	}
+}
+
+func isTypeURLChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '.' || c == '/'
+}
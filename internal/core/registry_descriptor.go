@@ -0,0 +1,811 @@
+package core
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"github.com/emicklei/proto"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+	"github.com/sirkon/protoast/v2/internal/wire"
+)
+
+// DescriptorOptions controls descriptors export.
+type DescriptorOptions struct {
+	// SourceCodeInfo enables export of element positions and comments.
+	SourceCodeInfo bool
+
+	// IncludeImports adds files the given ones depend on to the set, dependencies go first.
+	IncludeImports bool
+}
+
+// FileDescriptorSet encodes files as google.protobuf.FileDescriptorSet.
+func (r *Registry) FileDescriptorSet(files []*File, opts DescriptorOptions) ([]byte, error) {
+	if opts.IncludeImports {
+		files = r.withImports(files)
+	}
+
+	var b []byte
+	for _, file := range files {
+		data, err := r.FileDescriptorProto(file, opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "encode "+file.Name())
+		}
+
+		b = wire.AppendTag(b, descFileSetFile, wire.BytesType)
+		b = wire.AppendBytes(b, data)
+	}
+
+	return b, nil
+}
+
+// FileDescriptorProto encodes the file as google.protobuf.FileDescriptorProto.
+// Type names are fully qualified, fields have their JSON names set and options
+// are encoded as fields of *Options messages, custom ones as extensions.
+//
+// Positions only have starts of elements, thus spans of SourceCodeInfo locations
+// have the same start and end.
+func (r *Registry) FileDescriptorProto(file *File, opts DescriptorOptions) ([]byte, error) {
+	e := &descriptorEncoder{
+		r:          r,
+		sourceInfo: opts.SourceCodeInfo,
+	}
+
+	return e.file(file.proto)
+}
+
+// withImports adds transitive dependencies of files placing them before their dependants.
+func (r *Registry) withImports(files []*File) []*File {
+	var res []*File
+	seen := map[*proto.Proto]bool{}
+	var add func(file *proto.Proto)
+	add = func(file *proto.Proto) {
+		if seen[file] {
+			return
+		}
+		seen[file] = true
+
+		for _, element := range file.Elements {
+			if imp, ok := element.(*proto.Import); ok {
+				if dep, ok := r.protos[imp.Filename]; ok {
+					add(dep)
+				}
+			}
+		}
+		res = append(res, r.wrap(file).(*File))
+	}
+	for _, file := range files {
+		add(file.proto)
+	}
+
+	return res
+}
+
+type descriptorEncoder struct {
+	r          *Registry
+	sourceInfo bool
+	locations  []byte
+}
+
+func (e *descriptorEncoder) file(file *proto.Proto) ([]byte, error) {
+	r := e.r
+	node := r.wrap(file).(*File)
+
+	f := descriptorFields{}
+	f.string(descFileName, file.Filename)
+
+	var deps int
+	for _, element := range file.Elements {
+		switch v := element.(type) {
+		case *proto.Package:
+			f.string(descFilePackage, strings.TrimPrefix(r.scopes[file], "."))
+			e.location(v.Position, v.Comment, v.InlineComment, descFilePackage)
+		case *proto.Import:
+			f.string(descFileDependency, v.Filename)
+			e.location(v.Position, v.Comment, v.InlineComment, descFileDependency, deps)
+			switch v.Kind {
+			case "public":
+				f.varint(descFilePublicDependency, uint64(deps))
+			case "weak":
+				f.varint(descFileWeakDependency, uint64(deps))
+			}
+			deps++
+		}
+	}
+
+	var messages, enums, services, extensions int
+	for _, element := range file.Elements {
+		var err error
+		switch v := element.(type) {
+		case *proto.Message:
+			if v.IsExtend {
+				f[descFileExtension], err = e.extensions(f[descFileExtension], v, descFileExtension, &extensions)
+				break
+			}
+			var data []byte
+			data, err = e.message(v, []int{descFileMessageType, messages})
+			f.bytes(descFileMessageType, data)
+			messages++
+		case *proto.Enum:
+			var data []byte
+			data, err = e.enum(v, []int{descFileEnumType, enums})
+			f.bytes(descFileEnumType, data)
+			enums++
+		case *proto.Service:
+			var data []byte
+			data, err = e.service(v, []int{descFileService, services})
+			f.bytes(descFileService, data)
+			services++
+		case *proto.Group:
+			err = errors.Newf("%s: groups are not supported", v.Position)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if f[descFileOptions], err = e.options(nil, descFileOptions, node); err != nil {
+		return nil, err
+	}
+
+	if e.sourceInfo && len(e.locations) > 0 {
+		f.bytes(descFileSourceCodeInfo, e.locations)
+	}
+
+	switch edition := node.Edition(); edition {
+	case "proto2":
+	case "proto3":
+		f.string(descFileSyntax, edition)
+	default:
+		f.string(descFileSyntax, "editions")
+		f.varint(descFileEdition, uint64(descEditionNumber(edition)))
+	}
+
+	return f.encode(), nil
+}
+
+func (e *descriptorEncoder) message(msg *proto.Message, path []int) ([]byte, error) {
+	r := e.r
+	e.location(msg.Position, msg.Comment, nil, path...)
+
+	f := descriptorFields{}
+	f.string(descMessageName, msg.Name)
+
+	// Synthetic oneofs of proto3 optional fields go after real ones.
+	var oneofs int
+	for _, element := range msg.Elements {
+		if _, ok := element.(*proto.Oneof); ok {
+			oneofs++
+		}
+	}
+	var synthetic []string
+
+	var fields, nested, enums, ranges, extensions, reservedRanges, reservedNames, oneof int
+	addField := func(field Node, oneofIndex int) error {
+		data, err := e.field(field, oneofIndex, "", append(slices.Clone(path), descMessageField, fields))
+		if err != nil {
+			return err
+		}
+		f.bytes(descMessageField, data)
+		fields++
+		return nil
+	}
+	addNested := func(m *proto.Message) error {
+		data, err := e.message(m, append(slices.Clone(path), descMessageNestedType, nested))
+		if err != nil {
+			return err
+		}
+		f.bytes(descMessageNestedType, data)
+		nested++
+		return nil
+	}
+
+	for _, element := range msg.Elements {
+		var err error
+		switch v := element.(type) {
+		case *proto.NormalField:
+			oneofIndex := -1
+			if v.Optional && r.wrap(r.protoFileOf(msg)).(*File).Edition() == "proto3" {
+				oneofIndex = oneofs + len(synthetic)
+				synthetic = append(synthetic, syntheticOneofName(msg, v.Name))
+			}
+			err = addField(r.wrap(v), oneofIndex)
+		case *proto.MapField:
+			if err = addField(r.wrap(v), -1); err == nil {
+				err = addNested(r.mapEntries[v])
+			}
+		case *proto.Oneof:
+			for _, item := range v.Elements {
+				if branch, ok := item.(*proto.OneOfField); ok {
+					if err = addField(r.wrap(branch), oneof); err != nil {
+						break
+					}
+				}
+			}
+			if err == nil {
+				var data []byte
+				data, err = e.oneof(v, append(slices.Clone(path), descMessageOneofDecl, oneof))
+				f.bytes(descMessageOneofDecl, data)
+			}
+			oneof++
+		case *proto.Message:
+			if v.IsExtend {
+				f[descMessageExtension], err = e.extensions(f[descMessageExtension], v, descMessageExtension, &extensions)
+				break
+			}
+			err = addNested(v)
+		case *proto.Enum:
+			var data []byte
+			data, err = e.enum(v, append(slices.Clone(path), descMessageEnumType, enums))
+			f.bytes(descMessageEnumType, data)
+			enums++
+		case *proto.Extensions:
+			node := r.wrap(v)
+			for _, rng := range v.Ranges {
+				end := rng.To + 1
+				if rng.Max {
+					end = descMaxMessageNumber
+				}
+
+				var data []byte
+				data = appendVarintField(data, descRangeStart, uint64(rng.From))
+				data = appendVarintField(data, descRangeEnd, uint64(end))
+				if data, err = e.options(data, descRangeOptions, node); err != nil {
+					break
+				}
+				e.location(v.Position, v.Comment, v.InlineComment, append(slices.Clone(path), descMessageExtensionRange, ranges)...)
+				f.bytes(descMessageExtensionRange, data)
+				ranges++
+			}
+		case *proto.Reserved:
+			for _, rng := range v.Ranges {
+				end := rng.To + 1
+				if rng.Max {
+					end = descMaxMessageNumber
+				}
+
+				var data []byte
+				data = appendVarintField(data, descRangeStart, uint64(rng.From))
+				data = appendVarintField(data, descRangeEnd, uint64(end))
+				e.location(v.Position, v.Comment, v.InlineComment, append(slices.Clone(path), descMessageReservedRange, reservedRanges)...)
+				f.bytes(descMessageReservedRange, data)
+				reservedRanges++
+			}
+			for _, name := range v.FieldNames {
+				e.location(v.Position, v.Comment, v.InlineComment, append(slices.Clone(path), descMessageReservedName, reservedNames)...)
+				f.string(descMessageReservedName, name)
+				reservedNames++
+			}
+		case *proto.Group:
+			err = errors.Newf("%s: groups are not supported", v.Position)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range synthetic {
+		f.bytes(descMessageOneofDecl, appendStringField(nil, descOneofName, name))
+	}
+
+	var err error
+	if f[descMessageOptions], err = e.options(nil, descMessageOptions, r.wrap(msg)); err != nil {
+		return nil, err
+	}
+
+	return f.encode(), nil
+}
+
+// extensions encodes fields of the extend block.
+func (e *descriptorEncoder) extensions(b []byte, extend *proto.Message, number int, index *int) ([]byte, error) {
+	parent := extend.Parent
+	var path []int
+	if m, ok := parent.(*proto.Message); ok {
+		path = e.r.DescriptorPath(e.r.wrap(m))
+	}
+
+	for _, element := range extend.Elements {
+		field, ok := element.(*proto.NormalField)
+		if !ok {
+			continue
+		}
+
+		extendee, ok := e.r.extendee(field)
+		if !ok {
+			return nil, errors.Newf("%s: unknown extendee %s", extend.Position, extend.Name)
+		}
+
+		data, err := e.field(e.r.wrap(field), -1, extendee, append(slices.Clone(path), number, *index))
+		if err != nil {
+			return nil, err
+		}
+		b = appendBytesField(b, number, data)
+		*index++
+	}
+
+	return b, nil
+}
+
+func (e *descriptorEncoder) field(node Node, oneofIndex int, extendee string, path []int) ([]byte, error) {
+	r := e.r
+
+	var field *proto.Field
+	var typ Type
+	var number int
+	var jsonName string
+	var label uint64 = descLabelOptional
+	var proto3Optional bool
+	switch n := node.(type) {
+	case *MessageField:
+		switch p := n.proto.(type) {
+		case *proto.NormalField:
+			field = p.Field
+			if p.Required {
+				label = descLabelRequired
+			}
+			proto3Optional = p.Optional && oneofIndex >= 0
+		case *proto.MapField:
+			field = p.Field
+		}
+		typ = n.Type(r)
+		number = n.Value()
+		jsonName = n.JSONName()
+	case *OneOfBranch:
+		field = n.proto.Field
+		typ = n.Type(r)
+		number = n.Value()
+		jsonName = n.JSONName()
+	}
+	e.location(field.Position, field.Comment, field.InlineComment, path...)
+
+	var b []byte
+	b = appendStringField(b, descFieldName, field.Name)
+	if extendee != "" {
+		b = appendStringField(b, descFieldExtendee, extendee)
+	}
+	b = appendVarintField(b, descFieldNumber, uint64(number))
+
+	switch t := typ.(type) {
+	case *Repeated:
+		label = descLabelRepeated
+		typ = t.Type
+	case *Map:
+		label = descLabelRepeated
+		typ = t.Entry(r)
+	}
+	b = appendVarintField(b, descFieldLabel, label)
+
+	fieldType, typeName := descriptorFieldType(r, typ)
+	b = appendVarintField(b, descFieldType, uint64(fieldType))
+	if typeName != "" {
+		b = appendStringField(b, descFieldTypeName, typeName)
+	}
+
+	if n, ok := node.(*MessageField); ok {
+		value, err := n.Default(r)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			b = appendStringField(b, descFieldDefaultValue, descriptorDefault(value, typ))
+		}
+	}
+
+	b, err := e.options(b, descFieldOptions, node)
+	if err != nil {
+		return nil, err
+	}
+
+	if oneofIndex >= 0 {
+		b = appendVarintField(b, descFieldOneofIndex, uint64(oneofIndex))
+	}
+	b = appendStringField(b, descFieldJSONName, jsonName)
+
+	if proto3Optional {
+		b = appendVarintField(b, descFieldProto3Optional, 1)
+	}
+
+	return b, nil
+}
+
+func (e *descriptorEncoder) oneof(oneof *proto.Oneof, path []int) ([]byte, error) {
+	e.location(oneof.Position, oneof.Comment, nil, path...)
+
+	b := appendStringField(nil, descOneofName, oneof.Name)
+	return e.options(b, descOneofOptions, e.r.wrap(oneof))
+}
+
+func (e *descriptorEncoder) enum(enum *proto.Enum, path []int) ([]byte, error) {
+	r := e.r
+	e.location(enum.Position, enum.Comment, nil, path...)
+
+	f := descriptorFields{}
+	f.string(descEnumName, enum.Name)
+
+	var values, reservedRanges, reservedNames int
+	for _, element := range enum.Elements {
+		switch v := element.(type) {
+		case *proto.EnumField:
+			valuePath := append(slices.Clone(path), descEnumValue, values)
+			e.location(v.Position, v.Comment, v.InlineComment, valuePath...)
+
+			var data []byte
+			data = appendStringField(data, descEnumValueName, v.Name)
+			data = appendVarintField(data, descEnumValueNumber, uint64(int64(v.Integer)))
+			data, err := e.options(data, descEnumValueOptions, r.wrap(v))
+			if err != nil {
+				return nil, err
+			}
+			f.bytes(descEnumValue, data)
+			values++
+		case *proto.Reserved:
+			for _, rng := range v.Ranges {
+				end := rng.To
+				if rng.Max {
+					end = descMaxEnumNumber
+				}
+
+				var data []byte
+				data = appendVarintField(data, descRangeStart, uint64(int64(rng.From)))
+				data = appendVarintField(data, descRangeEnd, uint64(int64(end)))
+				e.location(v.Position, v.Comment, v.InlineComment, append(slices.Clone(path), descEnumReservedRange, reservedRanges)...)
+				f.bytes(descEnumReservedRange, data)
+				reservedRanges++
+			}
+			for _, name := range v.FieldNames {
+				e.location(v.Position, v.Comment, v.InlineComment, append(slices.Clone(path), descEnumReservedName, reservedNames)...)
+				f.string(descEnumReservedName, name)
+				reservedNames++
+			}
+		}
+	}
+
+	var err error
+	if f[descEnumOptions], err = e.options(nil, descEnumOptions, r.wrap(enum)); err != nil {
+		return nil, err
+	}
+
+	return f.encode(), nil
+}
+
+func (e *descriptorEncoder) service(service *proto.Service, path []int) ([]byte, error) {
+	r := e.r
+	e.location(service.Position, service.Comment, nil, path...)
+
+	var b []byte
+	b = appendStringField(b, descServiceName, service.Name)
+
+	var methods int
+	for _, element := range service.Elements {
+		rpc, ok := element.(*proto.RPC)
+		if !ok {
+			continue
+		}
+
+		e.location(rpc.Position, rpc.Comment, rpc.InlineComment, append(slices.Clone(path), descServiceMethod, methods)...)
+		method := r.wrap(rpc).(*Method)
+		_, input := method.Input(r)
+		_, output := method.Output(r)
+
+		var data []byte
+		data = appendStringField(data, descMethodName, rpc.Name)
+		data = appendStringField(data, descMethodInputType, r.NodeIndex(input))
+		data = appendStringField(data, descMethodOutputType, r.NodeIndex(output))
+		data, err := e.options(data, descMethodOptions, method)
+		if err != nil {
+			return nil, err
+		}
+		if rpc.StreamsRequest {
+			data = appendVarintField(data, descMethodClientStreaming, 1)
+		}
+		if rpc.StreamsReturns {
+			data = appendVarintField(data, descMethodServerStreaming, 1)
+		}
+		b = appendBytesField(b, descServiceMethod, data)
+		methods++
+	}
+
+	return e.options(b, descServiceOptions, r.wrap(service))
+}
+
+// options appends options of the node as a field with the given number if there are any.
+func (e *descriptorEncoder) options(b []byte, number int, node Node) ([]byte, error) {
+	optionable, ok := node.(NodeOptionable)
+	if !ok {
+		return b, nil
+	}
+
+	options := slices.Collect(e.r.Options(optionable))
+	slices.SortStableFunc(options, func(a, b *Option) int {
+		return a.optionField.Sequence - b.optionField.Sequence
+	})
+
+	var data []byte
+	for _, option := range options {
+		value, err := option.TryValue()
+		if err != nil {
+			return nil, err
+		}
+
+		field := e.r.wrap(option.optionField).(*MessageField)
+		data, err = e.r.appendOptionValue(data, field.Value(), field, field.Type(e.r), value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s: encode option %s", option.proto.Position, option.Name())
+		}
+	}
+	if len(data) == 0 {
+		return b, nil
+	}
+
+	return appendBytesField(b, number, data), nil
+}
+
+// location records SourceCodeInfo location of the element with the given path.
+func (e *descriptorEncoder) location(pos scanner.Position, comment, inline *proto.Comment, path ...int) {
+	if !e.sourceInfo {
+		return
+	}
+
+	var packed []byte
+	for _, p := range path {
+		packed = wire.AppendVarint(packed, uint64(p))
+	}
+
+	line := uint64(max(pos.Line-1, 0))
+	column := uint64(max(pos.Column-1, 0))
+	var span []byte
+	span = wire.AppendVarint(span, line)
+	span = wire.AppendVarint(span, column)
+	span = wire.AppendVarint(span, column)
+
+	var b []byte
+	b = appendBytesField(b, descLocationPath, packed)
+	b = appendBytesField(b, descLocationSpan, span)
+	if comment != nil {
+		b = appendStringField(b, descLocationLeadingComments, commentText(comment))
+	}
+	if inline != nil {
+		b = appendStringField(b, descLocationTrailingComments, commentText(inline))
+	}
+
+	e.locations = appendBytesField(e.locations, descSourceCodeInfoLocation, b)
+}
+
+// protoFileOf returns the file the element is defined in.
+func (r *Registry) protoFileOf(element proto.Visitee) *proto.Proto {
+	for {
+		switch v := element.(type) {
+		case *proto.Proto:
+			return v
+		case *proto.Message:
+			element = v.Parent
+		case *proto.Enum:
+			element = v.Parent
+		case *proto.Service:
+			element = v.Parent
+		case *proto.Oneof:
+			element = v.Parent
+		case *proto.NormalField:
+			element = v.Parent
+		case *proto.MapField:
+			element = v.Parent
+		case *proto.OneOfField:
+			element = v.Parent
+		case *proto.EnumField:
+			element = v.Parent
+		case *proto.RPC:
+			element = v.Parent
+		case *proto.Extensions:
+			element = v.Parent
+		case *proto.Option:
+			element = v.Parent
+		default:
+			panic(errors.Newf("unexpected element %T", element))
+		}
+	}
+}
+
+func descriptorFieldType(r *Registry, typ Type) (int, string) {
+	switch t := typ.(type) {
+	case *Double:
+		return descTypeDouble, ""
+	case *Float:
+		return descTypeFloat, ""
+	case *Int64:
+		return descTypeInt64, ""
+	case *Uint64:
+		return descTypeUint64, ""
+	case *Int32:
+		return descTypeInt32, ""
+	case *Fixed64:
+		return descTypeFixed64, ""
+	case *Fixed32:
+		return descTypeFixed32, ""
+	case *Bool:
+		return descTypeBool, ""
+	case *String:
+		return descTypeString, ""
+	case *Bytes:
+		return descTypeBytes, ""
+	case *Uint32:
+		return descTypeUint32, ""
+	case *Sfixed32:
+		return descTypeSfixed32, ""
+	case *Sfixed64:
+		return descTypeSfixed64, ""
+	case *Sint32:
+		return descTypeSint32, ""
+	case *Sint64:
+		return descTypeSint64, ""
+	case *Enum:
+		return descTypeEnum, r.NodeIndex(t)
+	case *Message:
+		return descTypeMessage, r.NodeIndex(t)
+	default:
+		panic(errors.Newf("unexpected field type %T", typ))
+	}
+}
+
+// descriptorDefault formats default value of the given type the way protoc does.
+func descriptorDefault(value any, typ Type) string {
+	switch v := value.(type) {
+	case int:
+		return strconv.Itoa(v)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case float64:
+		if _, ok := typ.(*Float); ok {
+			return descriptorFloat(float64(float32(v)), 32)
+		}
+		return descriptorFloat(v, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	case []byte:
+		return escapeBytes(v)
+	case *EnumValue:
+		return v.Name()
+	default:
+		panic(errors.Newf("unexpected default value type %T", value))
+	}
+}
+
+// descriptorFloat formats float default value like protoc: with %g of FLT_DIG or DBL_DIG
+// precision and with more digits only when these are not enough to get the value back.
+func descriptorFloat(v float64, bitSize int) string {
+	switch {
+	case math.IsNaN(v):
+		return "nan"
+	case math.IsInf(v, 1):
+		return "inf"
+	case math.IsInf(v, -1):
+		return "-inf"
+	}
+
+	short, long := 15, 17
+	if bitSize == 32 {
+		short, long = 6, 9
+	}
+	res := strconv.FormatFloat(v, 'g', short, bitSize)
+	if back, _ := strconv.ParseFloat(res, bitSize); back != v {
+		res = strconv.FormatFloat(v, 'g', long, bitSize)
+	}
+
+	return res
+}
+
+// escapeBytes escapes bytes the way protoc escapes bytes default values.
+func escapeBytes(v []byte) string {
+	var b strings.Builder
+	for _, c := range v {
+		switch c {
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\'':
+			b.WriteString(`\'`)
+		case '\\':
+			b.WriteString(`\\`)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				b.WriteByte('\\')
+				b.WriteByte('0' + c>>6)
+				b.WriteByte('0' + c>>3&7)
+				b.WriteByte('0' + c&7)
+				continue
+			}
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// syntheticOneofName returns a name of proto3 optional field oneof: the field name
+// prefixed with underscore and then with X until it does not collide with anything.
+func syntheticOneofName(msg *proto.Message, field string) string {
+	name := "_" + field
+	taken := map[string]bool{}
+	for _, element := range msg.Elements {
+		switch v := element.(type) {
+		case *proto.NormalField:
+			taken[v.Name] = true
+		case *proto.MapField:
+			taken[v.Name] = true
+		case *proto.Oneof:
+			taken[v.Name] = true
+		case *proto.Message:
+			taken[v.Name] = true
+		case *proto.Enum:
+			taken[v.Name] = true
+		}
+	}
+	for taken[name] {
+		name = "X" + name
+	}
+
+	return name
+}
+
+// descEditions maps supported editions to values of google.protobuf.Edition.
+var descEditions = map[string]int{
+	"proto2": descEditionProto2,
+	"proto3": descEditionProto3,
+	"2023":   descEdition2023,
+	"2024":   descEdition2024,
+}
+
+// descEditionNumber returns a value of google.protobuf.Edition for the edition. Editions
+// of loaded files are always supported ones.
+func descEditionNumber(edition string) int {
+	return descEditions[edition]
+}
+
+func commentText(comment *proto.Comment) string {
+	return strings.Join(comment.Lines, "\n") + "\n"
+}
+
+// descriptorFields collects encoded fields of a descriptor message by their numbers. Elements
+// of different kinds are interleaved in the source, while protoc writes fields in the order
+// of numbers.
+type descriptorFields map[int][]byte
+
+func (f descriptorFields) string(num int, v string) { f[num] = appendStringField(f[num], num, v) }
+func (f descriptorFields) bytes(num int, v []byte)  { f[num] = appendBytesField(f[num], num, v) }
+func (f descriptorFields) varint(num int, v uint64) { f[num] = appendVarintField(f[num], num, v) }
+
+// encode concatenates fields in the order of their numbers.
+func (f descriptorFields) encode() []byte {
+	var b []byte
+	for _, num := range slices.Sorted(maps.Keys(f)) {
+		b = append(b, f[num]...)
+	}
+
+	return b
+}
+
+func appendStringField(b []byte, num int, v string) []byte {
+	b = wire.AppendTag(b, num, wire.BytesType)
+	return wire.AppendString(b, v)
+}
+
+func appendBytesField(b []byte, num int, v []byte) []byte {
+	b = wire.AppendTag(b, num, wire.BytesType)
+	return wire.AppendBytes(b, v)
+}
+
+func appendVarintField(b []byte, num int, v uint64) []byte {
+	b = wire.AppendTag(b, num, wire.VarintType)
+	return wire.AppendVarint(b, v)
+}
@@ -0,0 +1,345 @@
+package core
+
+import (
+	"github.com/emicklei/proto"
+)
+
+// DescriptorPath returns a path of the node in terms of descriptor.proto, the one SourceCodeInfo
+// locations use. It is a sequence of field numbers and indices of repeated fields values, like
+// [4, 0, 2, 3] for the fourth field of the first message of a file. Paths of options end with the
+// option field number, like [4, 0, 7, 50001] for (my.option) of the first message.
+//
+// Reserved and extensions statements point to their first range or name. Nil is returned for nodes
+// having no descriptor counterpart, like types and extend blocks.
+func (r *Registry) DescriptorPath(node Node) []int {
+	switch n := node.(type) {
+	case *File:
+		return []int{}
+	case *Option:
+		return r.optionDescriptorPath(n)
+	case *Message, *MessageField, *OneOf, *OneOfBranch, *Enum, *EnumValue, *Service, *Method,
+		*Extensions, *Reserved, *Import, *Package, *Syntax, *Edition:
+		element := node.nodeProto()
+		container := descriptorContainer(element)
+		if container == nil {
+			return nil
+		}
+
+		prefix := r.DescriptorPath(r.wrap(container))
+		if prefix == nil {
+			return nil
+		}
+
+		for _, child := range r.descriptorChildren(container) {
+			if child.element != element {
+				continue
+			}
+
+			if child.index < 0 {
+				return append(prefix, child.number)
+			}
+			return append(prefix, child.number, child.index)
+		}
+		return nil
+	default:
+		return nil
+	}
+}
+
+// NodeByDescriptorPath returns a node of the file the path points to. Paths pointing inside of
+// an element, like [4, 0, 1] for the name of the first message, give the element itself. So do
+// paths of field default values and JSON names, these are not options despite the syntax. Nil is
+// returned if the path refers an element that does not exist.
+func (r *Registry) NodeByDescriptorPath(file *File, path []int) Node {
+	var current proto.Visitee = file.proto
+	for len(path) > 0 {
+		if number, ok := descriptorOptionsNumber(current); ok && path[0] == number {
+			if len(path) == 1 {
+				return r.wrap(current)
+			}
+			return r.descriptorOption(current, path[1])
+		}
+
+		var next *descriptorChild
+		children := r.descriptorChildren(current)
+		for i, child := range children {
+			if child.number != path[0] {
+				continue
+			}
+			if child.index < 0 || len(path) > 1 && child.index == path[1] {
+				next = &children[i]
+				break
+			}
+		}
+
+		if next == nil {
+			if descriptorHasChildren(current, path[0]) {
+				return nil
+			}
+
+			// The path points to an attribute of the current element.
+			return r.wrap(current)
+		}
+
+		current = next.element
+		path = path[1:]
+		if next.index >= 0 {
+			path = path[1:]
+		}
+	}
+
+	return r.wrap(current)
+}
+
+// optionDescriptorPath returns path of the option field in the options message of its owner.
+func (r *Registry) optionDescriptorPath(option *Option) []int {
+	owner := option.proto.Parent
+	number, ok := descriptorOptionsNumber(owner)
+	if !ok {
+		return nil
+	}
+
+	prefix := r.DescriptorPath(r.wrap(owner))
+	if prefix == nil {
+		return nil
+	}
+
+	return append(prefix, number, option.optionField.Sequence)
+}
+
+// descriptorOption looks for the option of the element set by the field with the given number.
+func (r *Registry) descriptorOption(owner proto.Visitee, number int) Node {
+	node, ok := r.wrap(owner).(NodeOptionable)
+	if !ok {
+		return nil
+	}
+
+	for option := range r.Options(node) {
+		if option.optionField.Sequence == number {
+			return option
+		}
+	}
+
+	return nil
+}
+
+// descriptorChild is an element represented by a value of a descriptor field.
+type descriptorChild struct {
+	number int
+
+	// index is an index of the value of repeated field, it is negative for singular fields.
+	index   int
+	element proto.Visitee
+}
+
+// descriptorChildren lists elements of the container in the order the descriptor has them.
+func (r *Registry) descriptorChildren(container proto.Visitee) []descriptorChild {
+	var res []descriptorChild
+	counters := map[int]int{}
+	add := func(number int, element proto.Visitee) {
+		res = append(res, descriptorChild{
+			number:  number,
+			index:   counters[number],
+			element: element,
+		})
+		counters[number]++
+	}
+	single := func(number int, element proto.Visitee) {
+		res = append(res, descriptorChild{
+			number:  number,
+			index:   -1,
+			element: element,
+		})
+	}
+	extensions := func(number int, extend *proto.Message) {
+		for _, element := range extend.Elements {
+			if field, ok := element.(*proto.NormalField); ok {
+				add(number, field)
+			}
+		}
+	}
+
+	switch c := container.(type) {
+	case *proto.Proto:
+		for _, element := range c.Elements {
+			switch v := element.(type) {
+			case *proto.Syntax:
+				single(descFileSyntax, v)
+			case *proto.Edition:
+				single(descFileEdition, v)
+			case *proto.Package:
+				single(descFilePackage, v)
+			case *proto.Import:
+				add(descFileDependency, v)
+			case *proto.Message:
+				if v.IsExtend {
+					extensions(descFileExtension, v)
+					continue
+				}
+				add(descFileMessageType, v)
+			case *proto.Enum:
+				add(descFileEnumType, v)
+			case *proto.Service:
+				add(descFileService, v)
+			}
+		}
+
+	case *proto.Message:
+		for _, element := range c.Elements {
+			switch v := element.(type) {
+			case *proto.NormalField:
+				add(descMessageField, v)
+			case *proto.MapField:
+				add(descMessageField, v)
+				add(descMessageNestedType, r.mapEntries[v])
+			case *proto.Oneof:
+				for _, item := range v.Elements {
+					if branch, ok := item.(*proto.OneOfField); ok {
+						add(descMessageField, branch)
+					}
+				}
+				add(descMessageOneofDecl, v)
+			case *proto.Message:
+				if v.IsExtend {
+					extensions(descMessageExtension, v)
+					continue
+				}
+				add(descMessageNestedType, v)
+			case *proto.Enum:
+				add(descMessageEnumType, v)
+			case *proto.Extensions:
+				for range v.Ranges {
+					add(descMessageExtensionRange, v)
+				}
+			case *proto.Reserved:
+				for range v.Ranges {
+					add(descMessageReservedRange, v)
+				}
+				for range v.FieldNames {
+					add(descMessageReservedName, v)
+				}
+			}
+		}
+
+	case *proto.Enum:
+		for _, element := range c.Elements {
+			switch v := element.(type) {
+			case *proto.EnumField:
+				add(descEnumValue, v)
+			case *proto.Reserved:
+				for range v.Ranges {
+					add(descEnumReservedRange, v)
+				}
+				for range v.FieldNames {
+					add(descEnumReservedName, v)
+				}
+			}
+		}
+
+	case *proto.Service:
+		for _, element := range c.Elements {
+			if v, ok := element.(*proto.RPC); ok {
+				add(descServiceMethod, v)
+			}
+		}
+	}
+
+	return res
+}
+
+// descriptorHasChildren checks if values of the field with the given number of the container are elements.
+func descriptorHasChildren(container proto.Visitee, number int) bool {
+	switch container.(type) {
+	case *proto.Proto:
+		switch number {
+		case descFilePackage, descFileDependency, descFileMessageType, descFileEnumType,
+			descFileService, descFileExtension, descFileSyntax, descFileEdition:
+			return true
+		}
+	case *proto.Message:
+		switch number {
+		case descMessageField, descMessageNestedType, descMessageEnumType, descMessageExtensionRange,
+			descMessageExtension, descMessageOneofDecl, descMessageReservedRange, descMessageReservedName:
+			return true
+		}
+	case *proto.Enum:
+		switch number {
+		case descEnumValue, descEnumReservedRange, descEnumReservedName:
+			return true
+		}
+	case *proto.Service:
+		return number == descServiceMethod
+	}
+
+	return false
+}
+
+// descriptorContainer returns an element having the given one in its descriptor.
+func descriptorContainer(element proto.Visitee) proto.Visitee {
+	switch v := element.(type) {
+	case *proto.Message:
+		return v.Parent
+	case *proto.NormalField:
+		if extend, ok := v.Parent.(*proto.Message); ok && extend.IsExtend {
+			return extend.Parent
+		}
+		return v.Parent
+	case *proto.MapField:
+		return v.Parent
+	case *proto.OneOfField:
+		if oneof, ok := v.Parent.(*proto.Oneof); ok {
+			return oneof.Parent
+		}
+		return nil
+	case *proto.Oneof:
+		return v.Parent
+	case *proto.Enum:
+		return v.Parent
+	case *proto.EnumField:
+		return v.Parent
+	case *proto.Service:
+		return v.Parent
+	case *proto.RPC:
+		return v.Parent
+	case *proto.Extensions:
+		return v.Parent
+	case *proto.Reserved:
+		return v.Parent
+	case *proto.Import:
+		return v.Parent
+	case *proto.Package:
+		return v.Parent
+	case *proto.Syntax:
+		return v.Parent
+	case *proto.Edition:
+		return v.Parent
+	default:
+		return nil
+	}
+}
+
+// descriptorOptionsNumber returns the number of options field of the element descriptor.
+func descriptorOptionsNumber(element proto.Visitee) (int, bool) {
+	switch element.(type) {
+	case *proto.Proto:
+		return descFileOptions, true
+	case *proto.Message:
+		return descMessageOptions, true
+	case *proto.NormalField, *proto.MapField, *proto.OneOfField:
+		return descFieldOptions, true
+	case *proto.Oneof:
+		return descOneofOptions, true
+	case *proto.Enum:
+		return descEnumOptions, true
+	case *proto.EnumField:
+		return descEnumValueOptions, true
+	case *proto.Service:
+		return descServiceOptions, true
+	case *proto.RPC:
+		return descMethodOptions, true
+	case *proto.Extensions:
+		return descRangeOptions, true
+	default:
+		return 0, false
+	}
+}
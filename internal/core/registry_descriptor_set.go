@@ -0,0 +1,1295 @@
+package core
+
+import (
+	_ "embed"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"github.com/emicklei/proto"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+	"github.com/sirkon/protoast/v2/internal/wire"
+)
+
+// descriptorProtoSource is used when a descriptor set does not have google/protobuf/descriptor.proto
+// itself, options cannot be interpreted without it.
+//
+//go:embed embedded/descriptor.proto
+var descriptorProtoSource []byte
+
+// NewRegistryFromDescriptorSet constructs a registry from encoded google.protobuf.FileDescriptorSet.
+// Files are represented the same way as parsed ones. Positions and comments are taken from
+// SourceCodeInfo if there is one, nodes only have file names in their positions otherwise.
+//
+// Every dependency of a file must be in the set, except google/protobuf/descriptor.proto.
+func NewRegistryFromDescriptorSet(data []byte) (*Registry, error) {
+	set, err := decodeDescriptorMessage(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode descriptor set")
+	}
+
+	r := newRegistry(nil)
+	var decoders []*descriptorDecoder
+	for _, b := range set.bytes(descFileSetFile) {
+		d := &descriptorDecoder{r: r}
+		file, err := d.file(b)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode file descriptor")
+		}
+		if _, ok := r.protos[file.Filename]; ok {
+			return nil, errors.Newf("duplicate file %s", file.Filename)
+		}
+
+		r.protos[file.Filename] = file
+		decoders = append(decoders, d)
+	}
+
+	if _, ok := r.protos[descriptorProtoPath]; !ok {
+		file, err := r.parseProtoFile(descriptorProtoSource, descriptorProtoPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse embedded "+descriptorProtoPath)
+		}
+		r.protos[descriptorProtoPath] = file
+		if err := r.demarkFile(descriptorProtoPath); err != nil {
+			return nil, errors.Wrap(err, "set up proto descriptor")
+		}
+	}
+
+	// Every file must be registered before options are decoded, they can use types of any of them.
+	for _, d := range decoders {
+		for _, element := range d.ast.Elements {
+			if imp, ok := element.(*proto.Import); ok {
+				if _, ok := r.protos[imp.Filename]; !ok {
+					return nil, errors.Newf("dependency %s of %s is missing", imp.Filename, d.ast.Filename)
+				}
+			}
+		}
+
+		d.ast.Accept(&visitorDemark{
+			r:    r,
+			file: d.ast,
+		})
+	}
+
+	o := &descriptorOptionsDecoder{r: r}
+	for _, d := range decoders {
+		for _, pending := range d.options {
+			if err := o.decode(pending); err != nil {
+				return nil, errors.Wrapf(err, "%s: decode options", pending.pos)
+			}
+		}
+		if err := checkFeatures(d.ast.Elements); err != nil {
+			return nil, errors.Wrap(err, "check features of "+d.ast.Filename)
+		}
+		r.indexOptions(d.ast)
+	}
+
+	return r, nil
+}
+
+// descriptorMessage is an encoded descriptor message with fields grouped by their numbers.
+type descriptorMessage map[int][]wire.Field
+
+func decodeDescriptorMessage(b []byte) (descriptorMessage, error) {
+	fields, err := wire.Fields(b)
+	if err != nil {
+		return nil, err
+	}
+
+	res := descriptorMessage{}
+	for _, field := range fields {
+		res[field.Number] = append(res[field.Number], field)
+	}
+
+	return res, nil
+}
+
+// has checks if the field is set.
+func (m descriptorMessage) has(num int) bool {
+	return len(m[num]) > 0
+}
+
+// string returns a value of the string field, the last one wins.
+func (m descriptorMessage) string(num int) string {
+	values := m.bytes(num)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return string(values[len(values)-1])
+}
+
+// bytes returns all values of the length delimited field.
+func (m descriptorMessage) bytes(num int) [][]byte {
+	var res [][]byte
+	for _, field := range m[num] {
+		if field.Type == wire.BytesType {
+			res = append(res, field.Value)
+		}
+	}
+
+	return res
+}
+
+// message returns a value of the message field, occurrences are concatenated as they are merged on decoding.
+func (m descriptorMessage) message(num int) []byte {
+	return slices.Concat(m.bytes(num)...)
+}
+
+// varint returns a value of the varint field, the last one wins.
+func (m descriptorMessage) varint(num int) uint64 {
+	values := m.varints(num)
+	if len(values) == 0 {
+		return 0
+	}
+
+	return values[len(values)-1]
+}
+
+// varints returns all values of the varint field, both packed and not.
+func (m descriptorMessage) varints(num int) []uint64 {
+	var res []uint64
+	for _, field := range m[num] {
+		switch field.Type {
+		case wire.VarintType:
+			v, _, _ := wire.ConsumeVarint(field.Value)
+			res = append(res, v)
+		case wire.BytesType:
+			for b := field.Value; len(b) > 0; {
+				v, n, err := wire.ConsumeVarint(b)
+				if err != nil {
+					break
+				}
+				res = append(res, v)
+				b = b[n:]
+			}
+		}
+	}
+
+	return res
+}
+
+// descriptorDecoder builds a file AST from its descriptor.
+type descriptorDecoder struct {
+	r         *Registry
+	ast       *proto.Proto
+	syntax    string
+	locations map[string]descriptorLocation
+	options   []descriptorPendingOptions
+}
+
+type descriptorLocation struct {
+	pos      scanner.Position
+	leading  *proto.Comment
+	trailing *proto.Comment
+}
+
+// descriptorPendingOptions are encoded options of an element. They are decoded once
+// all files are registered.
+type descriptorPendingOptions struct {
+	class  string
+	data   []byte
+	parent proto.Visitee
+	pos    scanner.Position
+	add    func(option *proto.Option)
+}
+
+func (d *descriptorDecoder) file(b []byte) (*proto.Proto, error) {
+	m, err := decodeDescriptorMessage(b)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &proto.Proto{
+		Filename: m.string(descFileName),
+	}
+	d.ast = file
+	if file.Filename == "" {
+		return nil, errors.New("file name is missing")
+	}
+
+	if m.has(descFileSourceCodeInfo) {
+		if err := d.sourceCodeInfo(m.message(descFileSourceCodeInfo)); err != nil {
+			return nil, errors.Wrap(err, file.Filename+": decode source code info")
+		}
+	}
+
+	d.syntax = m.string(descFileSyntax)
+	switch d.syntax {
+	case "":
+		d.syntax = "proto2"
+	case "editions":
+		edition, ok := descEditionName(int(m.varint(descFileEdition)))
+		if !ok || edition == "proto2" || edition == "proto3" {
+			return nil, errors.Newf("%s: unsupported edition %d", file.Filename, m.varint(descFileEdition))
+		}
+		file.Elements = append(file.Elements, &proto.Edition{
+			Position: d.location().pos,
+			Value:    edition,
+			Parent:   file,
+		})
+	case "proto2", "proto3":
+		file.Elements = append(file.Elements, &proto.Syntax{
+			Position: d.location().pos,
+			Value:    d.syntax,
+			Parent:   file,
+		})
+	default:
+		return nil, errors.Newf("%s: unsupported syntax %s", file.Filename, d.syntax)
+	}
+
+	if pkg := m.string(descFilePackage); pkg != "" {
+		loc := d.location(descFilePackage)
+		file.Elements = append(file.Elements, &proto.Package{
+			Position:      loc.pos,
+			Comment:       loc.leading,
+			Name:          pkg,
+			InlineComment: loc.trailing,
+			Parent:        file,
+		})
+	}
+
+	public := m.varints(descFilePublicDependency)
+	weak := m.varints(descFileWeakDependency)
+	for i, dep := range m.bytes(descFileDependency) {
+		loc := d.location(descFileDependency, i)
+		imp := &proto.Import{
+			Position:      loc.pos,
+			Comment:       loc.leading,
+			Filename:      string(dep),
+			InlineComment: loc.trailing,
+			Parent:        file,
+		}
+		switch {
+		case slices.Contains(public, uint64(i)):
+			imp.Kind = "public"
+		case slices.Contains(weak, uint64(i)):
+			imp.Kind = "weak"
+		}
+		file.Elements = append(file.Elements, imp)
+	}
+
+	d.pendingOptions(registryOptionsFile, m.message(descFileOptions), file, scanner.Position{Filename: file.Filename}, &file.Elements)
+
+	pkg := m.string(descFilePackage)
+	for i, data := range m.bytes(descFileMessageType) {
+		msg, err := d.message(data, file, pkg, []int{descFileMessageType, i})
+		if err != nil {
+			return nil, err
+		}
+		file.Elements = append(file.Elements, msg)
+	}
+	for i, data := range m.bytes(descFileEnumType) {
+		enum, err := d.enum(data, file, []int{descFileEnumType, i})
+		if err != nil {
+			return nil, err
+		}
+		file.Elements = append(file.Elements, enum)
+	}
+	for i, data := range m.bytes(descFileService) {
+		service, err := d.service(data, file, []int{descFileService, i})
+		if err != nil {
+			return nil, err
+		}
+		file.Elements = append(file.Elements, service)
+	}
+	extends, err := d.extensions(m.bytes(descFileExtension), file, []int{descFileExtension})
+	if err != nil {
+		return nil, err
+	}
+	file.Elements = append(file.Elements, extends...)
+
+	d.sortElements(file.Elements)
+	return file, nil
+}
+
+// message decodes message descriptor. Scope is a fully qualified name of the parent without a leading dot.
+func (d *descriptorDecoder) message(b []byte, parent proto.Visitee, scope string, path []int) (*proto.Message, error) {
+	m, err := decodeDescriptorMessage(b)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := d.location(path...)
+	msg := &proto.Message{
+		Position: loc.pos,
+		Comment:  loc.leading,
+		Name:     m.string(descMessageName),
+		Parent:   parent,
+	}
+	fullName := joinScope(scope, msg.Name)
+
+	// Map entries are not a part of the source, their fields turn into map fields instead.
+	nested := map[int]descriptorMessage{}
+	entries := map[string]descriptorMessage{}
+	for i, data := range m.bytes(descMessageNestedType) {
+		nm, err := decodeDescriptorMessage(data)
+		if err != nil {
+			return nil, err
+		}
+
+		options, err := decodeDescriptorMessage(nm.message(descMessageOptions))
+		if err != nil {
+			return nil, err
+		}
+		if options.varint(descMessageOptionsMapEntry) != 0 {
+			entries["."+joinScope(fullName, nm.string(descMessageName))] = nm
+			continue
+		}
+		nested[i] = nm
+	}
+
+	d.pendingOptions(registryOptionsMessage, m.message(descMessageOptions), msg, msg.Position, &msg.Elements)
+
+	fields := m.bytes(descMessageField)
+	oneofs := m.bytes(descMessageOneofDecl)
+	oneofElements := make([]*proto.Oneof, len(oneofs))
+	for i, data := range fields {
+		fm, err := decodeDescriptorMessage(data)
+		if err != nil {
+			return nil, err
+		}
+
+		fieldPath := append(slices.Clone(path), descMessageField, i)
+		field, err := d.field(fm, msg, fieldPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if fm.has(descFieldOneofIndex) && fm.varint(descFieldProto3Optional) == 0 {
+			index := int(fm.varint(descFieldOneofIndex))
+			if index >= len(oneofs) {
+				return nil, errors.Newf("%s: oneof index %d is out of range", field.Position, index)
+			}
+
+			oneof := oneofElements[index]
+			if oneof == nil {
+				if oneof, err = d.oneof(oneofs[index], msg, append(slices.Clone(path), descMessageOneofDecl, index)); err != nil {
+					return nil, err
+				}
+				oneofElements[index] = oneof
+				msg.Elements = append(msg.Elements, oneof)
+			}
+
+			field.Parent = oneof
+			branch := &proto.OneOfField{Field: field}
+			d.fieldOptions(fm, field, branch)
+			oneof.Elements = append(oneof.Elements, branch)
+			continue
+		}
+
+		label := fm.varint(descFieldLabel)
+		if entry, ok := entries[fm.string(descFieldTypeName)]; ok && label == descLabelRepeated {
+			mapField, err := d.mapField(field, entry)
+			if err != nil {
+				return nil, err
+			}
+			d.fieldOptions(fm, field, mapField)
+			msg.Elements = append(msg.Elements, mapField)
+			continue
+		}
+
+		normal := &proto.NormalField{
+			Field:    field,
+			Repeated: label == descLabelRepeated,
+			Required: label == descLabelRequired,
+			Optional: label == descLabelOptional && (d.syntax == "proto2" || fm.varint(descFieldProto3Optional) != 0),
+		}
+		d.fieldOptions(fm, field, normal)
+		msg.Elements = append(msg.Elements, normal)
+	}
+
+	// Oneofs without fields and synthetic ones of proto3 optional fields.
+	for i, data := range oneofs {
+		if oneofElements[i] != nil || isSyntheticOneof(fields, i) {
+			continue
+		}
+
+		oneof, err := d.oneof(data, msg, append(slices.Clone(path), descMessageOneofDecl, i))
+		if err != nil {
+			return nil, err
+		}
+		msg.Elements = append(msg.Elements, oneof)
+	}
+
+	for i, data := range m.bytes(descMessageNestedType) {
+		if _, ok := nested[i]; !ok {
+			continue
+		}
+
+		v, err := d.message(data, msg, fullName, append(slices.Clone(path), descMessageNestedType, i))
+		if err != nil {
+			return nil, err
+		}
+		msg.Elements = append(msg.Elements, v)
+	}
+
+	for i, data := range m.bytes(descMessageEnumType) {
+		v, err := d.enum(data, msg, append(slices.Clone(path), descMessageEnumType, i))
+		if err != nil {
+			return nil, err
+		}
+		msg.Elements = append(msg.Elements, v)
+	}
+
+	for i, data := range m.bytes(descMessageExtensionRange) {
+		rm, err := decodeDescriptorMessage(data)
+		if err != nil {
+			return nil, err
+		}
+
+		loc := d.location(append(slices.Clone(path), descMessageExtensionRange, i)...)
+		ext := &proto.Extensions{
+			Position:      loc.pos,
+			Comment:       loc.leading,
+			Ranges:        []proto.Range{messageRange(rm)},
+			InlineComment: loc.trailing,
+			Parent:        msg,
+		}
+		d.pendingOptions(registryOptionsExtensionRange, rm.message(descRangeOptions), ext, ext.Position, &ext.Options)
+		msg.Elements = append(msg.Elements, ext)
+	}
+
+	extends, err := d.extensions(m.bytes(descMessageExtension), msg, append(slices.Clone(path), descMessageExtension))
+	if err != nil {
+		return nil, err
+	}
+	msg.Elements = append(msg.Elements, extends...)
+
+	var ranges []proto.Range
+	for _, data := range m.bytes(descMessageReservedRange) {
+		rm, err := decodeDescriptorMessage(data)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, messageRange(rm))
+	}
+	msg.Elements = append(msg.Elements, d.reserved(msg, ranges, m.bytes(descMessageReservedName), path, descMessageReservedRange, descMessageReservedName)...)
+
+	d.sortElements(msg.Elements)
+	return msg, nil
+}
+
+// field decodes common field data: everything but the label and options.
+func (d *descriptorDecoder) field(m descriptorMessage, parent proto.Visitee, path []int) (*proto.Field, error) {
+	loc := d.location(path...)
+	field := &proto.Field{
+		Position:      loc.pos,
+		Comment:       loc.leading,
+		Name:          m.string(descFieldName),
+		Sequence:      int(m.varint(descFieldNumber)),
+		InlineComment: loc.trailing,
+		Parent:        parent,
+	}
+
+	typ, ok := descriptorTypeName(m)
+	if !ok {
+		return nil, errors.Newf("%s: unsupported type %d of field %s", field.Position, m.varint(descFieldType), field.Name)
+	}
+	field.Type = typ
+
+	return field, nil
+}
+
+// fieldOptions adds options of the field to the element owning it: a normal, map or oneof field.
+func (d *descriptorDecoder) fieldOptions(m descriptorMessage, field *proto.Field, owner proto.Visitee) {
+	if m.has(descFieldDefaultValue) {
+		value := m.string(descFieldDefaultValue)
+		literal := proto.Literal{
+			Position: field.Position,
+			Source:   value,
+		}
+		switch m.varint(descFieldType) {
+		case descTypeString:
+			literal.Source = escapeBytes([]byte(value))
+			literal.IsString = true
+			literal.QuoteRune = '"'
+		case descTypeBytes:
+			literal.IsString = true
+			literal.QuoteRune = '"'
+		}
+		field.Options = append(field.Options, &proto.Option{
+			Position: field.Position,
+			Name:     "default",
+			Constant: literal,
+			Parent:   owner,
+		})
+	}
+
+	if m.has(descFieldJSONName) {
+		if name := m.string(descFieldJSONName); name != jsonName(field.Name) {
+			field.Options = append(field.Options, &proto.Option{
+				Position: field.Position,
+				Name:     "json_name",
+				Constant: proto.Literal{
+					Position:  field.Position,
+					Source:    escapeBytes([]byte(name)),
+					IsString:  true,
+					QuoteRune: '"',
+				},
+				Parent: owner,
+			})
+		}
+	}
+
+	d.pendingOptions(registryOptionsMessageField, m.message(descFieldOptions), owner, field.Position, &field.Options)
+}
+
+// mapField turns a repeated field of map entry type into a map field.
+func (d *descriptorDecoder) mapField(field *proto.Field, entry descriptorMessage) (*proto.MapField, error) {
+	res := &proto.MapField{Field: field}
+	for _, data := range entry.bytes(descMessageField) {
+		fm, err := decodeDescriptorMessage(data)
+		if err != nil {
+			return nil, err
+		}
+
+		typ, ok := descriptorTypeName(fm)
+		if !ok {
+			return nil, errors.Newf("%s: unsupported map %s type %d", field.Position, field.Name, fm.varint(descFieldType))
+		}
+
+		switch fm.varint(descFieldNumber) {
+		case 1:
+			res.KeyType = typ
+		case 2:
+			field.Type = typ
+		}
+	}
+
+	return res, nil
+}
+
+func (d *descriptorDecoder) oneof(b []byte, parent proto.Visitee, path []int) (*proto.Oneof, error) {
+	m, err := decodeDescriptorMessage(b)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := d.location(path...)
+	oneof := &proto.Oneof{
+		Position: loc.pos,
+		Comment:  loc.leading,
+		Name:     m.string(descOneofName),
+		Parent:   parent,
+	}
+	d.pendingOptions(registryOptionsOneof, m.message(descOneofOptions), oneof, oneof.Position, &oneof.Elements)
+
+	return oneof, nil
+}
+
+// extensions decodes extension fields grouping them into extend blocks of consecutive fields with the same extendee.
+func (d *descriptorDecoder) extensions(fields [][]byte, parent proto.Visitee, path []int) ([]proto.Visitee, error) {
+	var res []proto.Visitee
+	var extend *proto.Message
+	for i, data := range fields {
+		m, err := decodeDescriptorMessage(data)
+		if err != nil {
+			return nil, err
+		}
+
+		extendee := m.string(descFieldExtendee)
+		if extend == nil || extend.Name != extendee {
+			extend = &proto.Message{
+				Position: d.location(append(slices.Clone(path), i)...).pos,
+				Name:     extendee,
+				IsExtend: true,
+				Parent:   parent,
+			}
+			res = append(res, extend)
+		}
+
+		field, err := d.field(m, extend, append(slices.Clone(path), i))
+		if err != nil {
+			return nil, err
+		}
+
+		label := m.varint(descFieldLabel)
+		normal := &proto.NormalField{
+			Field:    field,
+			Repeated: label == descLabelRepeated,
+			Required: label == descLabelRequired,
+			Optional: label == descLabelOptional && d.syntax == "proto2",
+		}
+		d.fieldOptions(m, field, normal)
+		extend.Elements = append(extend.Elements, normal)
+	}
+
+	return res, nil
+}
+
+func (d *descriptorDecoder) enum(b []byte, parent proto.Visitee, path []int) (*proto.Enum, error) {
+	m, err := decodeDescriptorMessage(b)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := d.location(path...)
+	enum := &proto.Enum{
+		Position: loc.pos,
+		Comment:  loc.leading,
+		Name:     m.string(descEnumName),
+		Parent:   parent,
+	}
+	d.pendingOptions(registryOptionsEnum, m.message(descEnumOptions), enum, enum.Position, &enum.Elements)
+
+	for i, data := range m.bytes(descEnumValue) {
+		vm, err := decodeDescriptorMessage(data)
+		if err != nil {
+			return nil, err
+		}
+
+		loc := d.location(append(slices.Clone(path), descEnumValue, i)...)
+		value := &proto.EnumField{
+			Position:      loc.pos,
+			Comment:       loc.leading,
+			Name:          vm.string(descEnumValueName),
+			Integer:       int(int32(vm.varint(descEnumValueNumber))),
+			InlineComment: loc.trailing,
+			Parent:        enum,
+		}
+		d.pendingOptions(registryOptionsEnumValue, vm.message(descEnumValueOptions), value, value.Position, &value.Elements)
+		enum.Elements = append(enum.Elements, value)
+	}
+
+	var ranges []proto.Range
+	for _, data := range m.bytes(descEnumReservedRange) {
+		rm, err := decodeDescriptorMessage(data)
+		if err != nil {
+			return nil, err
+		}
+
+		rng := proto.Range{
+			From: int(int32(rm.varint(descRangeStart))),
+			To:   int(int32(rm.varint(descRangeEnd))),
+		}
+		if rng.To == descMaxEnumNumber {
+			rng.Max = true
+		}
+		ranges = append(ranges, rng)
+	}
+	enum.Elements = append(enum.Elements, d.reserved(enum, ranges, m.bytes(descEnumReservedName), path, descEnumReservedRange, descEnumReservedName)...)
+
+	d.sortElements(enum.Elements)
+	return enum, nil
+}
+
+func (d *descriptorDecoder) service(b []byte, parent proto.Visitee, path []int) (*proto.Service, error) {
+	m, err := decodeDescriptorMessage(b)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := d.location(path...)
+	service := &proto.Service{
+		Position: loc.pos,
+		Comment:  loc.leading,
+		Name:     m.string(descServiceName),
+		Parent:   parent,
+	}
+	d.pendingOptions(registryOptionsService, m.message(descServiceOptions), service, service.Position, &service.Elements)
+
+	for i, data := range m.bytes(descServiceMethod) {
+		mm, err := decodeDescriptorMessage(data)
+		if err != nil {
+			return nil, err
+		}
+
+		loc := d.location(append(slices.Clone(path), descServiceMethod, i)...)
+		rpc := &proto.RPC{
+			Position:       loc.pos,
+			Comment:        loc.leading,
+			Name:           mm.string(descMethodName),
+			RequestType:    mm.string(descMethodInputType),
+			StreamsRequest: mm.varint(descMethodClientStreaming) != 0,
+			ReturnsType:    mm.string(descMethodOutputType),
+			StreamsReturns: mm.varint(descMethodServerStreaming) != 0,
+			InlineComment:  loc.trailing,
+			Parent:         service,
+		}
+		d.pendingOptions(registryOptionsMethod, mm.message(descMethodOptions), rpc, rpc.Position, &rpc.Elements)
+		service.Elements = append(service.Elements, rpc)
+	}
+
+	d.sortElements(service.Elements)
+	return service, nil
+}
+
+// reserved builds reserved statements. Ranges and names having the same position come from the same
+// statement, thus are grouped. Everything goes into two statements without source code info.
+func (d *descriptorDecoder) reserved(
+	parent proto.Visitee,
+	ranges []proto.Range,
+	names [][]byte,
+	path []int,
+	rangesNumber int,
+	namesNumber int,
+) []proto.Visitee {
+	var res []proto.Visitee
+	var last *proto.Reserved
+	next := func(loc descriptorLocation) *proto.Reserved {
+		if last != nil && last.Position == loc.pos {
+			return last
+		}
+
+		last = &proto.Reserved{
+			Position:      loc.pos,
+			Comment:       loc.leading,
+			InlineComment: loc.trailing,
+			Parent:        parent,
+		}
+		res = append(res, last)
+		return last
+	}
+
+	for i, rng := range ranges {
+		reserved := next(d.location(append(slices.Clone(path), rangesNumber, i)...))
+		reserved.Ranges = append(reserved.Ranges, rng)
+	}
+	last = nil
+	for i, name := range names {
+		reserved := next(d.location(append(slices.Clone(path), namesNumber, i)...))
+		reserved.FieldNames = append(reserved.FieldNames, string(name))
+	}
+
+	return res
+}
+
+// pendingOptions postpones decoding of encoded options.
+func (d *descriptorDecoder) pendingOptions(class string, data []byte, parent proto.Visitee, pos scanner.Position, options any) {
+	if len(data) == 0 {
+		return
+	}
+
+	var add func(option *proto.Option)
+	switch v := options.(type) {
+	case *[]proto.Visitee:
+		add = func(option *proto.Option) {
+			*v = append(*v, option)
+		}
+	case *[]*proto.Option:
+		add = func(option *proto.Option) {
+			*v = append(*v, option)
+		}
+	default:
+		panic(errors.Newf("unexpected options container %T", options))
+	}
+
+	d.options = append(d.options, descriptorPendingOptions{
+		class:  class,
+		data:   data,
+		parent: parent,
+		pos:    pos,
+		add:    add,
+	})
+}
+
+func (d *descriptorDecoder) sourceCodeInfo(b []byte) error {
+	m, err := decodeDescriptorMessage(b)
+	if err != nil {
+		return err
+	}
+
+	d.locations = map[string]descriptorLocation{}
+	for _, data := range m.bytes(descSourceCodeInfoLocation) {
+		lm, err := decodeDescriptorMessage(data)
+		if err != nil {
+			return err
+		}
+
+		var components []int
+		for _, p := range lm.varints(descLocationPath) {
+			components = append(components, int(int32(p)))
+		}
+		path := descriptorPathKey(components)
+		if _, ok := d.locations[path]; ok {
+			continue
+		}
+
+		span := lm.varints(descLocationSpan)
+		if len(span) < 3 {
+			continue
+		}
+
+		loc := descriptorLocation{
+			pos: scanner.Position{
+				Filename: d.ast.Filename,
+				Line:     int(span[0]) + 1,
+				Column:   int(span[1]) + 1,
+			},
+		}
+		if lm.has(descLocationLeadingComments) {
+			loc.leading = descriptorComment(loc.pos, lm.string(descLocationLeadingComments))
+		}
+		if lm.has(descLocationTrailingComments) {
+			loc.trailing = descriptorComment(loc.pos, lm.string(descLocationTrailingComments))
+		}
+		d.locations[path] = loc
+	}
+
+	return nil
+}
+
+// location returns the location of the element with the given path. It only has
+// the file name if there is no source code info.
+func (d *descriptorDecoder) location(path ...int) descriptorLocation {
+	if loc, ok := d.locations[descriptorPathKey(path)]; ok {
+		return loc
+	}
+
+	return descriptorLocation{
+		pos: scanner.Position{Filename: d.ast.Filename},
+	}
+}
+
+// sortElements restores the source order of elements if their positions are known.
+func (d *descriptorDecoder) sortElements(elements []proto.Visitee) {
+	if d.locations == nil {
+		return
+	}
+
+	slices.SortStableFunc(elements, func(a, b proto.Visitee) int {
+		pa, pb := elementPosition(a), elementPosition(b)
+		if pa.Line != pb.Line {
+			return pa.Line - pb.Line
+		}
+		return pa.Column - pb.Column
+	})
+}
+
+// descriptorOptionsDecoder turns encoded options into option statements.
+type descriptorOptionsDecoder struct {
+	r *Registry
+
+	// extensions are extension fields by extendee names and numbers.
+	extensions map[string]map[int]*proto.NormalField
+}
+
+func (o *descriptorOptionsDecoder) decode(pending descriptorPendingOptions) error {
+	class, ok := o.r.registry[pending.class].(*proto.Message)
+	if !ok {
+		return errors.Newf("unknown options message %s", pending.class)
+	}
+
+	msg := o.r.wrap(class).(*Message)
+	numbers, values, err := groupWireFields(pending.data)
+	if err != nil {
+		return err
+	}
+
+	for _, num := range numbers {
+		field, typ, ext := o.field(msg, num)
+		if field == nil {
+			// Options unknown to the descriptor.proto in use are skipped, like unknown fields are.
+			continue
+		}
+
+		literal, err := o.literal(typ, values[num])
+		if err != nil {
+			return errors.Wrapf(err, "decode option %d", num)
+		}
+		literal.Position = pending.pos
+
+		name := fieldNodeName(field)
+		if ext {
+			name = "(" + strings.TrimPrefix(o.r.NodeIndex(field), ".") + ")"
+		}
+		pending.add(&proto.Option{
+			Position: pending.pos,
+			Name:     name,
+			Constant: *literal,
+			Parent:   pending.parent,
+		})
+	}
+
+	return nil
+}
+
+// field looks for a message field, oneof branch or extension with the given number.
+func (o *descriptorOptionsDecoder) field(msg *Message, num int) (Node, Type, bool) {
+	r := o.r
+	for field := range msg.Fields(r) {
+		oneof, ok := field.Type(r).(*OneOf)
+		if !ok {
+			if field.Value() == num {
+				return field, field.Type(r), false
+			}
+			continue
+		}
+
+		for branch := range oneof.Branches(r) {
+			if branch.Value() == num {
+				return branch, branch.Type(r), false
+			}
+		}
+	}
+
+	if o.extensions == nil {
+		o.extensions = map[string]map[int]*proto.NormalField{}
+		for _, element := range r.registry {
+			field, ok := element.(*proto.NormalField)
+			if !ok {
+				continue
+			}
+			extendee, ok := r.extendee(field)
+			if !ok {
+				continue
+			}
+			if o.extensions[extendee] == nil {
+				o.extensions[extendee] = map[int]*proto.NormalField{}
+			}
+			o.extensions[extendee][field.Sequence] = field
+		}
+	}
+
+	if ext, ok := o.extensions[r.NodeIndex(msg)][num]; ok {
+		field := r.wrap(ext).(*MessageField)
+		return field, field.Type(r), true
+	}
+
+	return nil, nil, false
+}
+
+// literal converts encoded values of a field into a literal the way it is written in option statements.
+func (o *descriptorOptionsDecoder) literal(typ Type, values []wire.Field) (*proto.Literal, error) {
+	r := o.r
+	switch t := typ.(type) {
+	case *Repeated:
+		res := &proto.Literal{Array: []*proto.Literal{}}
+		for _, value := range values {
+			items := []wire.Field{value}
+			if wt, ok := scalarWireType(t.Type); ok && wt != wire.BytesType && value.Type == wire.BytesType {
+				var err error
+				if items, err = unpackWireValues(value, wt); err != nil {
+					return nil, err
+				}
+			}
+
+			for _, item := range items {
+				literal, err := o.literal(t.Type, []wire.Field{item})
+				if err != nil {
+					return nil, err
+				}
+				res.Array = append(res.Array, literal)
+			}
+		}
+		return res, nil
+
+	case *Map:
+		return o.literal(&Repeated{Type: t.Entry(r)}, values)
+
+	case *Message:
+		var data []byte
+		for _, value := range values {
+			if value.Type != wire.BytesType {
+				return nil, errors.Newf("unexpected wire type %d for %s", value.Type, r.TypeName(t))
+			}
+			data = append(data, value.Value...)
+		}
+
+		numbers, fields, err := groupWireFields(data)
+		if err != nil {
+			return nil, err
+		}
+
+		res := &proto.Literal{}
+		for _, num := range numbers {
+			field, typ, ext := o.field(t, num)
+			if field == nil {
+				continue
+			}
+
+			literal, err := o.literal(typ, fields[num])
+			if err != nil {
+				return nil, errors.Wrapf(err, "decode %s field %d", r.TypeName(t), num)
+			}
+
+			name := fieldNodeName(field)
+			if ext {
+				name = strings.TrimPrefix(r.NodeIndex(field), ".")
+			}
+			res.OrderedMap = append(res.OrderedMap, &proto.NamedLiteral{
+				Literal:     literal,
+				Name:        name,
+				PrintsColon: true,
+			})
+		}
+		return res, nil
+
+	default:
+		if len(values) == 0 {
+			return nil, errors.Newf("no value for %s", r.TypeName(typ))
+		}
+		return o.scalar(typ, values[len(values)-1])
+	}
+}
+
+// scalar converts encoded scalar value into a literal.
+func (o *descriptorOptionsDecoder) scalar(typ Type, value wire.Field) (*proto.Literal, error) {
+	wt, _ := scalarWireType(typ)
+	if value.Type != wt {
+		return nil, errors.Newf("unexpected wire type %d for %s", value.Type, o.r.TypeName(typ))
+	}
+
+	var v uint64
+	switch wt {
+	case wire.VarintType:
+		v, _, _ = wire.ConsumeVarint(value.Value)
+	case wire.Fixed32Type:
+		v32, _, _ := wire.ConsumeFixed32(value.Value)
+		v = uint64(v32)
+	case wire.Fixed64Type:
+		v, _, _ = wire.ConsumeFixed64(value.Value)
+	case wire.BytesType:
+		return &proto.Literal{
+			Source:    escapeBytes(value.Value),
+			IsString:  true,
+			QuoteRune: '"',
+		}, nil
+	}
+
+	var source string
+	switch t := typ.(type) {
+	case *Int32, *Sfixed32:
+		source = strconv.FormatInt(int64(int32(v)), 10)
+	case *Int64, *Sfixed64:
+		source = strconv.FormatInt(int64(v), 10)
+	case *Sint32, *Sint64:
+		source = strconv.FormatInt(wire.DecodeZigZag(v), 10)
+	case *Uint32, *Uint64, *Fixed32, *Fixed64:
+		source = strconv.FormatUint(v, 10)
+	case *Bool:
+		source = strconv.FormatBool(v != 0)
+	case *Float:
+		source = formatFloatLiteral(float64(wire.Float32(uint32(v))), 32)
+	case *Double:
+		source = formatFloatLiteral(wire.Float64(v), 64)
+	case *Enum:
+		source = strconv.FormatInt(int64(int32(v)), 10)
+		if value := t.ValueByNumber(o.r, int(int32(v))); value != nil {
+			source = value.Name()
+		}
+	}
+
+	return &proto.Literal{Source: source}, nil
+}
+
+// groupWireFields decodes fields grouping them by numbers. Numbers are returned in the order of their first appearance.
+func groupWireFields(data []byte) ([]int, map[int][]wire.Field, error) {
+	fields, err := wire.Fields(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var numbers []int
+	res := map[int][]wire.Field{}
+	for _, field := range fields {
+		if _, ok := res[field.Number]; !ok {
+			numbers = append(numbers, field.Number)
+		}
+		res[field.Number] = append(res[field.Number], field)
+	}
+
+	return numbers, res, nil
+}
+
+// unpackWireValues splits packed values of the given wire type.
+func unpackWireValues(value wire.Field, typ wire.Type) ([]wire.Field, error) {
+	var res []wire.Field
+	for b := value.Value; len(b) > 0; {
+		n, err := wire.ConsumeFieldValue(value.Number, typ, b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unpack field %d", value.Number)
+		}
+
+		res = append(res, wire.Field{
+			Number: value.Number,
+			Type:   typ,
+			Value:  b[:n],
+		})
+		b = b[n:]
+	}
+
+	return res, nil
+}
+
+func fieldNodeName(field Node) string {
+	switch f := field.(type) {
+	case *MessageField:
+		return f.Name()
+	case *OneOfBranch:
+		return f.Name()
+	default:
+		panic(errors.Newf("unexpected field node %T", field))
+	}
+}
+
+// descriptorTypeName returns a type of the field as it is written in the source.
+func descriptorTypeName(m descriptorMessage) (string, bool) {
+	switch m.varint(descFieldType) {
+	case descTypeDouble:
+		return "double", true
+	case descTypeFloat:
+		return "float", true
+	case descTypeInt64:
+		return "int64", true
+	case descTypeUint64:
+		return "uint64", true
+	case descTypeInt32:
+		return "int32", true
+	case descTypeFixed64:
+		return "fixed64", true
+	case descTypeFixed32:
+		return "fixed32", true
+	case descTypeBool:
+		return "bool", true
+	case descTypeString:
+		return "string", true
+	case descTypeBytes:
+		return "bytes", true
+	case descTypeUint32:
+		return "uint32", true
+	case descTypeSfixed32:
+		return "sfixed32", true
+	case descTypeSfixed64:
+		return "sfixed64", true
+	case descTypeSint32:
+		return "sint32", true
+	case descTypeSint64:
+		return "sint64", true
+	case descTypeMessage, descTypeEnum:
+		return m.string(descFieldTypeName), true
+	case 0:
+		// The type can be omitted when it is resolved by a type name.
+		name := m.string(descFieldTypeName)
+		return name, name != ""
+	default:
+		return "", false
+	}
+}
+
+// isSyntheticOneof checks if a oneof with the given index only has proto3 optional fields.
+func isSyntheticOneof(fields [][]byte, index int) bool {
+	var found bool
+	for _, data := range fields {
+		m, err := decodeDescriptorMessage(data)
+		if err != nil || !m.has(descFieldOneofIndex) || int(m.varint(descFieldOneofIndex)) != index {
+			continue
+		}
+		if m.varint(descFieldProto3Optional) == 0 {
+			return false
+		}
+		found = true
+	}
+
+	return found
+}
+
+func messageRange(m descriptorMessage) proto.Range {
+	rng := proto.Range{
+		From: int(m.varint(descRangeStart)),
+		To:   int(m.varint(descRangeEnd)) - 1,
+	}
+	if rng.To+1 >= descMaxMessageNumber {
+		rng.Max = true
+	}
+
+	return rng
+}
+
+func descriptorComment(pos scanner.Position, text string) *proto.Comment {
+	return &proto.Comment{
+		Position: pos,
+		Lines:    strings.Split(strings.TrimSuffix(text, "\n"), "\n"),
+	}
+}
+
+func descriptorPathKey(path []int) string {
+	var b strings.Builder
+	for i, p := range path {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Itoa(p))
+	}
+
+	return b.String()
+}
+
+// descEditionName returns the name of a supported google.protobuf.Edition value.
+func descEditionName(edition int) (string, bool) {
+	for name, number := range descEditions {
+		if number == edition {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+func joinScope(scope, name string) string {
+	switch {
+	case scope == "":
+		return name
+	case name == "":
+		return scope
+	default:
+		return scope + "." + name
+	}
+}
+
+// formatFloatLiteral formats floating point value the way it is written in the source.
+func formatFloatLiteral(v float64, bitSize int) string {
+	switch {
+	case math.IsNaN(v):
+		return "nan"
+	case math.IsInf(v, 1):
+		return "inf"
+	case math.IsInf(v, -1):
+		return "-inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, bitSize)
+	}
+}
+
+func elementPosition(element proto.Visitee) scanner.Position {
+	switch v := element.(type) {
+	case *proto.Syntax:
+		return v.Position
+	case *proto.Edition:
+		return v.Position
+	case *proto.Package:
+		return v.Position
+	case *proto.Import:
+		return v.Position
+	case *proto.Option:
+		return v.Position
+	case *proto.Message:
+		return v.Position
+	case *proto.NormalField:
+		return v.Position
+	case *proto.MapField:
+		return v.Position
+	case *proto.Oneof:
+		return v.Position
+	case *proto.OneOfField:
+		return v.Position
+	case *proto.Enum:
+		return v.Position
+	case *proto.EnumField:
+		return v.Position
+	case *proto.Service:
+		return v.Position
+	case *proto.RPC:
+		return v.Position
+	case *proto.Reserved:
+		return v.Position
+	case *proto.Extensions:
+		return v.Position
+	default:
+		return scanner.Position{}
+	}
+}
@@ -0,0 +1,314 @@
+package core
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/emicklei/proto"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+)
+
+// Features represents resolved google.protobuf.FeatureSet of a node.
+type Features struct {
+	FieldPresence         FeatureFieldPresence
+	EnumType              FeatureEnumType
+	RepeatedFieldEncoding FeatureRepeatedFieldEncoding
+	UTF8Validation        FeatureUTF8Validation
+	MessageEncoding       FeatureMessageEncoding
+	JSONFormat            FeatureJSONFormat
+}
+
+// FeatureFieldPresence mirrors google.protobuf.FeatureSet.FieldPresence.
+type FeatureFieldPresence int
+
+// FeatureEnumType mirrors google.protobuf.FeatureSet.EnumType.
+type FeatureEnumType int
+
+// FeatureRepeatedFieldEncoding mirrors google.protobuf.FeatureSet.RepeatedFieldEncoding.
+type FeatureRepeatedFieldEncoding int
+
+// FeatureUTF8Validation mirrors google.protobuf.FeatureSet.Utf8Validation.
+type FeatureUTF8Validation int
+
+// FeatureMessageEncoding mirrors google.protobuf.FeatureSet.MessageEncoding.
+type FeatureMessageEncoding int
+
+// FeatureJSONFormat mirrors google.protobuf.FeatureSet.JsonFormat.
+type FeatureJSONFormat int
+
+const (
+	FieldPresenceUnknown        FeatureFieldPresence = 0
+	FieldPresenceExplicit       FeatureFieldPresence = 1
+	FieldPresenceImplicit       FeatureFieldPresence = 2
+	FieldPresenceLegacyRequired FeatureFieldPresence = 3
+)
+
+const (
+	EnumTypeUnknown FeatureEnumType = 0
+	EnumTypeOpen    FeatureEnumType = 1
+	EnumTypeClosed  FeatureEnumType = 2
+)
+
+const (
+	RepeatedFieldEncodingUnknown  FeatureRepeatedFieldEncoding = 0
+	RepeatedFieldEncodingPacked   FeatureRepeatedFieldEncoding = 1
+	RepeatedFieldEncodingExpanded FeatureRepeatedFieldEncoding = 2
+)
+
+const (
+	UTF8ValidationUnknown FeatureUTF8Validation = 0
+	UTF8ValidationVerify  FeatureUTF8Validation = 2
+	UTF8ValidationNone    FeatureUTF8Validation = 3
+)
+
+const (
+	MessageEncodingUnknown        FeatureMessageEncoding = 0
+	MessageEncodingLengthPrefixed FeatureMessageEncoding = 1
+	MessageEncodingDelimited      FeatureMessageEncoding = 2
+)
+
+const (
+	JSONFormatUnknown          FeatureJSONFormat = 0
+	JSONFormatAllow            FeatureJSONFormat = 1
+	JSONFormatLegacyBestEffort FeatureJSONFormat = 2
+)
+
+// Features returns effective features of the node. They are edition defaults of the node's
+// file overridden by features set on the file and then on every scope down to the node itself.
+// Features of proto2 and proto3 files are inferred from their syntax the way protoc does it:
+// required fields, proto3 optional fields and packed options are taken into account.
+func (r *Registry) Features(node Node) *Features {
+	nodes := slices.Collect(r.NodeHierarchy(node))
+	file, ok := nodes[len(nodes)-1].(*File)
+	if !ok {
+		panic(errors.Newf("node %T is not bound to a file", node))
+	}
+
+	edition := file.Edition()
+	res := editionFeatures(edition)
+	for i := len(nodes) - 1; i >= 0; i-- {
+		for _, option := range nodeOptions(nodes[i]) {
+			// Feature values are checked when files are loaded.
+			_ = res.setFromOption(option)
+		}
+	}
+
+	if v, ok := node.(*MessageField); ok {
+		if field, ok := v.proto.(*proto.NormalField); ok {
+			res.inferLegacy(edition, field)
+		}
+	}
+
+	return &res
+}
+
+func editionFeatures(edition string) Features {
+	switch edition {
+	case "proto2":
+		return Features{
+			FieldPresence:         FieldPresenceExplicit,
+			EnumType:              EnumTypeClosed,
+			RepeatedFieldEncoding: RepeatedFieldEncodingExpanded,
+			UTF8Validation:        UTF8ValidationNone,
+			MessageEncoding:       MessageEncodingLengthPrefixed,
+			JSONFormat:            JSONFormatLegacyBestEffort,
+		}
+	case "proto3":
+		return Features{
+			FieldPresence:         FieldPresenceImplicit,
+			EnumType:              EnumTypeOpen,
+			RepeatedFieldEncoding: RepeatedFieldEncodingPacked,
+			UTF8Validation:        UTF8ValidationVerify,
+			MessageEncoding:       MessageEncodingLengthPrefixed,
+			JSONFormat:            JSONFormatAllow,
+		}
+	case "2023", "2024":
+		return Features{
+			FieldPresence:         FieldPresenceExplicit,
+			EnumType:              EnumTypeOpen,
+			RepeatedFieldEncoding: RepeatedFieldEncodingPacked,
+			UTF8Validation:        UTF8ValidationVerify,
+			MessageEncoding:       MessageEncodingLengthPrefixed,
+			JSONFormat:            JSONFormatAllow,
+		}
+	default:
+		// Editions are checked when files are loaded.
+		panic(errors.Newf("unsupported edition %s", edition))
+	}
+}
+
+// checkEdition validates syntax or edition declaration of the file.
+func checkEdition(elements []proto.Visitee) error {
+	for _, element := range elements {
+		switch v := element.(type) {
+		case *proto.Syntax:
+			if v.Value != "proto2" && v.Value != "proto3" {
+				return errors.Newf("%s: unsupported syntax %s", v.Position, v.Value)
+			}
+		case *proto.Edition:
+			if v.Value != "2023" && v.Value != "2024" {
+				return errors.Newf("%s: unsupported edition %s", v.Position, v.Value)
+			}
+		}
+	}
+
+	return nil
+}
+
+// setFromOption applies both `features.field_presence = IMPLICIT` and
+// `features = { field_presence: IMPLICIT }` forms of setting features.
+func (f *Features) setFromOption(option *proto.Option) error {
+	switch {
+	case option.Name == "features":
+		for _, item := range option.Constant.OrderedMap {
+			if err := f.set(item.Name, item.Source); err != nil {
+				return err
+			}
+		}
+	case strings.HasPrefix(option.Name, "features."):
+		return f.set(strings.TrimPrefix(option.Name, "features."), option.Constant.Source)
+	}
+
+	return nil
+}
+
+func (f *Features) set(name, value string) error {
+	var err error
+	switch name {
+	case "field_presence":
+		f.FieldPresence, err = parseFeature(name, value, fieldPresenceNames)
+	case "enum_type":
+		f.EnumType, err = parseFeature(name, value, enumTypeNames)
+	case "repeated_field_encoding":
+		f.RepeatedFieldEncoding, err = parseFeature(name, value, repeatedFieldEncodingNames)
+	case "utf8_validation":
+		f.UTF8Validation, err = parseFeature(name, value, utf8ValidationNames)
+	case "message_encoding":
+		f.MessageEncoding, err = parseFeature(name, value, messageEncodingNames)
+	case "json_format":
+		f.JSONFormat, err = parseFeature(name, value, jsonFormatNames)
+	}
+
+	return err
+}
+
+// checkFeatures validates values of features set anywhere in the elements.
+func checkFeatures(elements []proto.Visitee) error {
+	for _, element := range elements {
+		var options []*proto.Option
+		var children []proto.Visitee
+		switch e := element.(type) {
+		case *proto.Option:
+			options = []*proto.Option{e}
+		case *proto.NormalField:
+			options = e.Options
+		case *proto.MapField:
+			options = e.Options
+		case *proto.OneOfField:
+			options = e.Options
+		case *proto.Extensions:
+			options = e.Options
+		case *proto.Message:
+			children = e.Elements
+		case *proto.Oneof:
+			children = e.Elements
+		case *proto.Enum:
+			children = e.Elements
+		case *proto.EnumField:
+			children = e.Elements
+		case *proto.Service:
+			children = e.Elements
+		case *proto.RPC:
+			children = e.Elements
+		}
+
+		for _, option := range options {
+			if err := new(Features).setFromOption(option); err != nil {
+				return errors.Wrapf(err, "%s", option.Position)
+			}
+		}
+		if err := checkFeatures(children); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *Features) inferLegacy(edition string, field *proto.NormalField) {
+	var packed string
+	for _, option := range field.Options {
+		if option.Name == "packed" {
+			packed = option.Constant.Source
+		}
+	}
+
+	switch edition {
+	case "proto2":
+		if field.Required {
+			f.FieldPresence = FieldPresenceLegacyRequired
+		}
+		if packed == "true" {
+			f.RepeatedFieldEncoding = RepeatedFieldEncodingPacked
+		}
+	case "proto3":
+		if field.Optional {
+			f.FieldPresence = FieldPresenceExplicit
+		}
+		if packed == "false" {
+			f.RepeatedFieldEncoding = RepeatedFieldEncodingExpanded
+		}
+	}
+}
+
+func parseFeature[T ~int](feature, value string, names map[T]string) (T, error) {
+	for k, v := range names {
+		if v == value {
+			return k, nil
+		}
+	}
+
+	return 0, errors.Newf("unknown %s feature value %s", feature, value)
+}
+
+var (
+	fieldPresenceNames = map[FeatureFieldPresence]string{
+		FieldPresenceUnknown:        "FIELD_PRESENCE_UNKNOWN",
+		FieldPresenceExplicit:       "EXPLICIT",
+		FieldPresenceImplicit:       "IMPLICIT",
+		FieldPresenceLegacyRequired: "LEGACY_REQUIRED",
+	}
+	enumTypeNames = map[FeatureEnumType]string{
+		EnumTypeUnknown: "ENUM_TYPE_UNKNOWN",
+		EnumTypeOpen:    "OPEN",
+		EnumTypeClosed:  "CLOSED",
+	}
+	repeatedFieldEncodingNames = map[FeatureRepeatedFieldEncoding]string{
+		RepeatedFieldEncodingUnknown:  "REPEATED_FIELD_ENCODING_UNKNOWN",
+		RepeatedFieldEncodingPacked:   "PACKED",
+		RepeatedFieldEncodingExpanded: "EXPANDED",
+	}
+	utf8ValidationNames = map[FeatureUTF8Validation]string{
+		UTF8ValidationUnknown: "UTF8_VALIDATION_UNKNOWN",
+		UTF8ValidationVerify:  "VERIFY",
+		UTF8ValidationNone:    "NONE",
+	}
+	messageEncodingNames = map[FeatureMessageEncoding]string{
+		MessageEncodingUnknown:        "MESSAGE_ENCODING_UNKNOWN",
+		MessageEncodingLengthPrefixed: "LENGTH_PREFIXED",
+		MessageEncodingDelimited:      "DELIMITED",
+	}
+	jsonFormatNames = map[FeatureJSONFormat]string{
+		JSONFormatUnknown:          "JSON_FORMAT_UNKNOWN",
+		JSONFormatAllow:            "ALLOW",
+		JSONFormatLegacyBestEffort: "LEGACY_BEST_EFFORT",
+	}
+)
+
+func (v FeatureFieldPresence) String() string         { return fieldPresenceNames[v] }
+func (v FeatureEnumType) String() string              { return enumTypeNames[v] }
+func (v FeatureRepeatedFieldEncoding) String() string { return repeatedFieldEncodingNames[v] }
+func (v FeatureUTF8Validation) String() string        { return utf8ValidationNames[v] }
+func (v FeatureMessageEncoding) String() string       { return messageEncodingNames[v] }
+func (v FeatureJSONFormat) String() string            { return jsonFormatNames[v] }
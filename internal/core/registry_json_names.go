@@ -0,0 +1,112 @@
+package core
+
+import (
+	"iter"
+	"strings"
+
+	"github.com/emicklei/proto"
+)
+
+// JSONNameConflict describes fields of the same message sharing a JSON name.
+type JSONNameConflict struct {
+	Message  *Message
+	JSONName string
+	Fields   []FieldNode
+}
+
+// JSONNameConflicts looks for fields sharing a JSON name within a message across all loaded files.
+// Oneof branches are treated as fields of the message enclosing their oneof.
+func (r *Registry) JSONNameConflicts() iter.Seq[*JSONNameConflict] {
+	return func(yield func(*JSONNameConflict) bool) {
+		for file := range r.Files() {
+			for msg := range file.Messages(r) {
+				if !r.jsonNameConflicts(msg, yield) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Registry) jsonNameConflicts(msg *Message, yield func(*JSONNameConflict) bool) bool {
+	var names []string
+	fields := map[string][]FieldNode{}
+	add := func(name string, field FieldNode) {
+		if _, ok := fields[name]; !ok {
+			names = append(names, name)
+		}
+		fields[name] = append(fields[name], field)
+	}
+	for field := range msg.Fields(r) {
+		oneof, ok := field.Type(r).(*OneOf)
+		if !ok {
+			add(field.JSONName(), field)
+			continue
+		}
+
+		for branch := range oneof.Branches(r) {
+			add(branch.JSONName(), branch)
+		}
+	}
+
+	for _, name := range names {
+		if len(fields[name]) < 2 {
+			continue
+		}
+
+		conflict := &JSONNameConflict{
+			Message:  msg,
+			JSONName: name,
+			Fields:   fields[name],
+		}
+		if !yield(conflict) {
+			return false
+		}
+	}
+
+	for nested := range msg.Messages(r) {
+		if !r.jsonNameConflicts(nested, yield) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func fieldJSONName(field *proto.Field) string {
+	for _, option := range field.Options {
+		if option.Name != "json_name" {
+			continue
+		}
+
+		if v, err := unescapeLiteral(option.Constant.Source); err == nil {
+			return v
+		}
+		return option.Constant.Source
+	}
+
+	return jsonName(field.Name)
+}
+
+// jsonName converts a field name into lowerCamelCase exactly the way protoc does.
+func jsonName(name string) string {
+	var res strings.Builder
+	var capitalizeNext bool
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '_':
+			capitalizeNext = true
+		case capitalizeNext:
+			if 'a' <= c && c <= 'z' {
+				c -= 'a' - 'A'
+			}
+			res.WriteByte(c)
+			capitalizeNext = false
+		default:
+			res.WriteByte(c)
+		}
+	}
+
+	return res.String()
+}
@@ -53,6 +53,8 @@ func (r *Registry) NodeDescription(node Node) string {
 		return "file"
 	case *Syntax:
 		return "syntax"
+	case *Edition:
+		return "edition"
 	case *Package:
 		return "package"
 	case *Import:
@@ -81,6 +83,8 @@ func (r *Registry) NodeDescription(node Node) string {
 		return "[]" + r.NodeDescription(n.Type)
 	case *Reserved:
 		return "reserved"
+	case *Extensions:
+		return "extensions"
 	default:
 		panic(errors.Newf("unsupported node type: %T", node))
 	}
@@ -141,6 +145,10 @@ func (r *Registry) Comment(node Node) []string {
 		if n.proto.Comment != nil {
 			return n.proto.Comment.Lines
 		}
+	case *Extensions:
+		if n.proto.Comment != nil {
+			return n.proto.Comment.Lines
+		}
 	case *Import:
 		if n.proto.Comment != nil {
 			return n.proto.Comment.Lines
@@ -149,6 +157,10 @@ func (r *Registry) Comment(node Node) []string {
 		if n.proto.Comment != nil {
 			return n.proto.Comment.Lines
 		}
+	case *Edition:
+		if n.proto.Comment != nil {
+			return n.proto.Comment.Lines
+		}
 	case *Package:
 		if n.proto.Comment != nil {
 			return n.proto.Comment.Lines
@@ -216,6 +228,8 @@ func (r *Registry) Pos(pos Positionable) (res scanner.Position) {
 		return n.proto.Position
 	case *OptionValueMapItem:
 		return n.proto.Position
+	case *OptionValueAny:
+		return n.proto.Position
 	case *Enum:
 		return n.proto.Position
 	case *EnumValue:
@@ -232,10 +246,14 @@ func (r *Registry) Pos(pos Positionable) (res scanner.Position) {
 		return n.proto.Position
 	case *Reserved:
 		return n.proto.Position
+	case *Extensions:
+		return n.proto.Position
 	case *Import:
 		return n.proto.Position
 	case *Syntax:
 		return n.proto.Position
+	case *Edition:
+		return n.proto.Position
 	case *Package:
 		return n.proto.Position
 	default:
@@ -270,6 +288,12 @@ func (r *Registry) Options(node NodeOptionable) iter.Seq[*Option] {
 	case *OneOf:
 		scope := r.scopes[n.proto]
 		return seqOptions(r, scope, registryOptionsOneof, n.proto.Elements)
+	case *OneOfBranch:
+		scope := r.scopes[n.proto]
+		return seqOptions(r, scope, registryOptionsMessageField, n.proto.Options)
+	case *Extensions:
+		scope := r.scopes[n.proto.Parent]
+		return seqOptions(r, scope, registryOptionsExtensionRange, n.proto.Options)
 	case *Service:
 		scope := r.scopes[n.proto]
 		return seqOptions(r, scope, registryOptionsService, n.proto.Elements)
@@ -290,8 +314,8 @@ func (r *Registry) OptionNamed(node NodeOptionable, name string) *Option {
 		return namedOption(r, name, scope, registryOptionsMessage, n.proto.Elements)
 	case *MessageField:
 		switch p := n.proto.(type) {
-		case *proto.Message:
-			return namedOption(r, name, r.scopes[p], registryOptionsMessageField, p.Elements)
+		case *proto.NormalField:
+			return namedOption(r, name, r.scopes[p], registryOptionsMessageField, p.Options)
 		case *proto.Oneof:
 			return namedOption(r, name, r.scopes[p], registryOptionsOneof, p.Elements)
 		case *proto.MapField:
@@ -308,6 +332,12 @@ func (r *Registry) OptionNamed(node NodeOptionable, name string) *Option {
 	case *OneOf:
 		scope := r.scopes[n.proto]
 		return namedOption(r, name, scope, registryOptionsOneof, n.proto.Elements)
+	case *OneOfBranch:
+		scope := r.scopes[n.proto]
+		return namedOption(r, name, scope, registryOptionsMessageField, n.proto.Options)
+	case *Extensions:
+		scope := r.scopes[n.proto.Parent]
+		return namedOption(r, name, scope, registryOptionsExtensionRange, n.proto.Options)
 	case *Service:
 		scope := r.scopes[n.proto]
 		return namedOption(r, name, scope, registryOptionsService, n.proto.Elements)
@@ -0,0 +1,294 @@
+package core
+
+import (
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/emicklei/proto"
+)
+
+// OptionTargetType mirrors google.protobuf.FieldOptions.OptionTargetType.
+type OptionTargetType int
+
+// OptionRetention mirrors google.protobuf.FieldOptions.OptionRetention.
+type OptionRetention int
+
+const (
+	OptionTargetTypeUnknown        OptionTargetType = 0
+	OptionTargetTypeFile           OptionTargetType = 1
+	OptionTargetTypeExtensionRange OptionTargetType = 2
+	OptionTargetTypeMessage        OptionTargetType = 3
+	OptionTargetTypeField          OptionTargetType = 4
+	OptionTargetTypeOneof          OptionTargetType = 5
+	OptionTargetTypeEnum           OptionTargetType = 6
+	OptionTargetTypeEnumEntry      OptionTargetType = 7
+	OptionTargetTypeService        OptionTargetType = 8
+	OptionTargetTypeMethod         OptionTargetType = 9
+)
+
+const (
+	RetentionUnknown OptionRetention = 0
+	RetentionRuntime OptionRetention = 1
+	RetentionSource  OptionRetention = 2
+)
+
+// OptionTargetViolation describes an option applied to an element its definition does not target.
+// Field is either the option itself or a subfield set with a path like (my.opt).a.b.
+type OptionTargetViolation struct {
+	Node    Node
+	Option  *Option
+	Field   *MessageField
+	Targets []OptionTargetType
+}
+
+// ExtensionNumberConflict describes extensions of the same message sharing a field number.
+type ExtensionNumberConflict struct {
+	Extendee   *Message
+	Number     int
+	Extensions []*MessageField
+}
+
+// Retention returns retention declared in the option definition.
+func (o *Option) Retention() OptionRetention {
+	return fieldRetention(o.optionField)
+}
+
+// Targets returns element kinds the option definition allows it to be applied to.
+// Empty targets mean any element.
+func (o *Option) Targets() []OptionTargetType {
+	return fieldTargets(o.optionField)
+}
+
+// RuntimeOptions is [Registry.Options] without options having RETENTION_SOURCE
+// retention, i.e. options runtime consumers are supposed to see.
+func (r *Registry) RuntimeOptions(node NodeOptionable) iter.Seq[*Option] {
+	return func(yield func(*Option) bool) {
+		for option := range r.Options(node) {
+			if option.Retention() == RetentionSource {
+				continue
+			}
+
+			if !yield(option) {
+				return
+			}
+		}
+	}
+}
+
+// OptionTargetViolations looks for options applied to elements their definitions do not
+// target across all loaded files. Both option definitions and definitions of subfields set
+// with paths, like features.field_presence, are checked.
+func (r *Registry) OptionTargetViolations() iter.Seq[*OptionTargetViolation] {
+	return func(yield func(*OptionTargetViolation) bool) {
+		for _, name := range slices.Sorted(maps.Keys(r.annotated)) {
+			for node, option := range r.Annotated(name) {
+				target := nodeTargetType(node)
+				for _, field := range r.optionTargetFields(option) {
+					targets := fieldTargets(field)
+					if len(targets) == 0 || slices.Contains(targets, target) {
+						continue
+					}
+
+					violation := &OptionTargetViolation{
+						Node:    node,
+						Option:  option,
+						Field:   r.wrap(field).(*MessageField),
+						Targets: targets,
+					}
+					if !yield(violation) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// optionTargetFields returns the option field and fields of paths its parts are set with.
+func (r *Registry) optionTargetFields(option *Option) []*proto.NormalField {
+	res := []*proto.NormalField{option.optionField}
+	for _, part := range option.parts {
+		typ := r.wrap(option.optionField).(*MessageField).Type(r)
+		for _, name := range part.path {
+			msg, ok := typ.(*Message)
+			if !ok {
+				break
+			}
+
+			field, fieldType := messageLiteralField(r, msg, parenthesisReplacer.Replace(name))
+			if v, ok := field.(*MessageField); ok {
+				if p, ok := v.proto.(*proto.NormalField); ok && !slices.Contains(res, p) {
+					res = append(res, p)
+				}
+			}
+			typ = fieldType
+		}
+	}
+
+	return res
+}
+
+// ExtensionNumberConflicts looks for extensions of the same message sharing a number across all loaded files.
+func (r *Registry) ExtensionNumberConflicts() iter.Seq[*ExtensionNumberConflict] {
+	type key struct {
+		extendee string
+		number   int
+	}
+
+	return func(yield func(*ExtensionNumberConflict) bool) {
+		var keys []key
+		extensions := map[key][]*proto.NormalField{}
+		for _, name := range slices.Sorted(maps.Keys(r.registry)) {
+			field, ok := r.registry[name].(*proto.NormalField)
+			if !ok {
+				continue
+			}
+
+			extendee, ok := r.extendee(field)
+			if !ok {
+				continue
+			}
+
+			k := key{extendee: extendee, number: field.Sequence}
+			if _, ok := extensions[k]; !ok {
+				keys = append(keys, k)
+			}
+			extensions[k] = append(extensions[k], field)
+		}
+
+		for _, k := range keys {
+			if len(extensions[k]) < 2 {
+				continue
+			}
+
+			conflict := &ExtensionNumberConflict{
+				Extendee: r.wrap(r.registry[k.extendee]).(*Message),
+				Number:   k.number,
+			}
+			for _, field := range extensions[k] {
+				conflict.Extensions = append(conflict.Extensions, r.wrap(field).(*MessageField))
+			}
+			if !yield(conflict) {
+				return
+			}
+		}
+	}
+}
+
+// extendee returns a full name of the message the field extends.
+func (r *Registry) extendee(field *proto.NormalField) (string, bool) {
+	extend, ok := field.Parent.(*proto.Message)
+	if !ok || !extend.IsExtend {
+		return "", false
+	}
+
+	scope := r.scopes[field]
+	scope = scope[:strings.LastIndexByte(scope, '.')]
+	name, ok := r.resolveNameRaw(scope, extend.Name)
+	if !ok {
+		return "", false
+	}
+	if _, ok := r.registry[name].(*proto.Message); !ok {
+		return "", false
+	}
+
+	return name, true
+}
+
+func fieldRetention(field *proto.NormalField) OptionRetention {
+	var res OptionRetention
+	for _, option := range field.Options {
+		if option.Name != "retention" {
+			continue
+		}
+
+		for k, v := range retentionNames {
+			if v == option.Constant.Source {
+				res = k
+			}
+		}
+	}
+
+	return res
+}
+
+func fieldTargets(field *proto.NormalField) []OptionTargetType {
+	var res []OptionTargetType
+	add := func(source string) {
+		for k, v := range targetTypeNames {
+			if v == source {
+				res = append(res, k)
+			}
+		}
+	}
+	for _, option := range field.Options {
+		if option.Name != "targets" {
+			continue
+		}
+
+		if option.Constant.Array != nil {
+			for _, item := range option.Constant.Array {
+				add(item.Source)
+			}
+			continue
+		}
+		add(option.Constant.Source)
+	}
+
+	return res
+}
+
+func nodeTargetType(node Node) OptionTargetType {
+	switch n := node.(type) {
+	case *File:
+		return OptionTargetTypeFile
+	case *Message:
+		return OptionTargetTypeMessage
+	case *MessageField:
+		if _, ok := n.proto.(*proto.Oneof); ok {
+			return OptionTargetTypeOneof
+		}
+		return OptionTargetTypeField
+	case *OneOf:
+		return OptionTargetTypeOneof
+	case *OneOfBranch:
+		return OptionTargetTypeField
+	case *Extensions:
+		return OptionTargetTypeExtensionRange
+	case *Enum:
+		return OptionTargetTypeEnum
+	case *EnumValue:
+		return OptionTargetTypeEnumEntry
+	case *Service:
+		return OptionTargetTypeService
+	case *Method:
+		return OptionTargetTypeMethod
+	default:
+		return OptionTargetTypeUnknown
+	}
+}
+
+var (
+	targetTypeNames = map[OptionTargetType]string{
+		OptionTargetTypeUnknown:        "TARGET_TYPE_UNKNOWN",
+		OptionTargetTypeFile:           "TARGET_TYPE_FILE",
+		OptionTargetTypeExtensionRange: "TARGET_TYPE_EXTENSION_RANGE",
+		OptionTargetTypeMessage:        "TARGET_TYPE_MESSAGE",
+		OptionTargetTypeField:          "TARGET_TYPE_FIELD",
+		OptionTargetTypeOneof:          "TARGET_TYPE_ONEOF",
+		OptionTargetTypeEnum:           "TARGET_TYPE_ENUM",
+		OptionTargetTypeEnumEntry:      "TARGET_TYPE_ENUM_ENTRY",
+		OptionTargetTypeService:        "TARGET_TYPE_SERVICE",
+		OptionTargetTypeMethod:         "TARGET_TYPE_METHOD",
+	}
+	retentionNames = map[OptionRetention]string{
+		RetentionUnknown: "RETENTION_UNKNOWN",
+		RetentionRuntime: "RETENTION_RUNTIME",
+		RetentionSource:  "RETENTION_SOURCE",
+	}
+)
+
+func (v OptionTargetType) String() string { return targetTypeNames[v] }
+func (v OptionRetention) String() string  { return retentionNames[v] }
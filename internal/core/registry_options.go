@@ -0,0 +1,202 @@
+package core
+
+import (
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/emicklei/proto"
+)
+
+// EffectiveOption returns the nearest option with the given name set on the node or
+// its ancestors along with the node that provides it. The name can be anything
+// [Registry.OptionNamed] accepts, a fully qualified one like .pkg.opt is preferable.
+// Returns nils if none of them has the option.
+func (r *Registry) EffectiveOption(node Node, fullName string) (*Option, Node) {
+	return r.EffectiveOptionMapped(node, func(Node) string {
+		return fullName
+	})
+}
+
+// EffectiveOptionMapped is [Registry.EffectiveOption] for options defined on different
+// *Options extendees at each level, like .pkg.method_visibility for methods and
+// .pkg.service_visibility for services. The mapping gives a name of the option to look
+// for on the given node, empty name means the node is to be skipped.
+func (r *Registry) EffectiveOptionMapped(node Node, mapping func(node Node) string) (*Option, Node) {
+	for n := range r.NodeHierarchy(node) {
+		optionable, ok := n.(NodeOptionable)
+		if !ok {
+			continue
+		}
+
+		name := mapping(n)
+		if name == "" {
+			continue
+		}
+
+		if option := r.OptionNamed(optionable, name); option != nil {
+			return option, n
+		}
+	}
+
+	return nil, nil
+}
+
+// Annotated returns nodes of all loaded files having option with the given fully qualified
+// name, like .pkg.opt or .google.protobuf.MethodOptions.deprecated, along with the option.
+func (r *Registry) Annotated(optionFullName string) iter.Seq2[Node, *Option] {
+	return func(yield func(Node, *Option) bool) {
+		for _, owner := range r.annotated[optionFullName] {
+			node := r.wrap(owner)
+			option := r.OptionNamed(node.(NodeOptionable), optionFullName)
+			if !yield(node, option) {
+				return
+			}
+		}
+	}
+}
+
+// indexOptions adds nodes of the file to the index of annotated nodes. It is called
+// once the file is demarked, thus every option it uses can be resolved.
+func (r *Registry) indexOptions(file *proto.Proto) {
+	indexNodeOptions(r, file, r.scopes[file], registryOptionsFile, file.Elements)
+	r.indexElementsOptions(file.Elements)
+}
+
+func (r *Registry) indexElementsOptions(elements []proto.Visitee) {
+	for _, element := range elements {
+		switch e := element.(type) {
+		case *proto.Message:
+			if !e.IsExtend {
+				indexNodeOptions(r, e, r.scopes[e], registryOptionsMessage, e.Elements)
+			}
+			r.indexElementsOptions(e.Elements)
+		case *proto.NormalField:
+			indexNodeOptions(r, e, r.scopes[e], registryOptionsMessageField, e.Options)
+		case *proto.MapField:
+			indexNodeOptions(r, e, r.scopes[e], registryOptionsMessageField, e.Options)
+		case *proto.Oneof:
+			indexNodeOptions(r, e, r.scopes[e], registryOptionsOneof, e.Elements)
+			r.indexElementsOptions(e.Elements)
+		case *proto.OneOfField:
+			indexNodeOptions(r, e, r.scopes[e], registryOptionsMessageField, e.Options)
+		case *proto.Extensions:
+			indexNodeOptions(r, e, r.scopes[e.Parent], registryOptionsExtensionRange, e.Options)
+		case *proto.Enum:
+			indexNodeOptions(r, e, r.scopes[e], registryOptionsEnum, e.Elements)
+			r.indexElementsOptions(e.Elements)
+		case *proto.EnumField:
+			indexNodeOptions(r, e, r.scopes[e], registryOptionsEnumValue, e.Elements)
+		case *proto.Service:
+			indexNodeOptions(r, e, r.scopes[e], registryOptionsService, e.Elements)
+			r.indexElementsOptions(e.Elements)
+		case *proto.RPC:
+			indexNodeOptions(r, e, r.scopes[e], registryOptionsMethod, e.Elements)
+		}
+	}
+}
+
+func indexNodeOptions[T proto.Visitee](r *Registry, owner proto.Visitee, scope, className string, elements []T) {
+	class, ok := r.registry[className].(*proto.Message)
+	if !ok {
+		return
+	}
+
+	for _, element := range elements {
+		var vv proto.Visitee = element
+		option, ok := vv.(*proto.Option)
+		if !ok {
+			continue
+		}
+
+		// Options the registry cannot resolve are reported when accessed.
+		field := r.optionField(scope, class, splitOptionName(option.Name)[0])
+		if field == nil {
+			continue
+		}
+
+		name := r.scopes[field]
+		owners := r.annotated[name]
+		if len(owners) > 0 && owners[len(owners)-1] == owner {
+			continue
+		}
+		r.annotated[name] = append(owners, owner)
+	}
+}
+
+// AvailableOption describes an option which can be set on some kind of nodes.
+type AvailableOption struct {
+	// Name is the option name as it is written in options, like deprecated or (pkg.opt).
+	Name    string
+	Field   *MessageField
+	Type    Type
+	Number  int
+	File    *File
+	Comment []string
+}
+
+// AvailableOptions returns options which can be set on nodes of the given kind: builtin
+// fields of the matching google.protobuf.*Options message followed by its extensions
+// from all loaded files. Options whose targets do not allow the kind are omitted.
+func (r *Registry) AvailableOptions(kind OptionTargetType) iter.Seq[*AvailableOption] {
+	return func(yield func(*AvailableOption) bool) {
+		className, ok := optionClassNames[kind]
+		if !ok {
+			return
+		}
+		class := r.registry[className].(*proto.Message)
+
+		var fields []*proto.NormalField
+		for _, element := range class.Elements {
+			if field, ok := element.(*proto.NormalField); ok && field.Name != "uninterpreted_option" {
+				fields = append(fields, field)
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(r.registry)) {
+			field, ok := r.registry[name].(*proto.NormalField)
+			if !ok {
+				continue
+			}
+
+			if extendee, ok := r.extendee(field); ok && extendee == className {
+				fields = append(fields, field)
+			}
+		}
+
+		for _, field := range fields {
+			if targets := fieldTargets(field); len(targets) > 0 && !slices.Contains(targets, kind) {
+				continue
+			}
+
+			node := r.wrap(field).(*MessageField)
+			name := field.Name
+			if field.Parent != class {
+				name = "(" + strings.TrimPrefix(r.scopes[field], ".") + ")"
+			}
+			option := &AvailableOption{
+				Name:    name,
+				Field:   node,
+				Type:    node.Type(r),
+				Number:  field.Sequence,
+				File:    r.NodeFile(node),
+				Comment: r.Comment(node),
+			}
+			if !yield(option) {
+				return
+			}
+		}
+	}
+}
+
+var optionClassNames = map[OptionTargetType]string{
+	OptionTargetTypeFile:           registryOptionsFile,
+	OptionTargetTypeExtensionRange: registryOptionsExtensionRange,
+	OptionTargetTypeMessage:        registryOptionsMessage,
+	OptionTargetTypeField:          registryOptionsMessageField,
+	OptionTargetTypeOneof:          registryOptionsOneof,
+	OptionTargetTypeEnum:           registryOptionsEnum,
+	OptionTargetTypeEnumEntry:      registryOptionsEnumValue,
+	OptionTargetTypeService:        registryOptionsService,
+	OptionTargetTypeMethod:         registryOptionsMethod,
+}
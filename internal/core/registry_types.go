@@ -61,10 +61,14 @@ func (r *Registry) NodeParent(node Node) Node {
 		return r.wrap(n.proto.Parent)
 	case *Reserved:
 		return r.wrap(n.proto.Parent)
+	case *Extensions:
+		return r.wrap(n.proto.Parent)
 	case *Import:
 		return r.wrap(n.proto.Parent)
 	case *Syntax:
 		return r.wrap(n.proto.Parent)
+	case *Edition:
+		return r.wrap(n.proto.Parent)
 	case *Package:
 		return r.wrap(n.proto.Parent)
 	case *Option:
@@ -193,10 +197,18 @@ func (r *Registry) wrap(t proto.Visitee) (res Node) {
 		return &Reserved{
 			proto: n,
 		}
+	case *proto.Extensions:
+		return &Extensions{
+			proto: n,
+		}
 	case *proto.Syntax:
 		return &Syntax{
 			proto: n,
 		}
+	case *proto.Edition:
+		return &Edition{
+			proto: n,
+		}
 	case *proto.Package:
 		return &Package{
 			proto: n,
@@ -207,7 +219,7 @@ func (r *Registry) wrap(t proto.Visitee) (res Node) {
 }
 
 func (r *Registry) wrapOption(option *proto.Option, where *proto.Message) Node {
-	return newOption(r, r.scopes[option], where, option)
+	return newOption(r, r.scopes[option.Parent], where, option)
 }
 
 func builtinType(name string) BuiltinType {
@@ -19,13 +19,31 @@ func (v *visitorDemark) scopedName(n string) string {
 	return v.scope + "." + n
 }
 
+// register binds the node to the name. The first definition of a name wins,
+// the rest are recorded as collisions.
+func (v *visitorDemark) register(name string, node proto.Visitee) {
+	prev, ok := v.r.registry[name]
+	if !ok {
+		v.r.registry[name] = node
+		return
+	}
+
+	if prev != node {
+		v.r.collisions = append(v.r.collisions, symbolCollision{
+			name:     name,
+			previous: prev,
+			node:     node,
+		})
+	}
+}
+
 func (v *visitorDemark) VisitMessage(m *proto.Message) {
 	prevScope := v.scope
 	if m.IsExtend {
 		v.isExtend = true
 	} else {
 		v.scope = v.scopedName(m.Name)
-		v.r.registry[v.scope] = m
+		v.register(v.scope, m)
 		v.r.scopes[m] = v.scope
 	}
 
@@ -39,10 +57,10 @@ func (v *visitorDemark) VisitMessage(m *proto.Message) {
 
 func (v *visitorDemark) VisitService(s *proto.Service) {
 	scopedName := v.scopedName(s.Name)
-	v.r.registry[scopedName] = s
+	v.register(scopedName, s)
 	prevScope := v.scope
 	v.scope = scopedName
-	v.r.registry[v.scope] = s
+	v.register(v.scope, s)
 	v.r.scopes[s] = v.scope
 	for _, e := range s.Elements {
 		e.Accept(v)
@@ -76,25 +94,29 @@ func (v *visitorDemark) VisitImport(i *proto.Import) {
 	}
 
 	vv := &visitorDemark{
-		r: v.r,
+		r:    v.r,
+		file: file,
 	}
 	file.Accept(vv)
+	v.r.indexOptions(file)
 }
 
 func (v *visitorDemark) VisitNormalField(f *proto.NormalField) {
 	scopedName := v.scopedName(f.Name)
-	v.r.registry[scopedName] = f
+	v.register(scopedName, f)
 	v.r.scopes[f] = scopedName
 }
 
+// VisitEnumField registers enum values as siblings of their enum, this is how protobuf scopes them.
 func (v *visitorDemark) VisitEnumField(f *proto.EnumField) {
 	scopedName := v.scopedName(f.Name)
-	v.r.registry[scopedName] = f
+	v.register(scopedName, f)
+	v.r.scopes[f] = scopedName
 }
 
 func (v *visitorDemark) VisitEnum(e *proto.Enum) {
 	scopedName := v.scopedName(e.Name)
-	v.r.registry[scopedName] = e
+	v.register(scopedName, e)
 	v.r.scopes[e] = scopedName
 	for _, e := range e.Elements {
 		e.Accept(v)
@@ -106,7 +128,7 @@ func (v *visitorDemark) VisitComment(c *proto.Comment) {}
 func (v *visitorDemark) VisitOneof(o *proto.Oneof) {
 	scopedName := v.scopedName(o.Name)
 	prev := v.scope
-	v.r.registry[scopedName] = o
+	v.register(scopedName, o)
 	v.r.scopes[o] = scopedName
 	for _, e := range o.Elements {
 		e.Accept(v)
@@ -115,7 +137,7 @@ func (v *visitorDemark) VisitOneof(o *proto.Oneof) {
 }
 func (v *visitorDemark) VisitOneofField(f *proto.OneOfField) {
 	scopedName := v.scopedName(f.Name)
-	v.r.registry[scopedName] = f
+	v.register(scopedName, f)
 	v.r.scopes[f] = scopedName
 }
 
@@ -123,14 +145,25 @@ func (v *visitorDemark) VisitReserved(r *proto.Reserved) {}
 
 func (v *visitorDemark) VisitRPC(r *proto.RPC) {
 	scopedName := v.scopedName(r.Name)
-	v.r.registry[scopedName] = r
+	v.register(scopedName, r)
 	v.r.scopes[r] = scopedName
 }
 
 func (v *visitorDemark) VisitMapField(f *proto.MapField) {
 	scopedName := v.scopedName(f.Name)
-	v.r.registry[scopedName] = f
+	v.register(scopedName, f)
 	v.r.scopes[f] = scopedName
+
+	entry := newMapEntry(f)
+	v.r.mapEntries[f] = entry
+	prevScope := v.scope
+	v.scope = v.scopedName(entry.Name)
+	v.register(v.scope, entry)
+	v.r.scopes[entry] = v.scope
+	for _, e := range entry.Elements {
+		e.Accept(v)
+	}
+	v.scope = prevScope
 }
 
 func (v *visitorDemark) VisitGroup(g *proto.Group)           {}
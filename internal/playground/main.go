@@ -30,6 +30,6 @@ func main() {
 
 	fmt.Println(f.Name(), f.Package())
 	for option := range registry.Options(f) {
-		fmt.Println(option.Name(), option.Value().Value())
+		fmt.Println(option.Name(), option.Value())
 	}
 }
@@ -50,7 +50,7 @@ func main() {
 
 		service := serviceFile.Service(registry, serviceName)
 		if service == nil {
-			panic(fmt.Errorf("service %q not found in %q file", serviceName, serviceFile))
+			panic(fmt.Errorf("service %q not found in %q file", serviceName, serviceFile.Name()))
 		}
 
 		for method := range service.Methods(registry) {
@@ -0,0 +1,258 @@
+// Package wire implements low level protobuf wire format encoding and decoding.
+package wire
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/sirkon/protoast/v2/internal/errors"
+)
+
+// Type is a wire type of an encoded field.
+type Type int8
+
+const (
+	VarintType     Type = 0
+	Fixed64Type    Type = 1
+	BytesType      Type = 2
+	StartGroupType Type = 3
+	EndGroupType   Type = 4
+	Fixed32Type    Type = 5
+)
+
+// MaxFieldNumber is the largest valid field number.
+const MaxFieldNumber = 1<<29 - 1
+
+// RecursionLimit is the maximal nesting of groups and messages, the same protobuf-go has.
+const RecursionLimit = 10000
+
+// AppendTag appends field tag.
+func AppendTag(b []byte, num int, typ Type) []byte {
+	return AppendVarint(b, uint64(num)<<3|uint64(typ&7))
+}
+
+// AppendVarint appends base 128 varint.
+func AppendVarint(b []byte, v uint64) []byte {
+	return binary.AppendUvarint(b, v)
+}
+
+// AppendFixed32 appends little endian 32 bit value.
+func AppendFixed32(b []byte, v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(b, v)
+}
+
+// AppendFixed64 appends little endian 64 bit value.
+func AppendFixed64(b []byte, v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(b, v)
+}
+
+// AppendBytes appends length prefixed bytes.
+func AppendBytes(b []byte, v []byte) []byte {
+	b = AppendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// AppendString appends length prefixed string.
+func AppendString(b []byte, v string) []byte {
+	b = AppendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// EncodeZigZag encodes signed value for sint32 and sint64 fields.
+func EncodeZigZag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+// DecodeZigZag decodes sint32 and sint64 fields values.
+func DecodeZigZag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// EncodeBool encodes bool as a varint value.
+func EncodeBool(v bool) uint64 {
+	if v {
+		return 1
+	}
+
+	return 0
+}
+
+// Float32 converts fixed32 value into float.
+func Float32(v uint32) float32 { return math.Float32frombits(v) }
+
+// Float64 converts fixed64 value into double.
+func Float64(v uint64) float64 { return math.Float64frombits(v) }
+
+// FromFloat32 converts float into fixed32 value.
+func FromFloat32(v float32) uint32 { return math.Float32bits(v) }
+
+// FromFloat64 converts double into fixed64 value.
+func FromFloat64(v float64) uint64 { return math.Float64bits(v) }
+
+// SizeVarint returns the length of the encoded varint.
+func SizeVarint(v uint64) int { return len(AppendVarint(nil, v)) }
+
+// SizeTag returns the length of the encoded tag.
+func SizeTag(num int) int { return SizeVarint(uint64(num) << 3) }
+
+func validFieldNumber(num uint64) bool {
+	return num > 0 && num <= MaxFieldNumber
+}
+
+// ConsumeTag reads field tag returning field number, wire type and the length of the tag.
+func ConsumeTag(b []byte) (int, Type, int, error) {
+	v, n, err := ConsumeVarint(b)
+	if err != nil {
+		return 0, 0, 0, errors.Wrap(err, "read tag")
+	}
+
+	num := v >> 3
+	if !validFieldNumber(num) {
+		return 0, 0, 0, errors.Newf("invalid field number %d", num)
+	}
+
+	typ := Type(v & 7)
+	if typ > Fixed32Type {
+		return 0, 0, 0, errors.Newf("invalid wire type %d", typ)
+	}
+
+	return int(num), typ, n, nil
+}
+
+// ConsumeVarint reads base 128 varint returning it with its length.
+func ConsumeVarint(b []byte) (uint64, int, error) {
+	v, n := binary.Uvarint(b)
+	switch {
+	case n == 0:
+		return 0, 0, errors.New("unexpected end of varint")
+	case n < 0:
+		return 0, 0, errors.New("varint overflows 64 bits")
+	}
+
+	return v, n, nil
+}
+
+// ConsumeFixed32 reads little endian 32 bit value.
+func ConsumeFixed32(b []byte) (uint32, int, error) {
+	if len(b) < 4 {
+		return 0, 0, errors.New("unexpected end of fixed32 value")
+	}
+
+	return binary.LittleEndian.Uint32(b), 4, nil
+}
+
+// ConsumeFixed64 reads little endian 64 bit value.
+func ConsumeFixed64(b []byte) (uint64, int, error) {
+	if len(b) < 8 {
+		return 0, 0, errors.New("unexpected end of fixed64 value")
+	}
+
+	return binary.LittleEndian.Uint64(b), 8, nil
+}
+
+// ConsumeBytes reads length prefixed bytes.
+func ConsumeBytes(b []byte) ([]byte, int, error) {
+	size, n, err := ConsumeVarint(b)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "read length")
+	}
+
+	if size > uint64(len(b)-n) {
+		return nil, 0, errors.Newf("length %d exceeds remaining %d bytes", size, len(b)-n)
+	}
+
+	return b[n : n+int(size)], n + int(size), nil
+}
+
+// ConsumeFieldValue reads a value of the field with the given number and wire type
+// returning its length. Groups are read up to their matching end, at most [RecursionLimit]
+// of them can be nested.
+func ConsumeFieldValue(num int, typ Type, b []byte) (int, error) {
+	return consumeFieldValue(num, typ, b, RecursionLimit)
+}
+
+func consumeFieldValue(num int, typ Type, b []byte, depth int) (int, error) {
+	switch typ {
+	case VarintType:
+		_, n, err := ConsumeVarint(b)
+		return n, err
+	case Fixed32Type:
+		_, n, err := ConsumeFixed32(b)
+		return n, err
+	case Fixed64Type:
+		_, n, err := ConsumeFixed64(b)
+		return n, err
+	case BytesType:
+		_, n, err := ConsumeBytes(b)
+		return n, err
+	case StartGroupType:
+		if depth == 0 {
+			return 0, errors.New("exceeded maximum recursion depth")
+		}
+
+		var size int
+		for {
+			fieldNum, fieldType, n, err := ConsumeTag(b[size:])
+			if err != nil {
+				return 0, errors.Wrapf(err, "read group %d", num)
+			}
+			size += n
+
+			if fieldType == EndGroupType {
+				if fieldNum != num {
+					return 0, errors.Newf("group %d ends with mismatched number %d", num, fieldNum)
+				}
+				return size, nil
+			}
+
+			n, err = consumeFieldValue(fieldNum, fieldType, b[size:], depth-1)
+			if err != nil {
+				return 0, err
+			}
+			size += n
+		}
+	default:
+		return 0, errors.Newf("unexpected wire type %d", typ)
+	}
+}
+
+// Field is a raw field read from the wire.
+type Field struct {
+	Number int
+	Type   Type
+	// Value is the field value encoded with the wire type: varint, fixed bytes, length prefixed
+	// contents without the prefix or group contents without the end tag.
+	Value []byte
+}
+
+// Fields reads all fields of an encoded message.
+func Fields(b []byte) ([]Field, error) {
+	var res []Field
+	for len(b) > 0 {
+		num, typ, n, err := ConsumeTag(b)
+		if err != nil {
+			return nil, err
+		}
+		if typ == EndGroupType {
+			return nil, errors.Newf("unexpected end of group %d", num)
+		}
+		b = b[n:]
+
+		n, err = ConsumeFieldValue(num, typ, b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read field %d", num)
+		}
+
+		value := b[:n]
+		switch typ {
+		case BytesType:
+			value, _, _ = ConsumeBytes(value)
+		case StartGroupType:
+			value = value[:n-SizeTag(num)]
+		}
+		res = append(res, Field{Number: num, Type: typ, Value: value})
+		b = b[n:]
+	}
+
+	return res, nil
+}
@@ -29,8 +29,10 @@ type (
 	OptionValue        = core.Option
 	OptionValueVariant = core.OptionValueVariant
 	Reserved           = core.Reserved
+	Extensions         = core.Extensions
 	Import             = core.Import
 	Syntax             = core.Syntax
+	Edition            = core.Edition
 	Package            = core.Package
 
 	Bool     = core.Bool
@@ -59,4 +61,72 @@ type (
 	OptionValueArray   = core.OptionValueArray
 	OptionValueMap     = core.OptionValueMap
 	OptionValueMapItem = core.OptionValueMapItem
+	OptionValueAny     = core.OptionValueAny
+
+	SymbolCollision  = core.SymbolCollision
+	JSONNameConflict = core.JSONNameConflict
+
+	OptionTargetType        = core.OptionTargetType
+	OptionRetention         = core.OptionRetention
+	OptionTargetViolation   = core.OptionTargetViolation
+	ExtensionNumberConflict = core.ExtensionNumberConflict
+	AvailableOption         = core.AvailableOption
+	DescriptorOptions       = core.DescriptorOptions
+	Plugin                  = core.Plugin
+	DynamicMessage          = core.DynamicMessage
+	DynamicField            = core.DynamicField
+	DynamicMapEntry         = core.DynamicMapEntry
+	DynamicUnknownField     = core.DynamicUnknownField
+	JSONViolation           = core.JSONViolation
+	ExampleOptions          = core.ExampleOptions
+
+	Features                     = core.Features
+	FeatureFieldPresence         = core.FeatureFieldPresence
+	FeatureEnumType              = core.FeatureEnumType
+	FeatureRepeatedFieldEncoding = core.FeatureRepeatedFieldEncoding
+	FeatureUTF8Validation        = core.FeatureUTF8Validation
+	FeatureMessageEncoding       = core.FeatureMessageEncoding
+	FeatureJSONFormat            = core.FeatureJSONFormat
+)
+
+const (
+	FieldPresenceUnknown        = core.FieldPresenceUnknown
+	FieldPresenceExplicit       = core.FieldPresenceExplicit
+	FieldPresenceImplicit       = core.FieldPresenceImplicit
+	FieldPresenceLegacyRequired = core.FieldPresenceLegacyRequired
+
+	EnumTypeUnknown = core.EnumTypeUnknown
+	EnumTypeOpen    = core.EnumTypeOpen
+	EnumTypeClosed  = core.EnumTypeClosed
+
+	RepeatedFieldEncodingUnknown  = core.RepeatedFieldEncodingUnknown
+	RepeatedFieldEncodingPacked   = core.RepeatedFieldEncodingPacked
+	RepeatedFieldEncodingExpanded = core.RepeatedFieldEncodingExpanded
+
+	UTF8ValidationUnknown = core.UTF8ValidationUnknown
+	UTF8ValidationVerify  = core.UTF8ValidationVerify
+	UTF8ValidationNone    = core.UTF8ValidationNone
+
+	MessageEncodingUnknown        = core.MessageEncodingUnknown
+	MessageEncodingLengthPrefixed = core.MessageEncodingLengthPrefixed
+	MessageEncodingDelimited      = core.MessageEncodingDelimited
+
+	JSONFormatUnknown          = core.JSONFormatUnknown
+	JSONFormatAllow            = core.JSONFormatAllow
+	JSONFormatLegacyBestEffort = core.JSONFormatLegacyBestEffort
+
+	OptionTargetTypeUnknown        = core.OptionTargetTypeUnknown
+	OptionTargetTypeFile           = core.OptionTargetTypeFile
+	OptionTargetTypeExtensionRange = core.OptionTargetTypeExtensionRange
+	OptionTargetTypeMessage        = core.OptionTargetTypeMessage
+	OptionTargetTypeField          = core.OptionTargetTypeField
+	OptionTargetTypeOneof          = core.OptionTargetTypeOneof
+	OptionTargetTypeEnum           = core.OptionTargetTypeEnum
+	OptionTargetTypeEnumEntry      = core.OptionTargetTypeEnumEntry
+	OptionTargetTypeService        = core.OptionTargetTypeService
+	OptionTargetTypeMethod         = core.OptionTargetTypeMethod
+
+	RetentionUnknown = core.RetentionUnknown
+	RetentionRuntime = core.RetentionRuntime
+	RetentionSource  = core.RetentionSource
 )
@@ -1,6 +1,9 @@
 package protoast
 
 import (
+	"io"
+	"os"
+
 	"github.com/sirkon/protoast/v2/internal/core"
 )
 
@@ -23,3 +26,29 @@ func Resolvers() *PathResolversBuilder {
 func NewRegistry(resolvers []PathResolver) (*Registry, error) {
 	return core.NewRegistry(resolvers...)
 }
+
+// NewRegistryFromDescriptorSet constructs a registry from encoded google.protobuf.FileDescriptorSet,
+// like the one protoc -o produces.
+func NewRegistryFromDescriptorSet(data []byte) (*Registry, error) {
+	return core.NewRegistryFromDescriptorSet(data)
+}
+
+// Plugin is a protoc plugin invocation.
+type Plugin = core.Plugin
+
+// RunPlugin runs gen as a protoc plugin: it reads CodeGeneratorRequest from stdin and writes
+// CodeGeneratorResponse to stdout. See [RunPluginWith] for details.
+func RunPlugin(gen func(p *Plugin) error) error {
+	return core.RunPlugin(os.Stdin, os.Stdout, gen)
+}
+
+// RunPluginWith runs gen as a protoc plugin reading the request from in and writing the response to out.
+func RunPluginWith(in io.Reader, out io.Writer, gen func(p *Plugin) error) error {
+	return core.RunPlugin(in, out, gen)
+}
+
+// Validate checks JSON representation of the message against its schema and returns all
+// violations found, each with a JSON pointer to the wrong value. See [Registry.ValidateJSON].
+func Validate(r *Registry, msg *core.Message, data []byte) []*core.JSONViolation {
+	return r.ValidateJSON(msg, data)
+}
@@ -1,13 +1,22 @@
 package protoast_test
 
 import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"iter"
+	"math"
+	"os"
+	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 
 	"github.com/alecthomas/assert/v2"
 	"github.com/sirkon/protoast/v2"
 	"github.com/sirkon/protoast/v2/internal/errors"
+	"github.com/sirkon/protoast/v2/internal/wire"
 	"github.com/sirkon/protoast/v2/past"
 )
 
@@ -340,3 +349,2153 @@ func iterLen[T any](it iter.Seq[T]) int {
 
 	return count
 }
+
+func TestFeatures(t *testing.T) {
+	r := testRegistry(t)
+
+	editions, err := r.Proto("editions.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get editions.proto"))
+	}
+	assert.Equal(t, "2023", editions.Edition())
+
+	fileFeatures := r.Features(editions)
+	assert.Equal(t, past.FieldPresenceImplicit, fileFeatures.FieldPresence)
+	assert.Equal(t, past.UTF8ValidationNone, fileFeatures.UTF8Validation)
+	assert.Equal(t, past.EnumTypeOpen, fileFeatures.EnumType)
+
+	msg := editions.Message(r, "Message")
+	assert.Equal(t, past.FieldPresenceExplicit, r.Features(msg).FieldPresence)
+	assert.Equal(t, past.FieldPresenceExplicit, r.Features(msg.Field(r, "explicit")).FieldPresence)
+	assert.Equal(t, past.FieldPresenceImplicit, r.Features(msg.Field(r, "implicit")).FieldPresence)
+	assert.Equal(t, past.RepeatedFieldEncodingExpanded, r.Features(msg.Field(r, "expanded")).RepeatedFieldEncoding)
+	assert.Equal(t, past.RepeatedFieldEncodingPacked, r.Features(msg.Field(r, "packed")).RepeatedFieldEncoding)
+
+	inner := msg.Message(r, "Inner")
+	innerFeatures := r.Features(inner.Field(r, "value"))
+	assert.Equal(t, past.FieldPresenceExplicit, innerFeatures.FieldPresence)
+	assert.Equal(t, past.UTF8ValidationNone, innerFeatures.UTF8Validation)
+
+	plain := editions.Message(r, "Plain")
+	assert.Equal(t, past.FieldPresenceImplicit, r.Features(plain.Field(r, "value")).FieldPresence)
+
+	assert.Equal(t, past.EnumTypeClosed, r.Features(editions.Enum(r, "Closed")).EnumType)
+	assert.Equal(t, past.EnumTypeOpen, r.Features(editions.Enum(r, "Open")).EnumType)
+
+	legacy, err := r.Proto("legacy.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get legacy.proto"))
+	}
+	assert.Equal(t, "proto2", legacy.Edition())
+
+	legacyMsg := legacy.Message(r, "Message")
+	assert.Equal(t, past.FieldPresenceLegacyRequired, r.Features(legacyMsg.Field(r, "required")).FieldPresence)
+	assert.Equal(t, past.FieldPresenceExplicit, r.Features(legacyMsg.Field(r, "optional")).FieldPresence)
+	assert.Equal(t, past.RepeatedFieldEncodingExpanded, r.Features(legacyMsg.Field(r, "expanded")).RepeatedFieldEncoding)
+	assert.Equal(t, past.RepeatedFieldEncodingPacked, r.Features(legacyMsg.Field(r, "packed")).RepeatedFieldEncoding)
+	assert.Equal(t, past.EnumTypeClosed, r.Features(legacy.Enum(r, "Enum")).EnumType)
+
+	data, err := r.Proto("data.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get data.proto"))
+	}
+	dataFeatures := r.Features(data.Message(r, "Message").Field(r, "i32"))
+	assert.Equal(t, past.FieldPresenceImplicit, dataFeatures.FieldPresence)
+	assert.Equal(t, past.EnumTypeOpen, dataFeatures.EnumType)
+	assert.Equal(t, past.JSONFormatAllow, dataFeatures.JSONFormat)
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := r.Proto("editions_unknown.proto")
+		assert.EqualError(t, err, "resolve proto file editions_unknown.proto: get proto definition from resolved file testdata/editions_unknown.proto: check features: editions_unknown.proto:6:19: unknown field_presence feature value FOO")
+
+		_, err = r.Proto("editions_unsupported.proto")
+		assert.EqualError(t, err, "resolve proto file editions_unsupported.proto: get proto definition from resolved file testdata/editions_unsupported.proto: editions_unsupported.proto:1:1: unsupported edition 2099")
+	})
+}
+
+func testRegistry(t *testing.T) *protoast.Registry {
+	resolvers, err := protoast.Resolvers().WithProtoc().WithRoot("./testdata").Build()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "build resolvers"))
+	}
+
+	r, err := protoast.NewRegistry(resolvers)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "create registry"))
+	}
+
+	return r
+}
+
+func TestFieldDefaults(t *testing.T) {
+	r := testRegistry(t)
+
+	legacy, err := r.Proto("legacy.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get legacy.proto"))
+	}
+
+	msg := legacy.Message(r, "Defaults")
+	defaults := map[string]any{}
+	for _, name := range []string{"i32", "u32", "u64", "f32", "f64", "exp", "b", "str", "raw", "enum", "none"} {
+		v, err := msg.Field(r, name).Default(r)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "get default of "+name))
+		}
+		defaults[name] = v
+	}
+
+	assert.Equal(t, any(-16), defaults["i32"])
+	assert.Equal(t, any(uint(15)), defaults["u32"])
+	assert.Equal(t, any(uint(18446744073709551615)), defaults["u64"])
+	assert.True(t, math.IsInf(defaults["f32"].(float64), -1))
+	assert.True(t, math.IsNaN(defaults["f64"].(float64)))
+	assert.Equal(t, any(1500.0), defaults["exp"])
+	assert.Equal(t, any(true), defaults["b"])
+	assert.Equal(t, any("tab\tquote\"AAé"), defaults["str"])
+	assert.Equal(t, any([]byte{0, 0xff}), defaults["raw"])
+	assert.Equal(t, "ENUM_VALUE", defaults["enum"].(*past.EnumValue).Name())
+	assert.Equal(t, nil, defaults["none"])
+	assert.Equal(t, 0, len(slices.Collect(r.Options(msg.Field(r, "i32")))))
+
+	for _, name := range []string{"overflow", "negative", "unknown", "number"} {
+		_, err := msg.Field(r, name).Default(r)
+		assert.Error(t, err, "default of "+name)
+	}
+}
+
+func TestJSONNames(t *testing.T) {
+	r := testRegistry(t)
+
+	file, err := r.Proto("json_names.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get json_names.proto"))
+	}
+
+	names := map[string]string{}
+	for field := range file.Message(r, "Names").Fields(r) {
+		oneof, ok := field.Type(r).(*past.OneOf)
+		if !ok {
+			names[field.Name()] = field.JSONName()
+			continue
+		}
+
+		for branch := range oneof.Branches(r) {
+			names[branch.Name()] = branch.JSONName()
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"snake_case_name": "snakeCaseName",
+		"custom":          "customName",
+		"_leading":        "Leading",
+		"digit_1_x":       "digit1X",
+		"map_value":       "mapValue",
+		"branch_name":     "branchName",
+		"other":           "renamed",
+	}, names)
+	assert.Equal(t, 0, len(slices.Collect(r.Options(file.Message(r, "Names").Field(r, "custom")))))
+
+	conflicts := map[string][]string{}
+	for conflict := range r.JSONNameConflicts() {
+		var fields []string
+		for _, field := range conflict.Fields {
+			fields = append(fields, r.NodeIndex(field))
+		}
+		conflicts[r.NodeIndex(conflict.Message)+":"+conflict.JSONName] = fields
+	}
+	assert.Equal(t, map[string][]string{
+		".json_names.Conflicts:fooBar": {
+			".json_names.Conflicts.foo_bar",
+			".json_names.Conflicts.fooBar",
+			".json_names.Conflicts.value",
+		},
+		".json_names.Conflicts.Nested:b": {
+			".json_names.Conflicts.Nested.a",
+			".json_names.Conflicts.Nested.b",
+		},
+	}, conflicts)
+}
+
+func TestMaps(t *testing.T) {
+	r := testRegistry(t)
+
+	file, err := r.Proto("maps.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get maps.proto"))
+	}
+
+	msg := file.Message(r, "Maps")
+	mapOf := func(name string) *past.Map {
+		return msg.Field(r, name).Type(r).(*past.Map)
+	}
+
+	inner := mapOf("inner")
+	assertType[*past.String](t, inner.Key(), "check key type of inner")
+	assert.Equal(t, r.NodeByFullName(".maps.v1.Maps.Inner"), past.Node(inner.Value(r)))
+	assert.Equal(t, r.NodeByFullName(".maps.v1.Kind"), past.Node(mapOf("kind").Value(r)))
+	assert.Equal(t, r.NodeByFullName(".pb.EnumValuePayload"), past.Node(mapOf("imported").Value(r)))
+	assert.Equal(t, r.NodeByFullName(".maps.v1.Maps.Inner"), past.Node(mapOf("qualified").Value(r)))
+	assertType[*past.Bytes](t, mapOf("raw_bytes").Value(r), "check value type of raw_bytes")
+
+	entry := mapOf("raw_bytes").Entry(r)
+	assert.Equal(t, "RawBytesEntry", entry.Name())
+	assert.Equal(t, ".maps.v1.Maps.RawBytesEntry", r.NodeIndex(entry))
+	assert.True(t, entry.IsMapEntry())
+	assert.False(t, msg.IsMapEntry())
+	assert.Equal(t, past.Node(msg), r.NodeParent(entry))
+
+	innerEntry := inner.Entry(r)
+	key := innerEntry.Field(r, "key")
+	assertField[*past.String](t, r, key, 1)
+	assertFieldExact(t, r, innerEntry.Field(r, "value"), ".maps.v1.Maps.Inner", 2)
+	assert.Equal(t, 5, iterLen(msg.Fields(r)), "no of fields in the message")
+	assert.Equal(t, 1, iterLen(msg.Messages(r)), "no of nested messages")
+}
+
+func TestEnumValues(t *testing.T) {
+	r := testRegistry(t)
+
+	file, err := r.Proto("enums.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get enums.proto"))
+	}
+
+	first := file.Enum(r, "First")
+	assert.Equal(t, ".enums.FIRST", r.NodeIndex(first.Value(r, "FIRST")))
+	assert.Equal(t, past.Node(first.Value(r, "FIRST")), r.NodeByFullName(".enums.FIRST"))
+	assert.Equal(t, "FIRST", first.ValueByNumber(r, 1).Name())
+	assert.Equal(t, nil, first.ValueByNumber(r, 2))
+	assert.False(t, first.AllowAlias())
+	assert.True(t, first.IsOpen(r))
+
+	second := file.Enum(r, "Second")
+	assert.True(t, second.AllowAlias())
+	assert.Equal(t, "SECOND", second.ValueByNumber(r, 1).Name())
+	assert.False(t, second.Value(r, "SECOND").IsAlias(r))
+	assert.True(t, second.Value(r, "SECOND_ALIAS").IsAlias(r))
+
+	nested := file.Message(r, "Scope").Type(r, "Nested").(*past.Enum)
+	assert.Equal(t, ".enums.Scope.NESTED_UNSPECIFIED", r.NodeIndex(nested.Value(r, "NESTED_UNSPECIFIED")))
+
+	legacy, err := r.Proto("legacy.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get legacy.proto"))
+	}
+	assert.False(t, legacy.Enum(r, "Enum").IsOpen(r))
+
+	collisions := map[string][2]string{}
+	for collision := range r.Collisions() {
+		collisions[collision.Name] = [2]string{
+			r.NodeDescription(collision.Previous),
+			r.NodeDescription(collision.Node),
+		}
+	}
+	assert.Equal(t, map[string][2]string{
+		".enums.UNSPECIFIED": {"enum value", "enum value"},
+		".enums.Scope.Inner": {"enum value", "message"},
+	}, collisions)
+}
+
+func TestOptionLiterals(t *testing.T) {
+	r := testRegistry(t)
+
+	file, err := r.Proto("options.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get options.proto"))
+	}
+
+	values := map[string]past.OptionValueVariant{}
+	for option := range r.Options(file.Message(r, "Literals")) {
+		values[option.Name()] = option.Value()
+	}
+
+	assert.Equal(t, uint(0xFFFFFFFF), values["(u32)"].(*past.OptionValueUint).Value)
+	assert.Equal(t, uint(18446744073709551615), values["(u64)"].(*past.OptionValueUint).Value)
+	assert.Equal(t, -0x80000000, values["(i32)"].(*past.OptionValueInt).Value)
+	assert.Equal(t, 0777, values["(s64)"].(*past.OptionValueInt).Value)
+	assert.True(t, math.IsInf(values["(f32)"].(*past.OptionValueFloat).Value, -1))
+	assert.True(t, math.IsNaN(values["(f64)"].(*past.OptionValueFloat).Value))
+	assert.Equal(t, "line\nquoted \"x\" Aé", values["(str)"].(*past.OptionValueString).Value)
+	assert.Equal(t, []byte{1, 0xff}, values["(raw)"].(*past.OptionValueBytes).Value)
+	assert.Equal(t, "LEVEL_HIGH", values["(level)"].(*past.OptionValueEnum).Value.Name())
+	assert.Equal(t, "[1, -2, 3]", values["(numbers)"].String())
+	assert.Equal(
+		t,
+		"{i32: 16, tags: [a, b, c], counters: [{key: x, value: -5}, {key: y, value: 7}], level: Level.LEVEL_HIGH, nested: {ratio: 1.5}}",
+		values["(payload)"].String(),
+	)
+
+	for option := range r.Options(file.Message(r, "Overflow")) {
+		_, err := option.TryValue()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "options.proto:61:")
+	}
+
+	_, err = r.OptionNamed(file.Message(r, "SetTwice"), "(payload)").TryValue()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "options.proto:75:10: non-repeated field i32 already set at options.proto:74:10")
+
+	extensions, err := r.Proto("literal_extensions.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get literal_extensions.proto"))
+	}
+
+	value := r.OptionNamed(extensions.Message(r, "Extended"), "(base)").Value()
+	data, err := value.MarshalJSON()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "marshal extended value"))
+	}
+	assert.Equal(t, `{"id":1,"[literals.extra]":2}`, string(data))
+
+	_, err = r.OptionNamed(extensions.Message(r, "Foreign"), "(base)").TryValue()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown message .literals.Base field literals.Other.id")
+}
+
+func TestOptionSubfields(t *testing.T) {
+	r := testRegistry(t)
+
+	file, err := r.Proto("options.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get options.proto"))
+	}
+
+	msg := file.Message(r, "Partial")
+	options := slices.Collect(r.Options(msg))
+	assert.Equal(t, 1, len(options), "partial assignments must be merged")
+	option := options[0]
+	assert.Equal(t, "(payload)", option.Name())
+	assert.True(t, option.Is(r, ".opts.payload"))
+
+	value := option.Value().(*past.OptionValueMap)
+	assert.Equal(t, "{i32: 1, nested: {level: Level.LEVEL_HIGH, tags: [c]}, tags: [a, b]}", value.String())
+
+	lines := map[string]int{}
+	for _, item := range value.Value {
+		lines[item.Key] = r.Pos(item.Value).Line
+	}
+	nested := value.Value[1].Value.(*past.OptionValueMap)
+	for _, item := range nested.Value {
+		lines["nested."+item.Key] = r.Pos(item.Value).Line
+	}
+	assert.Equal(t, map[string]int{"i32": 65, "nested": 66, "nested.level": 66, "nested.tags": 69, "tags": 67}, lines)
+
+	assert.Equal(t, option.Name(), r.OptionNamed(msg, "(payload)").Name())
+	assert.Equal(t, option.Name(), r.OptionNamed(msg, ".opts.payload").Name())
+	assert.Equal(t, nil, r.OptionNamed(msg, ".opts.level"))
+
+	_, err = r.OptionNamed(file.Message(r, "SetAgain"), "(payload)").TryValue()
+	assert.EqualError(t, err, "options.proto:81:3: option (payload).i32 was already set at options.proto:80:3")
+
+	_, err = r.OptionNamed(file.Message(r, "SetInAggregate"), "(payload)").TryValue()
+	assert.EqualError(t, err, "options.proto:86:3: option (payload).i32 was already set at options.proto:85:3")
+
+	editions, err := r.Proto("editions.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get editions.proto"))
+	}
+	var names []string
+	for option := range r.Options(editions) {
+		names = append(names, option.Name()+" = "+option.Value().String())
+	}
+	assert.Equal(t, []string{
+		"(.google.protobuf.FileOptions).features = {field_presence: FieldPresence.IMPLICIT, utf8_validation: Utf8Validation.NONE}",
+	}, names)
+}
+
+func TestOptionDecode(t *testing.T) {
+	r := testRegistry(t)
+
+	file, err := r.Proto("options.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get options.proto"))
+	}
+
+	type payload struct {
+		I32      int32
+		Tags     []string         `proto:"tags"`
+		Counters map[string]int64 `proto:"counters"`
+		Level    string
+		Ratio    float32
+		Nested   *payload
+		Ignored  int `proto:"-"`
+	}
+
+	msg := file.Message(r, "Literals")
+	var p payload
+	if err := r.OptionNamed(msg, "(payload)").Decode(r, &p); err != nil {
+		t.Fatal(errors.Wrap(err, "decode (payload)"))
+	}
+	assert.Equal(t, payload{
+		I32:      16,
+		Tags:     []string{"a", "b", "c"},
+		Counters: map[string]int64{"x": -5, "y": 7},
+		Level:    "LEVEL_HIGH",
+		Nested:   &payload{Ratio: 1.5},
+	}, p)
+
+	var numbers []int8
+	if err := r.OptionNamed(msg, "(numbers)").Decode(r, &numbers); err != nil {
+		t.Fatal(errors.Wrap(err, "decode (numbers)"))
+	}
+	assert.Equal(t, []int8{1, -2, 3}, numbers)
+
+	var level int
+	if err := r.DecodeOptionValue(r.OptionNamed(msg, "(level)").Value(), &level); err != nil {
+		t.Fatal(errors.Wrap(err, "decode (level)"))
+	}
+	assert.Equal(t, 1, level)
+
+	var value past.OptionValueVariant
+	if err := r.OptionNamed(msg, "(str)").Decode(r, &value); err != nil {
+		t.Fatal(errors.Wrap(err, "decode (str) as is"))
+	}
+	assert.Equal(t, "line\nquoted \"x\" Aé", value.(*past.OptionValueString).Value)
+
+	var unsigned []uint
+	err = r.OptionNamed(msg, "(numbers)").Decode(r, &unsigned)
+	assert.EqualError(t, err, "(numbers)[1]: value -2 overflows uint")
+
+	var wrong struct {
+		Nested struct {
+			Ratio string
+		}
+	}
+	err = r.OptionNamed(msg, "(payload)").Decode(r, &wrong)
+	assert.EqualError(t, err, "(payload).nested.ratio: cannot decode float into string")
+
+	err = r.OptionNamed(msg, "(payload)").Decode(r, wrong)
+	assert.Error(t, err)
+}
+
+func TestOptionValueJSON(t *testing.T) {
+	r := testRegistry(t)
+
+	file, err := r.Proto("options.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get options.proto"))
+	}
+
+	msg := file.Message(r, "Literals")
+	payload := r.OptionNamed(msg, "(payload)").Value()
+	assert.Equal(t, any(map[string]any{
+		"i32":      16,
+		"tags":     []any{"a", "b", "c"},
+		"counters": map[string]any{"x": -5, "y": 7},
+		"level":    "LEVEL_HIGH",
+		"nested":   map[string]any{"ratio": 1.5},
+	}), payload.Interface())
+
+	// Omitted keys and values of map entries are defaults, the last entry of the same key wins.
+	entries := r.OptionNamed(file.Message(r, "MapEntries"), "(payload)").Value()
+	assert.Equal(t, any(map[string]any{"counters": map[string]any{"": 3, "k": 0, "d": 2}}), entries.Interface())
+	data, err := entries.MarshalJSON()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "marshal map entries"))
+	}
+	assert.Equal(t, `{"counters":{"":"3","k":"0","d":"2"}}`, string(data))
+
+	cases := map[string]string{
+		"(payload)": `{"i32":16,"tags":["a","b","c"],"counters":{"x":"-5","y":"7"},"level":"LEVEL_HIGH","nested":{"ratio":1.5}}`,
+		"(u64)":     `"18446744073709551615"`,
+		"(u32)":     `4294967295`,
+		"(f32)":     `"-Infinity"`,
+		"(f64)":     `"NaN"`,
+		"(raw)":     `"Af8="`,
+		"(str)":     `"line\nquoted \"x\" Aé"`,
+		"(numbers)": `[1,-2,3]`,
+	}
+	for name, expected := range cases {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(r.OptionNamed(msg, name).Value())
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "marshal option value"))
+			}
+			assert.Equal(t, expected, string(data))
+		})
+	}
+}
+
+func TestOptionAnyExpansion(t *testing.T) {
+	r := testRegistry(t)
+
+	file, err := r.Proto("any_options.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get any_options.proto"))
+	}
+
+	msg := file.Message(r, "Expanded")
+	value := r.OptionNamed(msg, "(any)").Value().(*past.OptionValueAny)
+	assert.Equal(t, "type.googleapis.com/opts.Payload", value.TypeURL)
+	assert.Equal(t, ".opts.Payload", r.NodeIndex(value.Type))
+	assert.Equal(t, "{[type.googleapis.com/opts.Payload]: {i32: 3, tags: [a/b], nested: {level: Level.LEVEL_HIGH}}}", value.String())
+	assert.Equal(t, 16, r.Pos(value).Line)
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "marshal any value"))
+	}
+	assert.Equal(t, `{"@type":"type.googleapis.com/opts.Payload","i32":3,"tags":["a/b"],"nested":{"level":"LEVEL_HIGH"}}`, string(data))
+
+	anys := r.OptionNamed(msg, "(anys)").Value().(*past.OptionValueArray)
+	assert.Equal(t, `[{[type.googleapis.com/opts.Payload]: {}}, {type_url: example.com/raw, value: [1]}]`, anys.String())
+
+	for option := range r.Options(file.Message(r, "Unknown")) {
+		_, err := option.TryValue()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown message opts.Missing of type URL type.googleapis.com/opts.Missing")
+	}
+
+	urls, err := r.Proto("any_urls.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get any_urls.proto"))
+	}
+
+	nested := r.OptionNamed(urls.Message(r, "Nested"), "(any_url)").Value().(*past.OptionValueAny)
+	assert.Equal(t, "a.com/x.Y", nested.TypeURL)
+	assert.Equal(t, ".x.Y", r.NodeIndex(nested.Type))
+
+	topLevel := r.OptionNamed(urls.Message(r, "TopLevel"), "(any_url)").Value().(*past.OptionValueAny)
+	assert.Equal(t, "a.com.x/Y", topLevel.TypeURL)
+	assert.Equal(t, ".Y", r.NodeIndex(topLevel.Type))
+
+	_, err = r.OptionNamed(urls.Message(r, "Extension"), "(any_url)").TryValue()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown message .google.protobuf.Any field a.com.x.Y")
+}
+
+func TestEffectiveOption(t *testing.T) {
+	r := testRegistry(t)
+
+	file, err := r.Proto("visibility.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get visibility.proto"))
+	}
+
+	visibility := func(node past.Node) string {
+		switch node.(type) {
+		case *past.Method:
+			return ".meta.v1.visibility"
+		case *past.Service:
+			return ".meta.v1.service_visibility"
+		case *past.File:
+			return ".meta.v1.file_visibility"
+		default:
+			return ""
+		}
+	}
+	effective := func(service, method string) (string, string) {
+		option, node := r.EffectiveOptionMapped(file.Service(r, service).Method(r, method), visibility)
+		if option == nil {
+			return "", ""
+		}
+		return option.Value().String(), r.NodeDescription(node)
+	}
+
+	var value, provider string
+	value, provider = effective("Public", "Drop")
+	assert.Equal(t, "Visibility.INTERNAL", value)
+	assert.Equal(t, "method", provider)
+	value, provider = effective("Public", "Get")
+	assert.Equal(t, "Visibility.PUBLIC", value)
+	assert.Equal(t, "service", provider)
+	value, provider = effective("Inherited", "Get")
+	assert.Equal(t, "Visibility.INTERNAL", value)
+	assert.Equal(t, "file", provider)
+
+	method := file.Service(r, "Public").Method(r, "Drop")
+	option, node := r.EffectiveOption(method, ".meta.v1.non_standard_method")
+	assert.Equal(t, "(non_standard_method)", option.Name())
+	assert.Equal(t, past.Node(method), node)
+
+	option, node = r.EffectiveOption(file.Service(r, "Inherited").Method(r, "Get"), ".meta.v1.visibility")
+	if option != nil || node != nil {
+		t.Error("no visibility option expected for Inherited.Get")
+	}
+}
+
+func TestAnnotated(t *testing.T) {
+	r := testRegistry(t)
+
+	if _, err := r.Proto("visibility.proto"); err != nil {
+		t.Fatal(errors.Wrap(err, "get visibility.proto"))
+	}
+	if _, err := r.Proto("all_options.proto"); err != nil {
+		t.Fatal(errors.Wrap(err, "get all_options.proto"))
+	}
+
+	collect := func(name string) []string {
+		var res []string
+		for node, option := range r.Annotated(name) {
+			res = append(res, r.NodeDescription(node)+" "+r.NodeIndex(node)+" = "+option.Value().String())
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"method .meta.v1.Public.Drop = true"}, collect(".meta.v1.non_standard_method"))
+	assert.Equal(t, []string{"method .meta.v1.Public.Drop = Visibility.INTERNAL"}, collect(".meta.v1.visibility"))
+	assert.Equal(t, []string{"service .meta.v1.Public = Visibility.PUBLIC"}, collect(".meta.v1.service_visibility"))
+	assert.Equal(t, []string{"enum value .all.VALUE = value"}, collect(".all.enum_value"))
+	assert.Equal(t, 0, len(collect(".meta.v1.unknown")))
+}
+
+func TestOptionTargets(t *testing.T) {
+	r := testRegistry(t)
+
+	file, err := r.Proto("targets.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get targets.proto"))
+	}
+	if _, err := r.Proto("editions_targets.proto"); err != nil {
+		t.Fatal(errors.Wrap(err, "get editions_targets.proto"))
+	}
+
+	var violations []string
+	for v := range r.OptionTargetViolations() {
+		violations = append(violations, fmt.Sprintf(
+			"%s %s: %s (%s) allows %v",
+			r.NodeDescription(v.Node),
+			r.NodeIndex(v.Node),
+			v.Option.Name(),
+			r.NodeIndex(v.Field),
+			v.Targets,
+		))
+	}
+	assert.Equal(t, []string{
+		"message .targets.editions.Closed: (.google.protobuf.MessageOptions).features (.google.protobuf.FeatureSet.field_presence) allows [TARGET_TYPE_FIELD TARGET_TYPE_FILE]",
+		"message field .targets.Table.id: (misplaced) (.targets.misplaced) allows [TARGET_TYPE_FILE TARGET_TYPE_METHOD]",
+	}, violations)
+
+	var conflicts []string
+	for c := range r.ExtensionNumberConflicts() {
+		var names []string
+		for _, ext := range c.Extensions {
+			names = append(names, r.NodeIndex(ext))
+		}
+		conflicts = append(conflicts, fmt.Sprintf("%s %d: %v", r.NodeIndex(c.Extendee), c.Number, names))
+	}
+	assert.Equal(t, []string{".google.protobuf.FieldOptions 53001: [.targets.clash .targets.column]"}, conflicts)
+
+	msg := file.Message(r, "Table")
+	var all, runtime []string
+	for option := range r.Options(msg) {
+		all = append(all, option.Name()+" "+option.Retention().String())
+	}
+	for option := range r.RuntimeOptions(msg) {
+		runtime = append(runtime, option.Name())
+	}
+	assert.Equal(t, []string{"(owner) RETENTION_SOURCE", "(kind) RETENTION_RUNTIME"}, all)
+	assert.Equal(t, []string{"(kind)"}, runtime)
+}
+
+func TestAvailableOptions(t *testing.T) {
+	r := testRegistry(t)
+
+	if _, err := r.Proto("targets.proto"); err != nil {
+		t.Fatal(errors.Wrap(err, "get targets.proto"))
+	}
+
+	var builtin, custom []string
+	for option := range r.AvailableOptions(past.OptionTargetTypeField) {
+		if option.File.Name() != "targets.proto" {
+			builtin = append(builtin, option.Name)
+			continue
+		}
+
+		custom = append(custom, fmt.Sprintf(
+			"%s %s %d %q",
+			option.Name,
+			r.TypeName(option.Type),
+			option.Number,
+			strings.Join(option.Comment, "\n"),
+		))
+	}
+	assert.True(t, slices.Contains(builtin, "deprecated"))
+	assert.False(t, slices.Contains(builtin, "json_name"))
+	assert.Equal(t, []string{
+		`(targets.clash) string 53001 ""`,
+		`(targets.column) string 53001 " column is a database column name."`,
+	}, custom)
+
+	var messages []string
+	for option := range r.AvailableOptions(past.OptionTargetTypeMessage) {
+		if option.File.Name() == "targets.proto" {
+			messages = append(messages, option.Name)
+		}
+	}
+	assert.Equal(t, []string{"(targets.kind)", "(targets.owner)"}, messages)
+}
+
+func TestOptionsEverywhere(t *testing.T) {
+	r := testRegistry(t)
+
+	file, err := r.Proto("all_options.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get all_options.proto"))
+	}
+
+	msg := file.Message(r, "Message")
+	oneof := msg.Field(r, "choice")
+	enum := file.Enum(r, "Enum")
+	service := file.Service(r, "Service")
+	var extensions *past.Extensions
+	for node := range msg.Everything(r) {
+		if v, ok := node.(*past.Extensions); ok {
+			extensions = v
+		}
+	}
+	if extensions == nil {
+		t.Fatal("extensions not found")
+	}
+	assert.Equal(t, "&{100 199}", fmt.Sprint(slices.Collect(extensions.Values())[0]))
+
+	nodes := []struct {
+		node past.NodeOptionable
+		name string
+		want string
+	}{
+		{node: file, name: "(file)", want: "file"},
+		{node: msg, name: "(message)", want: "message"},
+		{node: msg.Field(r, "normal"), name: "(field)", want: "normal"},
+		{node: msg.Field(r, "map"), name: "(field)", want: "map"},
+		{node: oneof, name: "(oneof)", want: "oneof"},
+		{node: oneof.Type(r).(*past.OneOf), name: "(oneof)", want: "oneof"},
+		{node: oneof.Type(r).(*past.OneOf).Branch(r, "branch"), name: "(field)", want: "branch"},
+		{node: extensions, name: "(range)", want: "range"},
+		{node: enum, name: "(enum)", want: "enum"},
+		{node: enum.Value(r, "VALUE"), name: "(enum_value)", want: "value"},
+		{node: service, name: "(service)", want: "service"},
+		{node: service.Method(r, "Method"), name: "(method)", want: "method"},
+	}
+	for _, n := range nodes {
+		t.Run(r.NodeDescription(n.node), func(t *testing.T) {
+			options := slices.Collect(r.Options(n.node))
+			if len(options) == 0 {
+				t.Fatal("no options found")
+			}
+			assert.Equal(t, n.name, options[0].Name())
+			assert.Equal(t, n.want, options[0].Value().String())
+
+			named := r.OptionNamed(n.node, n.name)
+			if named == nil {
+				t.Fatalf("option %s not found", n.name)
+			}
+			assert.Equal(t, n.want, named.Value().String())
+
+			fullName := ".all." + strings.Trim(n.name, "()")
+			if r.OptionNamed(n.node, fullName) == nil {
+				t.Errorf("option %s not found", fullName)
+			}
+		})
+	}
+
+	deprecated := r.OptionNamed(msg.Field(r, "normal"), "deprecated")
+	if deprecated == nil {
+		t.Fatal("option deprecated not found")
+	}
+	assert.Equal(t, "(.google.protobuf.FieldOptions).deprecated", deprecated.Name())
+	assert.Equal(t, "true", deprecated.Value().String())
+
+	var reserved []string
+	for node := range enum.Everything(r) {
+		if v, ok := node.(*past.Reserved); ok {
+			for value := range v.Values() {
+				reserved = append(reserved, fmt.Sprint(value))
+			}
+			assert.Equal(t, past.Node(enum), r.NodeParent(v))
+		}
+	}
+	assert.Equal(t, []string{"&{2}", "&{10 20}", "&{REMOVED}"}, reserved)
+}
+
+func TestFileDescriptorSet(t *testing.T) {
+	r := testRegistry(t)
+
+	file, err := r.Proto("descriptor.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get descriptor.proto"))
+	}
+
+	set, err := r.FileDescriptorSet([]*past.File{file}, past.DescriptorOptions{
+		SourceCodeInfo: true,
+		IncludeImports: true,
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "encode descriptor set"))
+	}
+
+	var names []string
+	var fdp []byte
+	for _, f := range wireFields(t, set)[1] {
+		name := string(wireFields(t, f.Value)[1][0].Value)
+		names = append(names, name)
+		if name == "descriptor.proto" {
+			fdp = f.Value
+		}
+	}
+	assert.Equal(t, []string{"google/protobuf/descriptor.proto", "desc_options.proto", "descriptor.proto"}, names)
+
+	fileFields := wireFields(t, fdp)
+	assert.Equal(t, "desc.v1", string(fileFields[2][0].Value))
+	assert.Equal(t, "desc_options.proto", string(fileFields[3][0].Value))
+	assert.Equal(t, "proto3", string(fileFields[12][0].Value))
+
+	item := wireFields(t, fileFields[4][0].Value)
+	assert.Equal(t, "Item", string(item[1][0].Value))
+
+	type field struct {
+		name     string
+		number   uint64
+		label    uint64
+		typ      uint64
+		typeName string
+		jsonName string
+		oneof    int
+		optional bool
+	}
+	var fields []field
+	for _, f := range item[2] {
+		ff := wireFields(t, f.Value)
+		v := field{
+			name:     string(ff[1][0].Value),
+			number:   wireVarint(t, ff[3][0]),
+			label:    wireVarint(t, ff[4][0]),
+			typ:      wireVarint(t, ff[5][0]),
+			jsonName: string(ff[10][0].Value),
+			oneof:    -1,
+			optional: len(ff[17]) > 0,
+		}
+		if len(ff[6]) > 0 {
+			v.typeName = string(ff[6][0].Value)
+		}
+		if len(ff[9]) > 0 {
+			v.oneof = int(wireVarint(t, ff[9][0]))
+		}
+		fields = append(fields, v)
+	}
+	assert.Equal(t, []field{
+		{name: "item_id", number: 1, label: 1, typ: 9, jsonName: "itemId", oneof: -1},
+		{name: "count", number: 2, label: 1, typ: 5, jsonName: "count", oneof: 1, optional: true},
+		{name: "children", number: 3, label: 3, typ: 11, typeName: ".desc.v1.Item.ChildrenEntry", jsonName: "children", oneof: -1},
+		{name: "level", number: 4, label: 1, typ: 14, typeName: ".desc.opts.Level", jsonName: "level", oneof: 0},
+		{name: "raw", number: 5, label: 1, typ: 12, jsonName: "raw", oneof: 0},
+		{name: "numbers", number: 6, label: 3, typ: 5, jsonName: "numbers", oneof: -1},
+	}, fields)
+
+	var oneofs []string
+	for _, o := range item[8] {
+		oneofs = append(oneofs, string(wireFields(t, o.Value)[1][0].Value))
+	}
+	assert.Equal(t, []string{"choice", "_count"}, oneofs)
+
+	entry := wireFields(t, item[3][0].Value)
+	assert.Equal(t, "ChildrenEntry", string(entry[1][0].Value))
+	assert.Equal(t, uint64(1), wireVarint(t, wireFields(t, entry[7][0].Value)[7][0]))
+
+	var ranges [][2]uint64
+	for _, rng := range item[9] {
+		rf := wireFields(t, rng.Value)
+		ranges = append(ranges, [2]uint64{wireVarint(t, rf[1][0]), wireVarint(t, rf[2][0])})
+	}
+	assert.Equal(t, [][2]uint64{{10, 13}, {20, 1 << 29}}, ranges)
+	assert.Equal(t, "old", string(item[10][0].Value))
+
+	// (desc.opts.level) = LEVEL_HIGH is the extension 50009 of MessageOptions.
+	itemOptions := wireFields(t, item[7][0].Value)
+	assert.Equal(t, uint64(1), wireVarint(t, itemOptions[50009][0]))
+
+	// deprecated = true is the field 3 of FieldOptions.
+	rawOptions := wireFields(t, wireFields(t, item[2][4].Value)[8][0].Value)
+	assert.Equal(t, uint64(1), wireVarint(t, rawOptions[3][0]))
+
+	method := wireFields(t, wireFields(t, fileFields[6][0].Value)[2][0].Value)
+	assert.Equal(t, ".desc.v1.Item", string(method[2][0].Value))
+	assert.Equal(t, ".desc.v1.Item", string(method[3][0].Value))
+	assert.Equal(t, 0, len(method[5]))
+	assert.Equal(t, uint64(1), wireVarint(t, method[6][0]))
+
+	comments := map[string][2]string{}
+	for _, loc := range wireFields(t, fileFields[9][0].Value)[1] {
+		lf := wireFields(t, loc.Value)
+		var path []string
+		for b := lf[1][0].Value; len(b) > 0; {
+			v, n, err := wire.ConsumeVarint(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path = append(path, fmt.Sprint(v))
+			b = b[n:]
+		}
+
+		var c [2]string
+		if len(lf[3]) > 0 {
+			c[0] = string(lf[3][0].Value)
+		}
+		if len(lf[4]) > 0 {
+			c[1] = string(lf[4][0].Value)
+		}
+		comments[strings.Join(path, ",")] = c
+	}
+	assert.Equal(t, [2]string{" Package comment.\n", ""}, comments["2"])
+	assert.Equal(t, [2]string{" Item is a stored item.\n", ""}, comments["4,0"])
+	assert.Equal(t, [2]string{"", " Identifier.\n"}, comments["4,0,2,0"])
+	assert.Equal(t, [2]string{" Get returns an item.\n", ""}, comments["6,0,2,0"])
+}
+
+func wireFields(t *testing.T, b []byte) map[int][]wire.Field {
+	t.Helper()
+
+	fields, err := wire.Fields(b)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "decode wire fields"))
+	}
+
+	res := map[int][]wire.Field{}
+	for _, f := range fields {
+		res[f.Number] = append(res[f.Number], f)
+	}
+
+	return res
+}
+
+func wireVarint(t *testing.T, f wire.Field) uint64 {
+	t.Helper()
+
+	v, _, err := wire.ConsumeVarint(f.Value)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "decode varint"))
+	}
+
+	return v
+}
+
+func TestFileDescriptorProtoDefaults(t *testing.T) {
+	r := testRegistry(t)
+
+	file, err := r.Proto("desc_defaults.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get desc_defaults.proto"))
+	}
+
+	fdp, err := r.FileDescriptorProto(file, past.DescriptorOptions{})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "encode desc_defaults.proto"))
+	}
+
+	// Fields go in the order of numbers no matter how elements are interleaved in the source.
+	ordered := func(b []byte) bool {
+		fields, err := wire.Fields(b)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "decode wire fields"))
+		}
+
+		return slices.IsSortedFunc(fields, func(a, b wire.Field) int {
+			return a.Number - b.Number
+		})
+	}
+	msg := wireFields(t, fdp)[4][0].Value
+	assert.True(t, ordered(fdp))
+	assert.True(t, ordered(msg))
+	assert.True(t, ordered(wireFields(t, msg)[4][0].Value))
+
+	defaults := map[string]string{}
+	for _, f := range wireFields(t, msg)[2] {
+		assert.True(t, ordered(f.Value))
+
+		ff := wireFields(t, f.Value)
+		if len(ff[7]) > 0 {
+			defaults[string(ff[1][0].Value)] = string(ff[7][0].Value)
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"tenth":   "0.1",
+		"third":   "0.33333333333333331",
+		"large":   "1000000",
+		"tiny":    "1.5e-07",
+		"neg_inf": "-inf",
+		"kind":    "KIND_KNOWN",
+	}, defaults)
+}
+
+func TestRegistryFromDescriptorSet(t *testing.T) {
+	r := testRegistry(t)
+
+	for _, name := range []string{"descriptor.proto", "all_options.proto", "editions.proto", "maps.proto", "json_names.proto", "desc_defaults.proto"} {
+		t.Run(name, func(t *testing.T) {
+			file, err := r.Proto(name)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "get "+name))
+			}
+
+			for _, sourceInfo := range []bool{true, false} {
+				opts := past.DescriptorOptions{
+					SourceCodeInfo: sourceInfo,
+					IncludeImports: true,
+				}
+				set, err := r.FileDescriptorSet([]*past.File{file}, opts)
+				if err != nil {
+					t.Fatal(errors.Wrap(err, "encode descriptor set"))
+				}
+
+				loaded, err := protoast.NewRegistryFromDescriptorSet(set)
+				if err != nil {
+					t.Fatal(errors.Wrap(err, "load descriptor set"))
+				}
+
+				loadedFile, err := loaded.Proto(name)
+				if err != nil {
+					t.Fatal(errors.Wrap(err, "get loaded "+name))
+				}
+
+				again, err := loaded.FileDescriptorSet([]*past.File{loadedFile}, opts)
+				if err != nil {
+					t.Fatal(errors.Wrap(err, "encode loaded descriptor set"))
+				}
+				assert.Equal(t, set, again)
+			}
+		})
+	}
+
+	var future []byte
+	future = wire.AppendString(wire.AppendTag(future, 1, wire.BytesType), "future.proto")
+	future = wire.AppendString(wire.AppendTag(future, 12, wire.BytesType), "editions")
+	future = wire.AppendVarint(wire.AppendTag(future, 14, wire.VarintType), 2099)
+	_, err := protoast.NewRegistryFromDescriptorSet(wire.AppendBytes(wire.AppendTag(nil, 1, wire.BytesType), future))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "future.proto: unsupported edition 2099")
+}
+
+func TestRegistryFromDescriptorSetNodes(t *testing.T) {
+	r := testRegistry(t)
+
+	var files []*past.File
+	for _, name := range []string{"desc_options.proto", "descriptor.proto"} {
+		file, err := r.Proto(name)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "get "+name))
+		}
+		files = append(files, file)
+	}
+
+	// The set has no google/protobuf/descriptor.proto, the embedded one is used then.
+	set, err := r.FileDescriptorSet(files, past.DescriptorOptions{SourceCodeInfo: true})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "encode descriptor set"))
+	}
+
+	loaded, err := protoast.NewRegistryFromDescriptorSet(set)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "load descriptor set"))
+	}
+
+	var names []string
+	for file := range loaded.Files() {
+		names = append(names, file.Name())
+	}
+	assert.Equal(t, []string{"desc_options.proto", "descriptor.proto", "google/protobuf/descriptor.proto"}, names)
+
+	file, err := loaded.Proto("descriptor.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get loaded descriptor.proto"))
+	}
+	assert.Equal(t, "proto3", file.Edition())
+
+	item := file.Message(loaded, "Item")
+	assert.Equal(t, "descriptor.proto:9:1", loaded.Pos(item).String())
+	assert.Equal(t, []string{" Item is a stored item."}, loaded.Comment(item))
+	assert.Equal(t, "Level.LEVEL_HIGH", loaded.OptionNamed(item, "(desc.opts.level)").Value().String())
+
+	itemID := item.Field(loaded, "item_id")
+	assert.Equal(t, "descriptor.proto:12:3", loaded.Pos(itemID).String())
+
+	assert.True(t, item.Field(loaded, "count").Optional())
+	children, ok := item.Field(loaded, "children").Type(loaded).(*past.Map)
+	if !ok {
+		t.Fatalf("map expected for children, got %T", item.Field(loaded, "children").Type(loaded))
+	}
+	assert.Equal(t, ".desc.v1.Item", loaded.NodeIndex(children.Value(loaded).(*past.Message)))
+
+	choice := item.Field(loaded, "choice").Type(loaded).(*past.OneOf)
+	raw := choice.Branch(loaded, "raw")
+	assert.Equal(t, "true", loaded.OptionNamed(raw, "deprecated").Value().String())
+	assert.Equal[past.Node](t, raw, loaded.NodeParent(loaded.OptionNamed(raw, "deprecated")))
+	assert.Equal(t, ".desc.opts.Level", loaded.NodeIndex(choice.Branch(loaded, "level").Type(loaded).(*past.Enum)))
+
+	method := file.Service(loaded, "Items").Method(loaded, "Get")
+	assert.Equal(t, []string{" Get returns an item."}, loaded.Comment(method))
+	inStream, _ := method.Input(loaded)
+	outStream, output := method.Output(loaded)
+	assert.False(t, inStream)
+	assert.True(t, outStream)
+	assert.Equal(t, ".desc.v1.Item", loaded.NodeIndex(output))
+
+	var annotated []string
+	for node := range loaded.Annotated(".desc.opts.level") {
+		annotated = append(annotated, loaded.NodeIndex(node))
+	}
+	assert.Equal(t, []string{".desc.v1.Item"}, annotated)
+}
+
+func TestRunPlugin(t *testing.T) {
+	r := testRegistry(t)
+
+	file, err := r.Proto("descriptor.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get descriptor.proto"))
+	}
+
+	set, err := r.FileDescriptorSet([]*past.File{file}, past.DescriptorOptions{IncludeImports: true})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "encode descriptor set"))
+	}
+
+	var request []byte
+	request = wire.AppendTag(request, 1, wire.BytesType)
+	request = wire.AppendString(request, "descriptor.proto")
+	request = wire.AppendTag(request, 2, wire.BytesType)
+	request = wire.AppendString(request, "suffix=.txt")
+	var version []byte
+	for i, v := range []uint64{5, 29, 0} {
+		version = wire.AppendTag(version, i+1, wire.VarintType)
+		version = wire.AppendVarint(version, v)
+	}
+	request = wire.AppendTag(request, 3, wire.BytesType)
+	request = wire.AppendBytes(request, version)
+	for _, f := range wireFields(t, set)[1] {
+		request = wire.AppendTag(request, 15, wire.BytesType)
+		request = wire.AppendBytes(request, f.Value)
+	}
+
+	gen := func(p *protoast.Plugin) error {
+		assert.Equal(t, "suffix=.txt", p.Parameter)
+		assert.Equal(t, "5.29.0", p.CompilerVersion)
+
+		for _, file := range p.Files {
+			var content strings.Builder
+			for msg := range file.Messages(p.Registry) {
+				content.WriteString(p.Registry.NodeIndex(msg) + "\n")
+			}
+			p.AddFile(file.Name()+strings.TrimPrefix(p.Parameter, "suffix="), content.String())
+		}
+		p.AddInsertion("other.go", "imports", "// inserted\n")
+		return nil
+	}
+
+	var out bytes.Buffer
+	if err := protoast.RunPluginWith(bytes.NewReader(request), &out, gen); err != nil {
+		t.Fatal(errors.Wrap(err, "run plugin"))
+	}
+
+	response := wireFields(t, out.Bytes())
+	assert.Equal(t, 0, len(response[1]))
+	assert.Equal(t, uint64(3), wireVarint(t, response[2][0]))
+
+	type generated struct {
+		name, point, content string
+	}
+	var files []generated
+	for _, f := range response[15] {
+		ff := wireFields(t, f.Value)
+		var g generated
+		g.name = string(ff[1][0].Value)
+		if len(ff[2]) > 0 {
+			g.point = string(ff[2][0].Value)
+		}
+		g.content = string(ff[15][0].Value)
+		files = append(files, g)
+	}
+	assert.Equal(t, []generated{
+		{name: "descriptor.proto.txt", content: ".desc.v1.Item\n"},
+		{name: "other.go", point: "imports", content: "// inserted\n"},
+	}, files)
+
+	out.Reset()
+	err = protoast.RunPluginWith(bytes.NewReader(request), &out, func(p *protoast.Plugin) error {
+		p.AddFile("dropped.txt", "")
+		return errors.New("unsupported option")
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "run failing plugin"))
+	}
+	response = wireFields(t, out.Bytes())
+	assert.Equal(t, "unsupported option", string(response[1][0].Value))
+	assert.Equal(t, 0, len(response[15]))
+}
+
+func TestDescriptorPath(t *testing.T) {
+	r := testRegistry(t)
+
+	file, err := r.Proto("descriptor.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get descriptor.proto"))
+	}
+
+	item := file.Message(r, "Item")
+	choice := item.Field(r, "choice")
+	raw := choice.Type(r).(*past.OneOf).Branch(r, "raw")
+	level := r.OptionNamed(item, "(desc.opts.level)")
+	deprecated := r.OptionNamed(raw, "deprecated")
+	children := item.Field(r, "children").Type(r).(*past.Map)
+	method := file.Service(r, "Items").Method(r, "Get")
+
+	tests := []struct {
+		name string
+		node past.Node
+		path []int
+	}{
+		{
+			name: "file",
+			node: file,
+			path: []int{},
+		},
+		{
+			name: "message",
+			node: item,
+			path: []int{4, 0},
+		},
+		{
+			name: "oneof branch",
+			node: choice.Type(r).(*past.OneOf).Branch(r, "level"),
+			path: []int{4, 0, 2, 3},
+		},
+		{
+			name: "repeated after oneof",
+			node: item.Field(r, "numbers"),
+			path: []int{4, 0, 2, 5},
+		},
+		{
+			name: "oneof",
+			node: choice,
+			path: []int{4, 0, 8, 0},
+		},
+		{
+			name: "message option",
+			node: level,
+			path: []int{4, 0, 7, 50009},
+		},
+		{
+			name: "field option",
+			node: deprecated,
+			path: []int{4, 0, 2, 4, 8, 3},
+		},
+		{
+			name: "method",
+			node: method,
+			path: []int{6, 0, 2, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.path, r.DescriptorPath(tt.node))
+			assert.Equal(t, r.DescriptorPath(tt.node), r.DescriptorPath(r.NodeByDescriptorPath(file, tt.path)))
+		})
+	}
+
+	// Types have no descriptor elements of their own.
+	assert.Zero(t, r.DescriptorPath(children))
+	assert.Equal[past.Node](t, item, r.NodeByDescriptorPath(file, []int{4, 0, 1}))
+	assert.Zero(t, r.NodeByDescriptorPath(file, []int{4, 0, 2, 99}))
+	assert.Zero(t, r.NodeByDescriptorPath(file, []int{4, 3}))
+
+	// Default values and JSON names are attributes of fields rather than options.
+	defaults, err := r.Proto("desc_defaults.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get desc_defaults.proto"))
+	}
+	msg := defaults.Message(r, "Defaults")
+	for _, tt := range []struct {
+		field string
+		path  []int
+	}{
+		{field: "tenth", path: []int{4, 0, 2, 0, 7}},
+		{field: "kind", path: []int{4, 0, 2, 5, 7}},
+		{field: "last", path: []int{4, 0, 2, 7, 10}},
+	} {
+		field := msg.Field(r, tt.field)
+		node := r.NodeByDescriptorPath(defaults, tt.path)
+		assert.Equal[past.Node](t, field, node)
+		assert.Equal(t, tt.path[:len(tt.path)-1], r.DescriptorPath(node))
+	}
+}
+
+func TestDescriptorPathSourceLocations(t *testing.T) {
+	r := testRegistry(t)
+
+	for _, name := range []string{"descriptor.proto", "all_options.proto", "editions.proto", "maps.proto"} {
+		t.Run(name, func(t *testing.T) {
+			file, err := r.Proto(name)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "get "+name))
+			}
+
+			set, err := r.FileDescriptorSet([]*past.File{file}, past.DescriptorOptions{
+				SourceCodeInfo: true,
+				IncludeImports: true,
+			})
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "encode descriptor set"))
+			}
+
+			loaded, err := protoast.NewRegistryFromDescriptorSet(set)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "load descriptor set"))
+			}
+
+			loadedFile, err := loaded.Proto(name)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "get loaded "+name))
+			}
+
+			// Imports go first, the file itself is the last one.
+			files := wireFields(t, set)[1]
+			fdp := wireFields(t, files[len(files)-1].Value)
+			locations := wireFields(t, fdp[9][0].Value)[1]
+			if len(locations) == 0 {
+				t.Fatal("no source locations")
+			}
+
+			for _, location := range locations {
+				var path []int
+				rest := wireFields(t, location.Value)[1][0].Value
+				for len(rest) > 0 {
+					v, n, err := wire.ConsumeVarint(rest)
+					if err != nil {
+						t.Fatal(errors.Wrap(err, "decode location path"))
+					}
+					path = append(path, int(v))
+					rest = rest[n:]
+				}
+
+				for _, reg := range []struct {
+					r    *protoast.Registry
+					file *past.File
+				}{{r, file}, {loaded, loadedFile}} {
+					node := reg.r.NodeByDescriptorPath(reg.file, path)
+					if node == nil {
+						t.Fatalf("no node for path %v", path)
+					}
+
+					got := reg.r.DescriptorPath(node)
+					switch node.(type) {
+					case *past.Reserved, *past.Extensions:
+						// These point to their first range or name.
+						assert.Equal(t, path[:len(got)-1], got[:len(got)-1], "path %v", path)
+					default:
+						assert.Equal(t, path[:len(got)], got, "path %v", path)
+					}
+				}
+			}
+		})
+	}
+}
+
+func dynamicPayload(t *testing.T, r *protoast.Registry) *past.Message {
+	t.Helper()
+
+	file, err := r.Proto("dynamic.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get dynamic.proto"))
+	}
+
+	return file.Message(r, "Payload")
+}
+
+func TestDecodeMessage(t *testing.T) {
+	r := testRegistry(t)
+	payload := dynamicPayload(t, r)
+
+	var b []byte
+	b = wire.AppendVarint(wire.AppendTag(b, 1, wire.VarintType), 150)
+	b = wire.AppendString(wire.AppendTag(b, 2, wire.BytesType), "hello")
+
+	var packed []byte
+	for _, v := range []int64{1, -2, 300} {
+		packed = wire.AppendVarint(packed, uint64(v))
+	}
+	b = wire.AppendBytes(wire.AppendTag(b, 3, wire.BytesType), packed)
+
+	var child []byte
+	child = wire.AppendVarint(wire.AppendTag(child, 1, wire.VarintType), 7)
+	var entry []byte
+	entry = wire.AppendString(wire.AppendTag(entry, 1, wire.BytesType), "a")
+	entry = wire.AppendBytes(wire.AppendTag(entry, 2, wire.BytesType), child)
+	b = wire.AppendBytes(wire.AppendTag(b, 4, wire.BytesType), entry)
+
+	b = wire.AppendString(wire.AppendTag(b, 5, wire.BytesType), "first")
+	var nested []byte
+	nested = wire.AppendString(wire.AppendTag(nested, 2, wire.BytesType), "n")
+	b = wire.AppendBytes(wire.AppendTag(b, 7, wire.BytesType), nested)
+
+	b = wire.AppendVarint(wire.AppendTag(b, 8, wire.VarintType), wire.EncodeZigZag(-3))
+	b = wire.AppendFixed64(wire.AppendTag(b, 9, wire.Fixed64Type), wire.FromFloat64(0.5))
+	b = wire.AppendString(wire.AppendTag(b, 11, wire.BytesType), "x")
+	b = wire.AppendString(wire.AppendTag(b, 11, wire.BytesType), "y")
+
+	entry = wire.AppendVarint(wire.AppendTag(nil, 1, wire.VarintType), 3)
+	b = wire.AppendBytes(wire.AppendTag(b, 15, wire.BytesType), entry)
+	b = wire.AppendVarint(wire.AppendTag(b, 17, wire.VarintType), 2)
+	b = wire.AppendVarint(wire.AppendTag(b, 17, wire.VarintType), 5)
+
+	b = wire.AppendVarint(wire.AppendTag(b, 99, wire.VarintType), 5)
+	b = wire.AppendFixed32(wire.AppendTag(b, 1, wire.Fixed32Type), 1)
+
+	nested = wire.AppendVarint(wire.AppendTag(nil, 1, wire.VarintType), 9)
+	b = wire.AppendBytes(wire.AppendTag(b, 7, wire.BytesType), nested)
+
+	msg, err := r.DecodeMessage(payload, b)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "decode payload"))
+	}
+
+	var names []string
+	for _, field := range msg.Fields {
+		names = append(names, field.Name())
+	}
+	assert.Equal(t, []string{"id", "name", "values", "children", "nested", "delta", "ratio", "tags", "labels", "kinds"}, names)
+
+	assert.Equal[any](t, int32(150), msg.Get("id").Value)
+	assert.Equal[any](t, "hello", msg.Get("name").Value)
+	assert.Equal[any](t, []any{int64(1), int64(-2), int64(300)}, msg.Get("values").Value)
+	assert.Equal[any](t, int32(-3), msg.Get("delta").Value)
+	assert.Equal[any](t, 0.5, msg.Get("ratio").Value)
+	assert.Equal[any](t, []any{"x", "y"}, msg.Get("tags").Value)
+	assert.Equal[any](t, []past.DynamicMapEntry{{Key: int32(3), Value: ""}}, msg.Get("labels").Value)
+
+	kinds := msg.Get("kinds").Value.([]any)
+	assert.Equal(t, "KIND_B", kinds[0].(*past.EnumValue).Name())
+	assert.Equal[any](t, int32(5), kinds[1])
+
+	children := msg.Get("children").Value.([]past.DynamicMapEntry)
+	assert.Equal(t, 1, len(children))
+	assert.Equal[any](t, "a", children[0].Key)
+	assert.Equal[any](t, int32(7), children[0].Value.(*past.DynamicMessage).Get("id").Value)
+
+	choice := msg.WhichOneOf("choice")
+	assert.Equal(t, "nested", choice.Name())
+	assert.Equal(t, 7, choice.Number())
+	assert.Zero(t, msg.Get("text"))
+	merged := choice.Value.(*past.DynamicMessage)
+	assert.Equal[any](t, "n", merged.Get("name").Value)
+	assert.Equal[any](t, int32(9), merged.Get("id").Value)
+
+	assert.Equal(t, 2, len(msg.Unknown))
+	assert.Equal(t, 99, msg.Unknown[0].Number)
+	assert.Equal(t, []byte{5}, msg.Unknown[0].Value)
+	assert.Equal(t, 1, msg.Unknown[1].Number)
+	assert.Equal(t, int(wire.Fixed32Type), msg.Unknown[1].WireType)
+
+	_, err = r.DecodeMessage(payload, []byte{0x12, 0x05, 'a'})
+	assert.Error(t, err)
+
+	deep := wire.AppendVarint(wire.AppendTag(nil, 1, wire.VarintType), 1)
+	for range 10001 {
+		deep = wire.AppendBytes(wire.AppendTag(nil, 7, wire.BytesType), deep)
+	}
+	_, err = r.DecodeMessage(payload, deep)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeded maximum recursion depth")
+
+	var group []byte
+	for range 10001 {
+		group = append(wire.AppendTag(nil, 1, wire.StartGroupType), group...)
+		group = wire.AppendTag(group, 1, wire.EndGroupType)
+	}
+	_, err = r.DecodeMessage(payload, wire.AppendBytes(wire.AppendTag(nil, 7, wire.BytesType), group))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeded maximum recursion depth")
+
+	legacy, err := r.Proto("legacy.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get legacy.proto"))
+	}
+	var mapped []byte
+	for _, value := range []uint64{1, 5} {
+		entry = wire.AppendVarint(wire.AppendTag(nil, 1, wire.VarintType), value)
+		entry = wire.AppendVarint(wire.AppendTag(entry, 2, wire.VarintType), value)
+		mapped = wire.AppendBytes(wire.AppendTag(mapped, 1, wire.BytesType), entry)
+	}
+	msg, err = r.DecodeMessage(legacy.Message(r, "Mapped"), mapped)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "decode mapped"))
+	}
+	values := msg.Get("values").Value.([]past.DynamicMapEntry)
+	assert.Equal(t, 1, len(values))
+	assert.Equal[any](t, int32(1), values[0].Key)
+	assert.Equal(t, 1, len(msg.Unknown))
+	assert.Equal(t, entry, msg.Unknown[0].Value)
+}
+
+func TestEncodeMessage(t *testing.T) {
+	r := testRegistry(t)
+	payload := dynamicPayload(t, r)
+
+	data, err := r.EncodeMessage(payload, map[string]any{
+		"id":     150,
+		"name":   "",
+		"values": []int64{1, 2},
+		"kind":   "KIND_A",
+		"labels": map[int32]string{2: "b", 1: "a"},
+		"count":  uint32(0),
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "encode payload"))
+	}
+
+	var expected []byte
+	expected = wire.AppendVarint(wire.AppendTag(expected, 1, wire.VarintType), 150)
+	expected = wire.AppendBytes(wire.AppendTag(expected, 3, wire.BytesType), []byte{1, 2})
+	expected = wire.AppendVarint(wire.AppendTag(expected, 6, wire.VarintType), 1)
+	for _, label := range []string{"a", "b"} {
+		var entry []byte
+		entry = wire.AppendVarint(wire.AppendTag(entry, 1, wire.VarintType), uint64(label[0]-'a'+1))
+		entry = wire.AppendString(wire.AppendTag(entry, 2, wire.BytesType), label)
+		expected = wire.AppendBytes(wire.AppendTag(expected, 15, wire.BytesType), entry)
+	}
+	// Optional fields are written even with zero values.
+	expected = wire.AppendVarint(wire.AppendTag(expected, 16, wire.VarintType), 0)
+	assert.Equal(t, expected, data)
+
+	tree := map[string]any{
+		"id":       int32(-1),
+		"name":     "root",
+		"values":   []any{json.Number("9007199254740993"), -5},
+		"children": map[string]any{"b": map[string]any{"name": "b"}, "a": map[string]any{"id": 1}},
+		"nested":   map[string]any{"text": "leaf"},
+		"delta":    -70000,
+		"ratio":    1.25,
+		"blob":     []byte{0, 1, 2},
+		"tags":     []string{"x", "y"},
+		"stamp":    uint64(math.MaxUint64),
+		"flag":     true,
+		"score":    float32(0.5),
+		"labels":   map[string]string{"7": "seven"},
+		"kinds":    []any{"KIND_B", 1, 42},
+	}
+	data, err = r.EncodeMessage(payload, tree)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "encode tree"))
+	}
+
+	data = append(data, wire.AppendVarint(wire.AppendTag(nil, 99, wire.VarintType), 5)...)
+	msg, err := r.DecodeMessage(payload, data)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "decode encoded tree"))
+	}
+	assert.Equal[any](t, []any{int64(9007199254740993), int64(-5)}, msg.Get("values").Value)
+	assert.Equal[any](t, uint64(math.MaxUint64), msg.Get("stamp").Value)
+	assert.Equal(t, "leaf", msg.WhichOneOf("choice").Value.(*past.DynamicMessage).Get("text").Value.(string))
+
+	again, err := r.EncodeMessage(payload, msg)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "encode decoded tree"))
+	}
+	assert.Equal(t, data, again)
+
+	built, err := r.NewDynamicMessage(payload, tree)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "build dynamic message"))
+	}
+	children := built.Get("children").Value.([]past.DynamicMapEntry)
+	assert.Equal[any](t, "a", children[0].Key)
+	assert.Equal[any](t, int32(7), built.Get("labels").Value.([]past.DynamicMapEntry)[0].Key)
+
+	for _, tt := range []struct {
+		name  string
+		value map[string]any
+		err   string
+	}{
+		{
+			name:  "unknown field",
+			value: map[string]any{"missing": 1},
+			err:   "unknown .dynamic.v1.Payload field missing",
+		},
+		{
+			name:  "out of range",
+			value: map[string]any{"id": int64(1) << 40},
+			err:   "field id: value 1099511627776 is out of range",
+		},
+		{
+			name:  "wrong type",
+			value: map[string]any{"name": 5},
+			err:   "field name: string value expected, got int",
+		},
+		{
+			name:  "unknown enum value",
+			value: map[string]any{"kind": "KIND_C"},
+			err:   "field kind: unknown .dynamic.v1.Kind value KIND_C",
+		},
+		{
+			name:  "several oneof branches",
+			value: map[string]any{"kind": "KIND_A", "text": "x"},
+			err:   "oneof choice has both kind and text set",
+		},
+		{
+			name:  "scalar for repeated",
+			value: map[string]any{"tags": "x"},
+			err:   "field tags: list expected for repeated field, got string",
+		},
+		{
+			name:  "nested",
+			value: map[string]any{"children": map[string]any{"a": map[string]any{"ratio": "x"}}},
+			err:   "field children: value of key a: field ratio: number expected, got string",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.EncodeMessage(payload, tt.value)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestJSONGolden(t *testing.T) {
+	r := testRegistry(t)
+	file, err := r.Proto("dynamic_wkt.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get dynamic_wkt.proto"))
+	}
+
+	inputs, err := filepath.Glob("testdata/json/*.input.json")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "look for golden inputs"))
+	}
+	assert.True(t, len(inputs) > 0)
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".input.json")
+		t.Run(name, func(t *testing.T) {
+			msg := dynamicPayload(t, r)
+			if strings.HasPrefix(name, "envelope_") {
+				msg = file.Message(r, "Envelope")
+			}
+
+			src := readTestFile(t, input)
+			base := strings.TrimSuffix(input, ".input.json")
+
+			// Inputs protojson rejects have its error message as a golden, messages differ here.
+			if _, err := os.Stat(base + ".golden.error"); err == nil {
+				_, err := r.JSONToBinary(msg, src)
+				assert.Error(t, err)
+				return
+			}
+
+			expectedJSON := bytes.TrimSpace(readTestFile(t, base+".golden.json"))
+			expectedBin, err := hex.DecodeString(string(bytes.TrimSpace(readTestFile(t, base+".golden.hex"))))
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "decode golden binary"))
+			}
+
+			bin, err := r.JSONToBinary(msg, src)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "transcode JSON to binary"))
+			}
+
+			// Golden binaries come from a runtime writing oneof branches after other fields,
+			// so field order is not taken into account.
+			assert.Equal(t, canonicalWire(t, expectedBin), canonicalWire(t, bin))
+
+			out, err := r.BinaryToJSON(msg, expectedBin)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "transcode binary to JSON"))
+			}
+			assert.Equal(t, string(expectedJSON), string(out))
+		})
+	}
+}
+
+// canonicalWire renders encoded message with fields stably sorted by their numbers, so values
+// of repeated fields keep their order. Length delimited values which are valid messages are
+// rendered the same way, others are rendered in hex.
+func canonicalWire(t *testing.T, data []byte) string {
+	t.Helper()
+
+	res, ok := canonicalWireFields(data)
+	if !ok {
+		t.Fatalf("invalid wire data %x", data)
+	}
+
+	return res
+}
+
+func canonicalWireFields(data []byte) (string, bool) {
+	fields, err := wire.Fields(data)
+	if err != nil {
+		return "", false
+	}
+	slices.SortStableFunc(fields, func(a, b wire.Field) int {
+		return a.Number - b.Number
+	})
+
+	var buf strings.Builder
+	for _, field := range fields {
+		value := hex.EncodeToString(field.Value)
+		if field.Type == wire.BytesType || field.Type == wire.StartGroupType {
+			if nested, ok := canonicalWireFields(field.Value); ok && len(field.Value) > 0 {
+				value = "{" + nested + "}"
+			}
+		}
+		fmt.Fprintf(&buf, "%d:%d:%s;", field.Number, field.Type, value)
+	}
+
+	return buf.String(), true
+}
+
+func readTestFile(t *testing.T, path string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(errors.Wrapf(err, "read %s", path))
+	}
+
+	return data
+}
+
+func TestJSONErrors(t *testing.T) {
+	r := testRegistry(t)
+	file, err := r.Proto("dynamic_wkt.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get dynamic_wkt.proto"))
+	}
+	envelope := file.Message(r, "Envelope")
+
+	for _, tt := range []struct {
+		name string
+		json string
+		err  string
+	}{
+		{
+			name: "unknown field",
+			json: `{"payload":{"children":{"a":{"missing":1}}}}`,
+			err:  "/payload/children/a/missing: unknown .dynamic.v1.Payload field missing",
+		},
+		{
+			name: "out of range",
+			json: `{"payload":{"id":4294967296}}`,
+			err:  "/payload/id: value 4294967296 is out of range",
+		},
+		{
+			name: "unknown enum value",
+			json: `{"payload":{"kinds":["KIND_C"]}}`,
+			err:  "/payload/kinds/0: unknown .dynamic.v1.Kind value KIND_C",
+		},
+		{
+			name: "not a number",
+			json: `{"payload":{"values":[1,"x"]}}`,
+			err:  "/payload/values/1: integer expected, got x",
+		},
+		{
+			name: "bad timestamp",
+			json: `{"history":["2024-02-30T00:00:00Z"]}`,
+			err:  `/history/0: invalid google.protobuf.Timestamp value: RFC 3339 timestamp expected, got "2024-02-30T00:00:00Z"`,
+		},
+		{
+			name: "bad duration",
+			json: `{"timeouts":{"a/b":"5m"}}`,
+			err:  `/timeouts/a~1b: invalid google.protobuf.Duration value: duration like 1.5s expected, got "5m"`,
+		},
+		{
+			name: "unknown any type",
+			json: `{"details":{"@type":"type.googleapis.com/dynamic.v1.Missing"}}`,
+			err:  "/details/@type: unknown message type dynamic.v1.Missing of type URL type.googleapis.com/dynamic.v1.Missing",
+		},
+		{
+			name: "several oneof branches",
+			json: `{"payload":{"text":"x","kind":1}}`,
+			err:  "/payload/text: oneof choice has both kind and text set",
+		},
+		{
+			name: "trailing data",
+			json: `{} {}`,
+			err:  "parse JSON: unexpected data after the top level value",
+		},
+		{
+			name: "duplicate key",
+			json: `{"payload":{"id":1,"name":"x","id":2}}`,
+			err:  "/payload/id: duplicate key",
+		},
+		{
+			name: "duplicate map key",
+			json: `{"meta":{"a":1,"a":2}}`,
+			err:  "/meta/a: duplicate key",
+		},
+		{
+			name: "exponent map key",
+			json: `{"payload":{"labels":{"1e0":"x"}}}`,
+			err:  "/payload/labels/1e0: invalid map key: integer expected, got 1e0",
+		},
+		{
+			name: "Go float syntax",
+			json: `{"payload":{"ratio":"inf"}}`,
+			err:  "/payload/ratio: number expected, got inf",
+		},
+		{
+			name: "hex float integer",
+			json: `{"payload":{"id":"0x1p4"}}`,
+			err:  "/payload/id: integer expected, got 0x1p4",
+		},
+		{
+			name: "leading zero duration",
+			json: `{"ttl":"01s"}`,
+			err:  `/ttl: invalid google.protobuf.Duration value: duration like 1.5s expected, got "01s"`,
+		},
+		{
+			name: "invalid UTF-8",
+			json: "{\"payload\":{\"name\":\"\xff\"}}",
+			err:  "parse JSON: invalid UTF-8 in string",
+		},
+		{
+			name: "unpaired surrogate",
+			json: `{"payload":{"name":"\udc00"}}`,
+			err:  `parse JSON: invalid escape code "\\udc00" in string`,
+		},
+		{
+			name: "surrogate at the end",
+			json: `{"payload":{"name":"\ud83d`,
+			err:  `parse JSON: invalid escape code "\\ud83d" in string`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.JSONToBinary(envelope, []byte(tt.json))
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+
+	maps, err := r.Proto("maps.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get maps.proto"))
+	}
+	for _, key := range []string{"t", "1", "True"} {
+		_, err := r.JSONToBinary(maps.Message(r, "Maps"), []byte(`{"rawBytes":{"`+key+`":""}}`))
+		assert.EqualError(t, err, `/rawBytes/`+key+`: invalid map key: bool value expected, got "`+key+`"`)
+	}
+	msg, err := r.DecodeJSON(maps.Message(r, "Maps"), []byte(`{"rawBytes":{"true":"","false":""},"kind":{"-1":0,"0":0}}`))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "decode canonical map keys"))
+	}
+	assert.Equal(t, 2, len(msg.Get("raw_bytes").Value.([]past.DynamicMapEntry)))
+	assert.Equal(t, 2, len(msg.Get("kind").Value.([]past.DynamicMapEntry)))
+}
+
+func TestText(t *testing.T) {
+	r := testRegistry(t)
+	file, err := r.Proto("dynamic_wkt.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get dynamic_wkt.proto"))
+	}
+	envelope := file.Message(r, "Envelope")
+
+	const src = `# Envelope with a bit of everything.
+created { seconds: 1700000000 nanos: 5 }
+details {
+  [type.googleapis.com/dynamic.v1.Payload] < id: 0x10 kind: 2 >
+}
+payload: {
+  name: "multi" 'line\n'
+  values: [1, -2]
+  values: 3;
+  children [{ key: "b" value { flag: t } }, { key: "a" }]
+  labels { key: -1 value: "минус \"один\"" }
+  ratio: -inf, score: 1.5f
+  blob: "\000\377"
+  kinds: [KIND_A, 42]
+  delta: 0
+}
+big { value: -9223372036854775808 }
+`
+	msg, err := r.DecodeText(envelope, []byte(src))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "decode text"))
+	}
+
+	const expected = `created {
+  seconds: 1700000000
+  nanos: 5
+}
+details {
+  [type.googleapis.com/dynamic.v1.Payload] {
+    id: 16
+    kind: KIND_B
+  }
+}
+big {
+  value: -9223372036854775808
+}
+payload {
+  name: "multiline\n"
+  values: 1
+  values: -2
+  values: 3
+  children {
+    key: "a"
+    value {
+    }
+  }
+  children {
+    key: "b"
+    value {
+      flag: true
+    }
+  }
+  ratio: -inf
+  blob: "\000\377"
+  score: 1.5
+  labels {
+    key: -1
+    value: "минус \"один\""
+  }
+  kinds: KIND_A
+  kinds: 42
+}
+`
+	out, err := r.EncodeText(msg)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "encode text"))
+	}
+	assert.Equal(t, expected, string(out))
+
+	bin, err := r.TextToBinary(envelope, out)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "transcode canonical text"))
+	}
+	again, err := r.BinaryToText(envelope, bin)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "transcode binary to text"))
+	}
+	assert.Equal(t, expected, string(again))
+
+	for _, tt := range []struct {
+		name string
+		text string
+		err  string
+	}{
+		{
+			name: "unknown field",
+			text: "payload {\n  id: 1\n  missing: 2\n}",
+			err:  "3:3: unknown .dynamic.v1.Payload field missing",
+		},
+		{
+			name: "wrong type",
+			text: "payload { name: 5 }",
+			err:  "1:17: string literal expected for string, got 5",
+		},
+		{
+			name: "out of range",
+			text: "payload {\n\tid: 2147483648\n}",
+			err:  "2:6: value 2147483648 is out of int32 range",
+		},
+		{
+			name: "duplicate field",
+			text: "payload { id: 1 }\npayload { id: 2 }",
+			err:  "2:1: field payload is set several times",
+		},
+		{
+			name: "duplicate scalar",
+			text: "payload { id: 1 id: 2 }",
+			err:  "1:17: field id is set several times",
+		},
+		{
+			name: "several oneof branches",
+			text: "payload { text: \"x\" kind: KIND_A }",
+			err:  "1:21: oneof choice has both text and kind set",
+		},
+		{
+			name: "unknown enum value",
+			text: "payload { kinds: [KIND_A, KIND_C] }",
+			err:  "1:27: unknown .dynamic.v1.Kind value KIND_C",
+		},
+		{
+			name: "missing colon",
+			text: "payload { id 1 }",
+			err:  "1:14: : expected after field name id, got 1",
+		},
+		{
+			name: "unclosed message",
+			text: "payload { id: 1",
+			err:  "1:16: } expected, got end of input",
+		},
+		{
+			name: "unterminated string",
+			text: "payload { name: \"x\n}",
+			err:  "1:17: unterminated string literal",
+		},
+		{
+			name: "extension",
+			text: "[dynamic.v1.ext]: 1",
+			err:  "1:1: .dynamic.v1.Envelope has no extension dynamic.v1.ext, extensions are not supported",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.DecodeText(envelope, []byte(tt.text))
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	r := testRegistry(t)
+	file, err := r.Proto("dynamic_wkt.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get dynamic_wkt.proto"))
+	}
+	envelope := file.Message(r, "Envelope")
+
+	for _, input := range []string{"envelope_any_nested", "envelope_struct", "envelope_times", "envelope_wrappers"} {
+		assert.Zero(t, protoast.Validate(r, envelope, readTestFile(t, "testdata/json/"+input+".input.json")))
+	}
+
+	const doc = `{
+		"created": "yesterday",
+		"ttl": "1.5s",
+		"ttl": "2s",
+		"details": {"@type": "type.googleapis.com/dynamic.v1.Payload", "id": "x", "bogus": 1},
+		"meta": {"a": 1e400, "b": {"c": [true, -1e400], "d": null}},
+		"items": [1, "x", 1e999],
+		"mask": "a_b",
+		"small": -1,
+		"history": ["1970-01-01T00:00:00Z", 5],
+		"timeouts": {"a": "1s", "b/c": "1m"},
+		"payload": {
+			"id": 2147483648,
+			"kind": "KIND_C",
+			"text": "x",
+			"values": [1, "9223372036854775808", 2.5],
+			"labels": {"one": "1", "2": 2},
+			"children": {"a": {"flag": "yes"}},
+			"extra": true,
+			"name": "a",
+			"name": "b"
+		},
+		"unknown": null
+	}`
+	var violations []string
+	for _, v := range protoast.Validate(r, envelope, []byte(doc)) {
+		violations = append(violations, v.String())
+	}
+	assert.Equal(t, []string{
+		"/ttl: duplicate key",
+		"/payload/name: duplicate key",
+		`/created: invalid google.protobuf.Timestamp value: RFC 3339 timestamp expected, got "yesterday"`,
+		"/details/bogus: unknown .dynamic.v1.Payload field bogus",
+		"/details/id: integer expected, got x",
+		"/history/1: invalid google.protobuf.Timestamp value: string expected, got number",
+		"/items/2: number expected, got 1e999",
+		`/mask: invalid google.protobuf.FieldMask value: invalid path "a_b"`,
+		"/meta/a: number expected, got 1e400",
+		"/meta/b/c/1: number expected, got -1e400",
+		"/payload/children/a/flag: bool value expected, got string",
+		"/payload/extra: unknown .dynamic.v1.Payload field extra",
+		"/payload/id: value 2147483648 is out of range",
+		"/payload/kind: unknown .dynamic.v1.Kind value KIND_C",
+		"/payload/labels/2: string value expected, got number",
+		"/payload/labels/one: invalid map key: integer expected, got one",
+		"/payload/text: oneof choice has both kind and text set",
+		"/payload/values/1: value 9223372036854775808 is out of range",
+		"/payload/values/2: integer expected, got 2.5",
+		"/small: value -1 is out of range",
+		`/timeouts/b~1c: invalid google.protobuf.Duration value: duration like 1.5s expected, got "1m"`,
+		"/unknown: unknown .dynamic.v1.Envelope field unknown",
+	}, violations)
+
+	violations = violations[:0]
+	for _, v := range protoast.Validate(r, envelope, []byte(`{"payload": [}`)) {
+		violations = append(violations, v.String())
+	}
+	assert.Equal(t, []string{"parse JSON: invalid character '}' looking for beginning of value"}, violations)
+}
+
+func TestExample(t *testing.T) {
+	r := testRegistry(t)
+	file, err := r.Proto("dynamic_example.proto")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get dynamic_example.proto"))
+	}
+	tree := file.Message(r, "Tree")
+
+	// The first oneof branch and the envelope are left unset.
+	hook := func(field past.FieldNode) (any, bool) {
+		switch field.(interface{ Name() string }).Name() {
+		case "bytes", "envelope":
+			return nil, true
+		}
+
+		option := r.OptionNamed(field.(past.NodeOptionable), "(example)")
+		if option == nil {
+			return nil, false
+		}
+		return option.Value().Interface(), true
+	}
+
+	data, err := r.ExampleJSON(tree, past.ExampleOptions{MaxDepth: 1, Hook: hook})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "generate JSON example"))
+	}
+	assert.Equal(t, `{"name":"root","children":[{"name":"root","created":"2024-01-01T00:00:00Z","human":"human","kinds":{"1":"KIND_A"}}],`+
+		`"created":"2024-01-01T00:00:00Z","human":"human","kinds":{"1":"KIND_A"}}`, string(data))
+	assert.Zero(t, protoast.Validate(r, tree, data))
+
+	text, err := r.ExampleText(tree, past.ExampleOptions{MaxDepth: 1, Hook: hook})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "generate text example"))
+	}
+	assert.Equal(t, `name: "root"
+children {
+  name: "root"
+  created {
+    seconds: 1704067200
+  }
+  human: "human"
+  kinds {
+    key: 1
+    value: KIND_A
+  }
+}
+created {
+  seconds: 1704067200
+}
+human: "human"
+kinds {
+  key: 1
+  value: KIND_A
+}
+`, string(text))
+
+	// Well-known types are set at any depth.
+	msg, err := r.Example(tree, past.ExampleOptions{MaxDepth: 1})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "generate example"))
+	}
+	envelope := msg.Get("envelope").Value.(*past.DynamicMessage)
+	assert.Zero(t, envelope.Get("payload"))
+	assert.Equal[any](t, int64(1704067200), envelope.Get("created").Value.(*past.DynamicMessage).Get("seconds").Value)
+	assert.Equal[any](t, "value", envelope.Get("extra").Value.(*past.DynamicMessage).Get("string_value").Value)
+
+	// Examples of every depth are valid and transcode to the same binary.
+	for depth := 1; depth <= 4; depth++ {
+		opts := past.ExampleOptions{MaxDepth: depth}
+		data, err := r.ExampleJSON(tree, opts)
+		if err != nil {
+			t.Fatal(errors.Wrapf(err, "generate JSON example of depth %d", depth))
+		}
+		assert.Zero(t, protoast.Validate(r, tree, data))
+
+		text, err := r.ExampleText(tree, opts)
+		if err != nil {
+			t.Fatal(errors.Wrapf(err, "generate text example of depth %d", depth))
+		}
+
+		fromJSON, err := r.JSONToBinary(tree, data)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "transcode JSON example"))
+		}
+		fromText, err := r.TextToBinary(tree, text)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "transcode text example"))
+		}
+		assert.Equal(t, fromJSON, fromText)
+	}
+
+	_, err = r.Example(tree, past.ExampleOptions{Hook: func(field past.FieldNode) (any, bool) {
+		return "many", field.(*past.MessageField).Name() == "children"
+	}})
+	assert.EqualError(t, err, ".dynamic.v1.Tree field children hook value: list expected for repeated field, got string")
+}